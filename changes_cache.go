@@ -0,0 +1,349 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terramate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/git"
+	"github.com/mineiros-io/terramate/tf"
+	"github.com/rs/zerolog/log"
+)
+
+// ChangesCacheFile is the path of the change detection cache file, relative
+// to the git directory of the repository.
+const ChangesCacheFile = "terramate/changes-cache.json"
+
+// changesCacheVersion is the version of the cache file format. Cache files of
+// other versions are discarded, so it must be incremented whenever the format
+// or the meaning of the cached data changes.
+const changesCacheVersion = 2
+
+type (
+	// changesCache caches the local module dependency graph of the stacks.
+	// The graph of each stack is its module closure: the directories of the
+	// stack and of the local modules it calls, directly or indirectly, with
+	// the module calls of their Terraform files. Each directory is invalidated
+	// by the git blob hashes of its Terraform files, so only the directories
+	// with changed files are parsed again. The module calls of single files
+	// are also cached by blob hash, so a changed directory only parses its
+	// changed files. A nil cache is valid and parses every file.
+	changesCache struct {
+		path    string
+		modules map[string][]tf.Module
+
+		// dirs are the module calls of the directories of the closures,
+		// keyed by the path of the directory relative to the git root.
+		dirs map[string]*cachedDirModules
+
+		// stacks are the closures of the stacks, keyed by the stack dir, as
+		// lists of the directories of the closure.
+		stacks map[string][]string
+
+		// used are the hashes looked up since the cache was loaded. Only
+		// them are saved, so the cache doesn't grow forever.
+		used  map[string]bool
+		dirty bool
+	}
+
+	// cachedDirModules are the module calls of the Terraform files of a
+	// directory, valid while the files have the given blob hashes.
+	cachedDirModules struct {
+		files   map[string]string
+		modules []tf.Module
+	}
+
+	changesCacheData struct {
+		Version int                       `json:"version"`
+		Modules map[string][]cachedModule `json:"modules"`
+		Dirs    map[string]cachedDir      `json:"dirs"`
+		Stacks  map[string][]string       `json:"stacks"`
+	}
+
+	cachedDir struct {
+		Files   map[string]string `json:"files"`
+		Modules []cachedModule    `json:"modules"`
+	}
+
+	cachedModule struct {
+		Name   string `json:"name"`
+		Source string `json:"source"`
+	}
+)
+
+// loadChangesCache loads the cache from the given file. Missing, invalid or
+// outdated cache files are not an error, an empty cache is returned instead.
+func loadChangesCache(path string) *changesCache {
+	logger := log.With().
+		Str("action", "loadChangesCache()").
+		Str("path", path).
+		Logger()
+
+	cache := &changesCache{
+		path:    path,
+		modules: map[string][]tf.Module{},
+		dirs:    map[string]*cachedDirModules{},
+		stacks:  map[string][]string{},
+		used:    map[string]bool{},
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		logger.Debug().Err(err).Msg("no change detection cache")
+		return cache
+	}
+
+	var data changesCacheData
+	if err := json.Unmarshal(content, &data); err != nil {
+		logger.Debug().Err(err).Msg("ignoring invalid change detection cache")
+		return cache
+	}
+
+	if data.Version != changesCacheVersion {
+		logger.Debug().
+			Int("version", data.Version).
+			Msg("ignoring change detection cache of other version")
+		return cache
+	}
+
+	for hash, cached := range data.Modules {
+		cache.modules[hash] = fromCachedModules(cached)
+	}
+	for dir, cached := range data.Dirs {
+		cache.dirs[dir] = &cachedDirModules{
+			files:   cached.Files,
+			modules: fromCachedModules(cached.Modules),
+		}
+	}
+	for stack, dirs := range data.Stacks {
+		cache.stacks[stack] = dirs
+	}
+	return cache
+}
+
+// parseModules returns the modules called by the Terraform file of the given
+// content. The path is only used on error messages.
+func (c *changesCache) parseModules(path string, content []byte) ([]tf.Module, error) {
+	if c == nil {
+		return tf.ParseModulesFromSource(path, content)
+	}
+
+	return c.parseBlobModules(path, git.BlobHash(content), content)
+}
+
+// parseBlobModules returns the modules called by the Terraform file of the
+// given content and blob hash. The path is only used on error messages.
+func (c *changesCache) parseBlobModules(path, hash string, content []byte) ([]tf.Module, error) {
+	if modules, ok := c.lookup(hash); ok {
+		return modules, nil
+	}
+
+	modules, err := tf.ParseModulesFromSource(path, content)
+	if err != nil {
+		return nil, err
+	}
+	c.store(hash, modules)
+	return modules, nil
+}
+
+// lookup returns the modules called by the Terraform file with the given blob
+// hash, if cached.
+func (c *changesCache) lookup(hash string) ([]tf.Module, bool) {
+	if c == nil {
+		return nil, false
+	}
+	modules, ok := c.modules[hash]
+	if ok {
+		c.used[hash] = true
+	}
+	return modules, ok
+}
+
+// store caches the modules called by the Terraform file with the given blob
+// hash.
+func (c *changesCache) store(hash string, modules []tf.Module) {
+	if c == nil {
+		return
+	}
+	c.modules[hash] = modules
+	c.used[hash] = true
+	c.dirty = true
+}
+
+// lookupDir returns the module calls of the directory, relative to the git
+// root, if cached. The caller must check that the files of the directory still
+// have the cached blob hashes.
+func (c *changesCache) lookupDir(dir string) (*cachedDirModules, bool) {
+	if c == nil {
+		return nil, false
+	}
+	cached, ok := c.dirs[dir]
+	if ok {
+		for _, hash := range cached.files {
+			if _, ok := c.modules[hash]; ok {
+				c.used[hash] = true
+			}
+		}
+	}
+	return cached, ok
+}
+
+// storeDir caches the module calls of the directory, relative to the git root,
+// which Terraform files have the given blob hashes by file name.
+func (c *changesCache) storeDir(dir string, files map[string]string, modules []tf.Module) {
+	if c == nil {
+		return
+	}
+	c.dirs[dir] = &cachedDirModules{
+		files:   files,
+		modules: modules,
+	}
+	c.dirty = true
+}
+
+// stackClosure returns the cached closure of the stack as the list of its
+// directories, relative to the git root.
+func (c *changesCache) stackClosure(stackdir string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	dirs, ok := c.stacks[stackdir]
+	return dirs, ok
+}
+
+// storeStack caches the closure of the stack as the list of its directories,
+// relative to the git root.
+func (c *changesCache) storeStack(stackdir string, dirs []string) {
+	if c == nil {
+		return
+	}
+	if old, ok := c.stacks[stackdir]; ok && equalStrings(old, dirs) {
+		return
+	}
+	c.stacks[stackdir] = dirs
+	c.dirty = true
+}
+
+// pruneStacks drops the closures of the stacks which are not in the given
+// list of existing stacks.
+func (c *changesCache) pruneStacks(existing map[string]bool) {
+	if c == nil {
+		return
+	}
+	for stackdir := range c.stacks {
+		if !existing[stackdir] {
+			delete(c.stacks, stackdir)
+			c.dirty = true
+		}
+	}
+}
+
+// save writes the cache file, if it changed. The file entries which were not
+// used since the cache was loaded are dropped, as well as the directories not
+// part of any stack closure.
+func (c *changesCache) save() error {
+	if c == nil || (!c.dirty && len(c.used) == len(c.modules)) {
+		return nil
+	}
+
+	data := changesCacheData{
+		Version: changesCacheVersion,
+		Modules: map[string][]cachedModule{},
+		Dirs:    map[string]cachedDir{},
+		Stacks:  c.stacks,
+	}
+	for hash := range c.used {
+		data.Modules[hash] = toCachedModules(c.modules[hash])
+	}
+	for _, dirs := range c.stacks {
+		for _, dir := range dirs {
+			cached, ok := c.dirs[dir]
+			if !ok {
+				continue
+			}
+			data.Dirs[dir] = cachedDir{
+				Files:   cached.files,
+				Modules: toCachedModules(cached.modules),
+			}
+		}
+	}
+
+	content, err := json.Marshal(data)
+	if err != nil {
+		return errors.E(err, "encoding change detection cache")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return errors.E(err, "creating change detection cache dir")
+	}
+
+	// the file is replaced atomically, so concurrent runs never read a
+	// partially written cache.
+	tmpfile, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return errors.E(err, "creating change detection cache file")
+	}
+
+	_, err = tmpfile.Write(content)
+	errClose := tmpfile.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmpfile.Name(), c.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpfile.Name())
+		return errors.E(err, "writing change detection cache file")
+	}
+	return nil
+}
+
+func toCachedModules(modules []tf.Module) []cachedModule {
+	cached := make([]cachedModule, len(modules))
+	for i, mod := range modules {
+		cached[i] = cachedModule{
+			Name:   mod.Name,
+			Source: mod.Source,
+		}
+	}
+	return cached
+}
+
+func fromCachedModules(cached []cachedModule) []tf.Module {
+	modules := make([]tf.Module, len(cached))
+	for i, mod := range cached {
+		modules[i] = tf.Module{
+			Name:   mod.Name,
+			Source: mod.Source,
+		}
+	}
+	return modules
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
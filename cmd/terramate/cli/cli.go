@@ -20,9 +20,11 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/bmatcuk/doublestar"
 	"github.com/google/uuid"
 	hhcl "github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclwrite"
@@ -88,6 +90,8 @@ const (
 
 const defaultVendorDir = "/modules"
 
+const defaultRunStateFilename = "run-state.json"
+
 type cliSpec struct {
 	Version        struct{} `cmd:"" help:"Terramate version"`
 	VersionFlag    bool     `name:"version" help:"Terramate version"`
@@ -105,6 +109,9 @@ type cliSpec struct {
 	DisableCheckGitUntracked   bool `optional:"true" default:"false" help:"Disable git check for untracked files"`
 	DisableCheckGitUncommitted bool `optional:"true" default:"false" help:"Disable git check for uncommitted files"`
 
+	ChangedIncludeUncommitted bool `optional:"true" help:"Consider uncommitted and untracked files as changes, implies --changed and disables the git checks for untracked and uncommitted files"`
+	DisableChangesCache       bool `optional:"true" default:"false" help:"Disable the change detection cache stored in the git directory"`
+
 	Create struct {
 		Path           string   `arg:"" name:"path" predictor:"file" help:"Path of the new stack relative to the working dir"`
 		ID             string   `help:"ID of the stack, defaults to UUID"`
@@ -122,20 +129,58 @@ type cliSpec struct {
 	} `cmd:"" help:"Format all files inside dir recursively"`
 
 	List struct {
-		Why bool `help:"Shows the reason why the stack has changed"`
+		Why  bool `help:"Shows the reason why the stack has changed"`
+		JSON bool `name:"json" help:"Print the stacks as JSON"`
 	} `cmd:"" help:"List stacks"`
 
 	Run struct {
-		DisableCheckGenCode   bool     `default:"false" help:"Disable outdated generated code check"`
-		DisableCheckGitRemote bool     `default:"false" help:"Disable checking if local default branch is updated with remote"`
-		ContinueOnError       bool     `default:"false" help:"Continue executing in other stacks in case of error"`
-		NoRecursive           bool     `default:"false" help:"Do not recurse into child stacks"`
-		DryRun                bool     `default:"false" help:"Plan the execution but do not execute it"`
-		Reverse               bool     `default:"false" help:"Reverse the order of execution"`
-		Command               []string `arg:"" name:"cmd" predictor:"file" passthrough:"" help:"Command to execute"`
+		DisableCheckGenCode   bool           `default:"false" help:"Disable outdated generated code check"`
+		DisableCheckGitRemote bool           `default:"false" help:"Disable checking if local default branch is updated with remote"`
+		ContinueOnError       bool           `default:"false" help:"Continue executing in other stacks in case of error"`
+		NoRecursive           bool           `default:"false" help:"Do not recurse into child stacks"`
+		DryRun                bool           `default:"false" help:"Plan the execution but do not execute it"`
+		JSON                  bool           `name:"json" default:"false" help:"Print the plan of a dry run as JSON"`
+		Reverse               bool           `default:"false" help:"Reverse the order of execution"`
+		Parallel              int            `default:"1" help:"Maximum number of stacks to run concurrently, respecting the order of execution"`
+		PrefixOutput          bool           `default:"false" help:"Prefix each line of the commands output with the stack path"`
+		Timeout               *time.Duration `help:"Maximum duration of the command on each stack, after which it is interrupted"`
+		Retries               *int           `help:"Number of times the command is retried on the stacks where it fails"`
+		RetryDelay            *time.Duration `help:"Duration to wait before retrying a failed command"`
+		LogDir                string         `default:"" predictor:"file" help:"Save the output, exit status and duration of each stack inside the given directory"`
+		ReportJSON            string         `name:"report-json" default:"" predictor:"file" help:"Write a JSON report of the execution on each stack to the given file"`
+		ReportJUnit           string         `name:"report-junit" default:"" predictor:"file" help:"Write a JUnit XML report of the execution on each stack to the given file"`
+		SaveState             bool           `default:"false" help:"Save the run state so the run can be resumed later with --resume"`
+		StateFile             string         `default:"" predictor:"file" help:"File where the run state is saved to be resumed later, implies --save-state (defaults to terramate/run-state.json inside the git dir)"`
+		Resume                bool           `default:"false" help:"Resume the last run, executing only the stacks that did not succeed"`
+		Command               []string       `arg:"" optional:"true" name:"cmd" predictor:"file" passthrough:"" help:"Command to execute"`
 	} `cmd:"" help:"Run command in the stacks"`
 
-	Generate struct{} `cmd:"" help:"Generate terraform code for stacks"`
+	Script struct {
+		List struct{} `cmd:"" help:"List the scripts available in the current directory and its child directories"`
+
+		Run struct {
+			DisableCheckGenCode   bool           `default:"false" help:"Disable outdated generated code check"`
+			DisableCheckGitRemote bool           `default:"false" help:"Disable checking if local default branch is updated with remote"`
+			ContinueOnError       bool           `default:"false" help:"Continue executing in other stacks in case of error"`
+			NoRecursive           bool           `default:"false" help:"Do not recurse into child stacks"`
+			DryRun                bool           `default:"false" help:"Plan the execution but do not execute it"`
+			JSON                  bool           `name:"json" default:"false" help:"Print the plan of a dry run as JSON"`
+			Reverse               bool           `default:"false" help:"Reverse the order of execution"`
+			Parallel              int            `default:"1" help:"Maximum number of stacks to run concurrently, respecting the order of execution"`
+			PrefixOutput          bool           `default:"false" help:"Prefix each line of the commands output with the stack path"`
+			Timeout               *time.Duration `help:"Maximum duration of the script on each stack, after which it is interrupted"`
+			Retries               *int           `help:"Number of times the script is retried on the stacks where it fails"`
+			RetryDelay            *time.Duration `help:"Duration to wait before retrying a failed script"`
+			Name                  string         `arg:"" name:"name" help:"Name of the script"`
+		} `cmd:"" help:"Run a script in the stacks"`
+	} `cmd:"" help:"Manage and run scripts"`
+
+	Generate struct {
+		Paths []string `arg:"" optional:"true" name:"paths" predictor:"file" help:"Generate only the stacks inside the given paths"`
+		Check bool     `help:"Lists outdated generated files without changing them, exit with 0 if all is up to date, 1 otherwise"`
+		Diff  bool     `help:"Shows the unified diff of the outdated generated files without changing them"`
+		Force bool     `help:"Ignore the code generation cache and generate all stacks"`
+	} `cmd:"" help:"Generate terraform code for stacks"`
 
 	InstallCompletions kongplete.InstallCompletions `cmd:"" help:"Install shell completions"`
 
@@ -146,9 +191,25 @@ type cliSpec struct {
 		} `cmd:"" help:"Clones a stack"`
 
 		Trigger struct {
-			Stack  string `arg:"" name:"stack" predictor:"file" help:"Path of the stack being triggered"`
-			Reason string `default:"" name:"reason" help:"Reason for the stack being triggered"`
-		} `cmd:"" help:"Triggers a stack"`
+			Create struct {
+				Stack   string `arg:"" optional:"" name:"stack" predictor:"file" help:"Path or glob pattern of the stacks being triggered"`
+				Reason  string `default:"" name:"reason" help:"Reason for the stacks being triggered"`
+				Expires string `default:"" name:"expires" help:"Expiration of the trigger, as a duration (eg.: 72h) or a RFC3339 date"`
+				Type    string `default:"changed" enum:"changed,ignore-change" name:"type" help:"Type of the trigger: changed or ignore-change"`
+			} `cmd:"" default:"withargs" help:"Triggers a stack"`
+
+			List struct{} `cmd:"" help:"List the triggers of the project"`
+
+			Show struct {
+				File string `arg:"" name:"file" predictor:"file" help:"Path of the trigger file"`
+			} `cmd:"" help:"Shows a trigger"`
+
+			Clear struct {
+				Stack   string `arg:"" optional:"" name:"stack" predictor:"file" help:"Path of the stack which triggers are cleared"`
+				All     bool   `default:"false" help:"Clear the triggers of all stacks"`
+				Expired bool   `default:"false" help:"Clear only the expired triggers"`
+			} `cmd:"" help:"Clears the triggers of a stack"`
+		} `cmd:"" help:"Manages stack triggers"`
 
 		Metadata struct{} `cmd:"" help:"Shows metadata available on the project"`
 
@@ -361,6 +422,10 @@ func newCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) *cli {
 		fatal(err, "setting configuration")
 	}
 
+	if parsedArgs.ChangedIncludeUncommitted {
+		parsedArgs.Changed = true
+	}
+
 	if parsedArgs.Changed && !prj.isRepo {
 		log.Fatal().Msg("flag --changed provided but no git repository found")
 	}
@@ -408,16 +473,33 @@ func (c *cli) run() {
 		c.setupGit()
 		c.printStacks()
 	case "run":
-		log.Fatal().Msg("no command specified")
+		if !c.parsedArgs.Run.Resume {
+			log.Fatal().Msg("no command specified")
+		}
+		c.setupGit()
+		c.runOnStacks()
 	case "run <cmd>":
 		c.setupGit()
 		c.runOnStacks()
-	case "generate":
+	case "script list":
+		c.setupGit()
+		c.listScripts()
+	case "script run <name>":
+		c.setupGit()
+		c.runScript()
+	case "generate", "generate <paths>":
 		c.generate()
 	case "experimental clone <srcdir> <destdir>":
 		c.cloneStack()
-	case "experimental trigger <stack>":
+	case "experimental trigger", "experimental trigger create",
+		"experimental trigger <stack>", "experimental trigger create <stack>":
 		c.triggerStack()
+	case "experimental trigger list":
+		c.listTriggers()
+	case "experimental trigger show <file>":
+		c.showTrigger()
+	case "experimental trigger clear", "experimental trigger clear <stack>":
+		c.clearTriggers()
 	case "experimental vendor download <source> <ref>":
 		c.vendorDownload()
 	case "experimental globals":
@@ -605,17 +687,67 @@ func hasVendorDirConfig(cfg hcl.Config) bool {
 }
 
 func (c *cli) triggerStack() {
-	stack := c.parsedArgs.Experimental.Trigger.Stack
-	reason := c.parsedArgs.Experimental.Trigger.Reason
+	args := c.parsedArgs.Experimental.Trigger.Create
+	reason := args.Reason
 	if reason == "" {
 		reason = "Created using Terramate CLI without setting specific reason."
 	}
 	logger := log.With().
-		Str("stack", stack).
+		Str("stack", args.Stack).
 		Logger()
 
 	logger.Debug().Msg("creating stack trigger")
 
+	expires, err := parseTriggerExpiration(args.Expires, time.Now())
+	if err != nil {
+		errlog.Fatal(logger, err)
+	}
+
+	hasFilters := c.parsedArgs.Changed || !c.tags.IsEmpty()
+
+	var stacks []prj.Path
+	switch {
+	case args.Stack == "" && !hasFilters:
+		errlog.Fatal(logger, errors.E(
+			"a stack path, a glob pattern, --tags, --no-tags or --changed must be given",
+		))
+	case args.Stack != "" && !prj.IsGlobPattern(args.Stack):
+		if hasFilters {
+			errlog.Fatal(logger, errors.E(
+				"a stack path can't be used with --tags, --no-tags or --changed (use a glob pattern instead)",
+			))
+		}
+		stacks = []prj.Path{c.triggerStackPath(args.Stack)}
+	default:
+		stacks = c.selectStacksToTrigger(args.Stack)
+	}
+
+	if len(stacks) == 0 {
+		logger.Warn().Msg("no stacks selected to be triggered")
+		return
+	}
+
+	for _, stackPath := range stacks {
+		_, err = trigger.CreateWithInfo(c.cfg(), stackPath, trigger.Info{
+			Reason:  reason,
+			Type:    args.Type,
+			Expires: expires,
+		})
+		if err != nil {
+			errlog.Fatal(logger, err)
+		}
+
+		c.output.MsgStdOut("Created trigger for stack %q", stackPath)
+	}
+}
+
+// triggerStackPath returns the project path of the stack given on the
+// command line, which is relative to the working directory unless absolute.
+func (c *cli) triggerStackPath(stack string) prj.Path {
+	logger := log.With().
+		Str("stack", stack).
+		Logger()
+
 	if !path.IsAbs(stack) {
 		stack = filepath.Join(c.wd(), filepath.FromSlash(stack))
 	} else {
@@ -632,12 +764,167 @@ func (c *cli) triggerStack() {
 		errlog.Fatal(logger, errors.E("stack %s is outside project", stack))
 	}
 
-	stackPath := prj.PrjAbsPath(c.rootdir(), stack)
-	if err := trigger.Create(c.cfg(), stackPath, reason); err != nil {
-		errlog.Fatal(logger, err)
+	return prj.PrjAbsPath(c.rootdir(), stack)
+}
+
+// selectStacksToTrigger selects the stacks to be triggered using the --tags,
+// --no-tags and --changed filters. If the pattern is not empty, then only the
+// stacks matching it are selected, otherwise only the stacks inside the
+// working directory are selected. A relative pattern is relative to the
+// working directory.
+func (c *cli) selectStacksToTrigger(pattern string) []prj.Path {
+	if pattern != "" && !path.IsAbs(pattern) {
+		relwd := prj.PrjAbsPath(c.rootdir(), c.wd())
+		pattern = path.Join(relwd.String(), pattern)
+	}
+
+	if pattern != "" {
+		if _, err := doublestar.Match(pattern, "/"); err != nil {
+			fatal(errors.E(err, "invalid glob pattern %q", pattern), "triggering stacks")
+		}
+	}
+
+	c.setupGit()
+
+	report, err := c.listStacks(c.newManager(), c.parsedArgs.Changed)
+	if err != nil {
+		fatal(err, "listing stacks")
+	}
+
+	var entries []terramate.Entry
+	if pattern != "" {
+		entries = c.filterStacksByTags(report.Stacks)
+	} else {
+		entries = c.filterStacks(report.Stacks)
 	}
 
-	c.output.MsgStdOut("Created trigger for stack %q", stackPath)
+	var stacks []prj.Path
+	for _, e := range entries {
+		if pattern != "" {
+			// the pattern is valid, so no error can happen.
+			if matched, _ := doublestar.Match(pattern, e.Stack.Dir.String()); !matched {
+				continue
+			}
+		}
+		stacks = append(stacks, e.Stack.Dir)
+	}
+	return stacks
+}
+
+// parseTriggerExpiration parses the expiration of a trigger, given as a
+// duration relative to now or as a RFC3339 date, into a unix timestamp.
+// An empty expiration means the trigger never expires.
+func parseTriggerExpiration(expires string, now time.Time) (int64, error) {
+	if expires == "" {
+		return 0, nil
+	}
+	if date, err := time.Parse(time.RFC3339, expires); err == nil {
+		return date.Unix(), nil
+	}
+	duration, err := time.ParseDuration(expires)
+	if err != nil || duration <= 0 {
+		return 0, errors.E(
+			"invalid --expires %q: must be a positive duration (eg.: 72h) or a RFC3339 date",
+			expires,
+		)
+	}
+	return now.Add(duration).Unix(), nil
+}
+
+func (c *cli) listTriggers() {
+	files, err := trigger.List(c.rootdir())
+	if err != nil {
+		fatal(err, "listing triggers")
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		c.printTrigger(file, now)
+	}
+}
+
+func (c *cli) showTrigger() {
+	file := c.parsedArgs.Experimental.Trigger.Show.File
+	if !path.IsAbs(file) {
+		file = filepath.Join(c.wd(), filepath.FromSlash(file))
+	} else {
+		file = filepath.Join(c.rootdir(), filepath.FromSlash(file))
+	}
+
+	prjpath := prj.PrjAbsPath(c.rootdir(), filepath.Clean(file))
+	stack, ok := trigger.StackPath(prjpath)
+	if !ok {
+		fatal(errors.E("%s is not a trigger file", prjpath), "showing trigger")
+	}
+
+	info, err := trigger.ParseFile(file)
+	if err != nil {
+		fatal(err, "showing trigger")
+	}
+
+	c.printTrigger(trigger.File{
+		Path:  prjpath,
+		Stack: stack,
+		Info:  info,
+	}, time.Now())
+}
+
+func (c *cli) printTrigger(file trigger.File, now time.Time) {
+	c.output.MsgStdOut("%s", file.Path)
+	c.output.MsgStdOut("\tstack: %s", file.Stack)
+	c.output.MsgStdOut("\ttype: %s", file.Info.Type)
+	c.output.MsgStdOut("\tcreated: %s", time.Unix(file.Info.Ctime, 0).UTC().Format(time.RFC3339))
+	if file.Info.Expires != 0 {
+		expires := time.Unix(file.Info.Expires, 0).UTC().Format(time.RFC3339)
+		if file.Info.IsExpired(now) {
+			expires += " (expired)"
+		}
+		c.output.MsgStdOut("\texpires: %s", expires)
+	}
+	c.output.MsgStdOut("\treason: %s", file.Info.Reason)
+}
+
+func (c *cli) clearTriggers() {
+	args := c.parsedArgs.Experimental.Trigger.Clear
+
+	var stackPath prj.Path
+	switch {
+	case args.Stack != "" && args.All:
+		fatal(errors.E("a stack path and --all are mutually exclusive"), "clearing triggers")
+	case args.Stack != "":
+		stack := args.Stack
+		if !path.IsAbs(stack) {
+			stack = filepath.Join(c.wd(), filepath.FromSlash(stack))
+		} else {
+			stack = filepath.Join(c.rootdir(), filepath.FromSlash(stack))
+		}
+		stack = filepath.Clean(stack)
+		if !strings.HasPrefix(stack, c.rootdir()) {
+			fatal(errors.E("stack %s is outside project", stack), "clearing triggers")
+		}
+		stackPath = prj.PrjAbsPath(c.rootdir(), stack)
+	case !args.All && !args.Expired:
+		fatal(errors.E("a stack path, --all or --expired must be given"), "clearing triggers")
+	}
+
+	files, err := trigger.List(c.rootdir())
+	if err != nil {
+		fatal(err, "listing triggers")
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		if args.Stack != "" && file.Stack != stackPath {
+			continue
+		}
+		if args.Expired && !file.Info.IsExpired(now) {
+			continue
+		}
+		if err := trigger.Remove(c.rootdir(), file); err != nil {
+			fatal(err, "clearing triggers")
+		}
+		c.output.MsgStdOut("Removed trigger %s", file.Path)
+	}
 }
 
 func (c *cli) cloneStack() {
@@ -666,7 +953,14 @@ func (c *cli) cloneStack() {
 }
 
 func (c *cli) generate() {
-	report, vendorReport := c.gencodeWithVendor()
+	stacks := c.selectStacksToGenerate()
+
+	if c.parsedArgs.Generate.Check || c.parsedArgs.Generate.Diff {
+		c.checkGenerate(stacks)
+		return
+	}
+
+	report, vendorReport := c.gencodeWithVendor(stacks)
 
 	c.output.MsgStdOut(report.Full())
 
@@ -681,9 +975,99 @@ func (c *cli) generate() {
 	}
 }
 
+// selectStacksToGenerate returns the stacks inside the paths given to the
+// generate command which match the --tags, --no-tags and --changed filters.
+// Without paths, the stacks are selected from the working dir. It returns nil
+// if no paths or filters are given, which means the whole project is
+// generated.
+func (c *cli) selectStacksToGenerate() prj.Paths {
+	paths := c.parsedArgs.Generate.Paths
+	if len(paths) == 0 && !c.parsedArgs.Changed && c.tags.IsEmpty() {
+		return nil
+	}
+
+	c.setupGit()
+
+	report, err := c.listStacks(c.newManager(), c.parsedArgs.Changed)
+	if err != nil {
+		fatal(err, "listing stacks")
+	}
+
+	var entries []terramate.Entry
+	inPaths := map[prj.Path]bool{}
+	if len(paths) > 0 {
+		entries = c.filterStacksByTags(report.Stacks)
+
+		relwd := prj.PrjAbsPath(c.rootdir(), c.wd())
+		for _, p := range paths {
+			hostpath := filepath.Join(c.wd(), filepath.FromSlash(p))
+			if path.IsAbs(p) {
+				hostpath = filepath.Join(c.rootdir(), filepath.FromSlash(p))
+			}
+			if _, err := os.Stat(hostpath); err != nil {
+				fatal(err, "selecting stacks to generate")
+			}
+		}
+		for _, st := range c.cfg().StacksByPaths(relwd, paths...) {
+			inPaths[st.Dir()] = true
+		}
+	} else {
+		entries = c.filterStacks(report.Stacks)
+	}
+
+	stacks := prj.Paths{}
+	for _, e := range entries {
+		if len(paths) > 0 && !inPaths[e.Stack.Dir] {
+			continue
+		}
+		stacks = append(stacks, e.Stack.Dir)
+	}
+	return stacks
+}
+
+// checkGenerate shows the changes code generation would do, without changing
+// any file. If stacks is not nil, only the given stacks are checked.
+func (c *cli) checkGenerate(stacks prj.Paths) {
+	logger := log.With().
+		Str("action", "checkGenerate()").
+		Logger()
+
+	logger.Trace().Msg("checking generated code")
+
+	var (
+		report  generate.Report
+		changes []generate.FileChange
+	)
+	if stacks != nil {
+		report, changes = generate.CheckStacks(c.cfg(), c.vendorDir(), stacks)
+	} else {
+		report, changes = generate.Check(c.cfg(), c.vendorDir())
+	}
+	if report.HasFailures() || report.CleanupErr != nil {
+		// the successes are just the changes that would be done.
+		report.Successes = nil
+		c.output.MsgStdErr(report.Full())
+		os.Exit(1)
+	}
+
+	for _, change := range changes {
+		if c.parsedArgs.Generate.Diff {
+			c.output.MsgStdOut("%s", strings.TrimSuffix(change.Diff(), "\n"))
+		} else {
+			c.output.MsgStdOut(strings.TrimPrefix(change.Path.String(), "/"))
+		}
+	}
+
+	if c.parsedArgs.Generate.Check && len(changes) > 0 {
+		logger.Trace().Msg("generated code is outdated")
+		os.Exit(1)
+	}
+}
+
 // gencodeWithVendor will generate code for the whole project providing automatic
-// vendoring of all tm_vendor calls.
-func (c *cli) gencodeWithVendor() (generate.Report, download.Report) {
+// vendoring of all tm_vendor calls. If stacks is not nil, code is generated
+// only for the given stacks.
+func (c *cli) gencodeWithVendor(stacks prj.Paths) (generate.Report, download.Report) {
 	vendorProgressEvents := download.NewEventStream()
 	progressHandlerDone := c.handleVendorProgressEvents(vendorProgressEvents)
 
@@ -698,7 +1082,17 @@ func (c *cli) gencodeWithVendor() (generate.Report, download.Report) {
 
 	log.Debug().Msg("generating code")
 
-	report := generate.Do(c.cfg(), c.vendorDir(), vendorRequestEvents)
+	cache := c.generateCache()
+	var report generate.Report
+	if stacks != nil {
+		report = generate.DoStacks(c.cfg(), c.vendorDir(), vendorRequestEvents, cache, stacks)
+	} else {
+		report = generate.DoWithCache(c.cfg(), c.vendorDir(), vendorRequestEvents, cache)
+	}
+
+	if err := cache.Save(); err != nil {
+		log.Warn().Err(err).Msg("failed to save the code generation cache")
+	}
 
 	log.Debug().Msg("code generation finished, waiting for vendor requests to be handled")
 
@@ -718,8 +1112,27 @@ func (c *cli) gencodeWithVendor() (generate.Report, download.Report) {
 	return report, vendorReport
 }
 
+// generateCache returns the code generation cache, which is stored in the git
+// directory. It returns nil if the project is not a git repository.
+func (c *cli) generateCache() *generate.Cache {
+	if !c.prj.isRepo {
+		return nil
+	}
+
+	gitdir, err := c.prj.git.wrapper.GitDir()
+	if err != nil {
+		fatal(err, "looking up git dir for the code generation cache")
+	}
+
+	path := filepath.Join(gitdir, generate.CacheFile)
+	if c.parsedArgs.Generate.Force {
+		return generate.NewCache(path, terramate.Version())
+	}
+	return generate.LoadCache(path, terramate.Version())
+}
+
 func (c *cli) checkGitUntracked() bool {
-	if c.parsedArgs.DisableCheckGitUntracked {
+	if c.parsedArgs.DisableCheckGitUntracked || c.parsedArgs.ChangedIncludeUncommitted {
 		return false
 	}
 
@@ -740,7 +1153,7 @@ func (c *cli) checkGitUntracked() bool {
 }
 
 func (c *cli) checkGitUncommited() bool {
-	if c.parsedArgs.DisableCheckGitUncommitted {
+	if c.parsedArgs.DisableCheckGitUncommitted || c.parsedArgs.ChangedIncludeUncommitted {
 		return false
 	}
 
@@ -815,6 +1228,17 @@ func (c *cli) gitSafeguardDefaultBranchIsReachable() {
 		Msg("Safeguard default-branch-is-reachable passed.")
 }
 
+func (c *cli) newManager() *terramate.Manager {
+	mgr := terramate.NewManager(c.cfg(), c.prj.baseRef).WithVendorDir(c.vendorDir())
+	if c.parsedArgs.ChangedIncludeUncommitted {
+		mgr.WithUncommittedChanges()
+	}
+	if !c.parsedArgs.DisableChangesCache {
+		mgr.WithChangesCache()
+	}
+	return mgr
+}
+
 func (c *cli) listStacks(mgr *terramate.Manager, isChanged bool) (*terramate.StacksReport, error) {
 	if isChanged {
 		log.Trace().
@@ -900,7 +1324,7 @@ func (c *cli) createStack() {
 		return
 	}
 
-	report, vendorReport := c.gencodeWithVendor()
+	report, vendorReport := c.gencodeWithVendor(nil)
 	if report.HasFailures() {
 		c.output.MsgStdOut("Code generation failed")
 		c.output.MsgStdOut(report.Minimal())
@@ -969,7 +1393,10 @@ func (c *cli) printStacks() {
 		log.Fatal().Msg("the --why flag must be used together with --changed")
 	}
 
-	mgr := terramate.NewManager(c.cfg(), c.prj.baseRef)
+	mgr := c.newManager()
+	if c.parsedArgs.List.Why {
+		mgr.WithReasonCommits()
+	}
 	report, err := c.listStacks(mgr, c.parsedArgs.Changed)
 	if err != nil {
 		fatal(err, "listing stacks")
@@ -977,6 +1404,11 @@ func (c *cli) printStacks() {
 
 	c.gitFileSafeguards(report.Checks, false)
 
+	if c.parsedArgs.List.JSON {
+		c.printStacksJSON(c.filterStacks(report.Stacks), c.filterStacks(report.Ignored))
+		return
+	}
+
 	for _, entry := range c.filterStacks(report.Stacks) {
 		stack := entry.Stack
 
@@ -993,25 +1425,93 @@ func (c *cli) printStacks() {
 			c.output.MsgStdOut(stackRepr)
 		}
 	}
+
+	if c.parsedArgs.List.Why {
+		c.printIgnoredStacks(c.filterStacks(report.Ignored))
+	}
+}
+
+// printIgnoredStacks prints the stacks with ignored changes, and why, on a
+// separate section of stderr, so they are not mistaken as changed stacks.
+func (c *cli) printIgnoredStacks(entries []terramate.Entry) {
+	header := false
+	for _, entry := range entries {
+		stackRepr, ok := c.friendlyFmtDir(entry.Stack.Dir.String())
+		if !ok {
+			continue
+		}
+		if !header {
+			c.output.MsgStdErr("\nStacks with ignored changes:")
+			header = true
+		}
+		c.output.MsgStdErr("%s - %s", stackRepr, entry.Reason)
+	}
+}
+
+type (
+	jsonStackList struct {
+		Stacks  []jsonStack `json:"stacks"`
+		Ignored []jsonStack `json:"ignored,omitempty"`
+	}
+
+	jsonStack struct {
+		Path   string                  `json:"path"`
+		ID     string                  `json:"id,omitempty"`
+		Name   string                  `json:"name"`
+		Reason *terramate.ChangeReason `json:"reason,omitempty"`
+	}
+)
+
+func (c *cli) printStacksJSON(entries, ignored []terramate.Entry) {
+	toJSON := func(entry terramate.Entry) jsonStack {
+		stack := jsonStack{
+			Path: entry.Stack.Dir.String(),
+			ID:   entry.Stack.ID,
+			Name: entry.Stack.Name,
+		}
+		if c.parsedArgs.List.Why {
+			reason := entry.Reason
+			stack.Reason = &reason
+		}
+		return stack
+	}
+
+	list := jsonStackList{
+		Stacks: make([]jsonStack, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		list.Stacks = append(list.Stacks, toJSON(entry))
+	}
+	if c.parsedArgs.List.Why {
+		for _, entry := range ignored {
+			list.Ignored = append(list.Ignored, toJSON(entry))
+		}
+	}
+
+	encoder := stdjson.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(list); err != nil {
+		fatal(err, "encoding stacks as JSON")
+	}
 }
 
 func (c *cli) printRunEnv() {
-	mgr := terramate.NewManager(c.cfg(), c.prj.baseRef)
+	mgr := c.newManager()
 	report, err := c.listStacks(mgr, c.parsedArgs.Changed)
 	if err != nil {
 		fatal(err, "listing stacks")
 	}
 
 	for _, stackEntry := range c.filterStacks(report.Stacks) {
-		envVars, err := run.LoadEnv(c.cfg(), stackEntry.Stack)
+		envDefs, err := run.LoadEnvDefinitions(c.cfg(), stackEntry.Stack)
 		if err != nil {
 			fatal(err, "loading stack run environment")
 		}
 
 		c.output.MsgStdOut("\nstack %q:", stackEntry.Stack.Dir)
 
-		for _, envVar := range envVars {
-			c.output.MsgStdOut("\t%s", envVar)
+		for _, def := range envDefs {
+			c.output.MsgStdOut("\t%s=%s (defined at %s)", def.Name, def.Value, def.Origin.Path())
 		}
 	}
 }
@@ -1160,7 +1660,7 @@ func (c *cli) printRunOrder() {
 		Str("workingDir", c.wd()).
 		Logger()
 
-	stacks, err := c.computeSelectedStacks(false)
+	stacks, _, err := c.computeSelectedStacks(false)
 	if err != nil {
 		fatal(err, "computing selected stacks")
 	}
@@ -1184,16 +1684,16 @@ func (c *cli) generateDebug() {
 	// TODO(KATCIPIS): When we introduce config defined on root context
 	// we need to know blocks that have root context, since they should
 	// not be filtered by stack selection.
-	stacks, err := c.computeSelectedStacks(false)
+	stacks, _, err := c.computeSelectedStacks(false)
 	if err != nil {
 		fatal(err, "generate debug: selecting stacks")
 	}
 
-	selectedStacks := map[prj.Path]struct{}{}
+	selectedStacks := map[prj.Path]*config.Stack{}
 	for _, stack := range stacks {
 		log.Debug().Msgf("selected stack: %s", stack.Dir())
 
-		selectedStacks[stack.Dir()] = struct{}{}
+		selectedStacks[stack.Dir()] = stack.Stack
 	}
 
 	results, err := generate.Load(c.cfg(), c.vendorDir())
@@ -1201,8 +1701,11 @@ func (c *cli) generateDebug() {
 		fatal(err, "generate debug: loading generated code")
 	}
 
+	cache := c.generateCache()
+
 	for _, res := range results {
-		if _, ok := selectedStacks[res.Dir]; !ok {
+		stack, ok := selectedStacks[res.Dir]
+		if !ok {
 			log.Debug().Msgf("discarding dir %s since it is not a selected stack", res.Dir)
 			continue
 		}
@@ -1213,6 +1716,10 @@ func (c *cli) generateDebug() {
 			continue
 		}
 
+		if cache.UpToDate(c.cfg(), stack, c.vendorDir()) {
+			c.output.MsgStdOut("%s cache: hit", res.Dir)
+		}
+
 		files := make([]generate.GenFile, 0, len(res.Files))
 		for _, f := range res.Files {
 			if f.Condition() {
@@ -1235,7 +1742,7 @@ func (c *cli) printStacksGlobals() {
 	logger.Trace().
 		Msg("Create new terramate manager.")
 
-	mgr := terramate.NewManager(c.cfg(), c.prj.baseRef)
+	mgr := c.newManager()
 	report, err := c.listStacks(mgr, c.parsedArgs.Changed)
 	if err != nil {
 		fatal(err, "listing stacks globals: listing stacks")
@@ -1272,7 +1779,7 @@ func (c *cli) printMetadata() {
 	logger.Trace().
 		Msg("Create new terramate manager.")
 
-	mgr := terramate.NewManager(c.cfg(), c.prj.baseRef)
+	mgr := c.newManager()
 	report, err := c.listStacks(mgr, c.parsedArgs.Changed)
 	if err != nil {
 		fatal(err, "loading metadata: listing stacks")
@@ -1315,7 +1822,8 @@ func (c *cli) printMetadata() {
 }
 
 func (c *cli) checkGenCode() bool {
-	if c.parsedArgs.Run.DisableCheckGenCode {
+	if c.parsedArgs.Run.DisableCheckGenCode ||
+		c.parsedArgs.Script.Run.DisableCheckGenCode {
 		return false
 	}
 
@@ -1325,16 +1833,24 @@ func (c *cli) checkGenCode() bool {
 		}
 	}
 
-	cfg := c.rootNode()
-	if cfg.Terramate != nil &&
-		cfg.Terramate.Config != nil &&
-		cfg.Terramate.Config.Run != nil {
-		return cfg.Terramate.Config.Run.CheckGenCode
+	if runcfg := c.runConfig(); runcfg != nil {
+		return runcfg.CheckGenCode
 	}
 
 	return true
 }
 
+// runConfig returns the terramate.config.run of the project, or nil if
+// it is not defined.
+func (c *cli) runConfig() *hcl.RunConfig {
+	cfg := c.rootNode()
+	if cfg.Terramate != nil &&
+		cfg.Terramate.Config != nil {
+		return cfg.Terramate.Config.Run
+	}
+	return nil
+}
+
 func (c *cli) eval() {
 	ctx := c.setupEvalContext(c.parsedArgs.Experimental.Eval.Global)
 	for _, exprStr := range c.parsedArgs.Experimental.Eval.Exprs {
@@ -1499,7 +2015,8 @@ func (c *cli) checkOutdatedGeneratedCode() {
 }
 
 func (c *cli) gitSafeguardRemoteEnabled() bool {
-	if c.parsedArgs.Run.DisableCheckGitRemote {
+	if c.parsedArgs.Run.DisableCheckGitRemote ||
+		c.parsedArgs.Script.Run.DisableCheckGitRemote {
 		return false
 	}
 
@@ -1527,14 +2044,107 @@ func (c *cli) runOnStacks() {
 
 	c.gitSafeguardDefaultBranchIsReachable()
 
-	if len(c.parsedArgs.Run.Command) == 0 {
+	if len(c.parsedArgs.Run.Command) == 0 && !c.parsedArgs.Run.Resume {
 		logger.Fatal().Msgf("run expects a cmd")
 	}
 
+	if c.parsedArgs.Run.Parallel < 1 {
+		logger.Fatal().Msgf("--parallel must be at least 1")
+	}
+
+	if c.parsedArgs.Run.JSON && !c.parsedArgs.Run.DryRun {
+		logger.Fatal().Msg("--json requires --dry-run")
+	}
+
 	c.checkOutdatedGeneratedCode()
 
-	var stacks config.List[*config.SortableStack]
-	if c.parsedArgs.Run.NoRecursive {
+	stateFile := c.runStateFile()
+
+	var (
+		orderedStacks config.List[*config.SortableStack]
+		reasons       selectionReasons
+		state         *run.State
+	)
+
+	cmd := c.parsedArgs.Run.Command
+	if c.parsedArgs.Run.Resume {
+		orderedStacks, state = c.loadRunStateToResume(stateFile)
+		cmd = state.Cmd
+
+		reasons = selectionReasons{}
+		for _, st := range orderedStacks {
+			reasons.add(st.Dir(), "stack did not succeed on the resumed run")
+		}
+	} else {
+		orderedStacks, reasons = c.computeOrderedStacksToRun(
+			c.parsedArgs.Run.NoRecursive,
+			c.parsedArgs.Run.Reverse,
+		)
+		if stateFile != "" && c.saveRunState() {
+			state = run.NewState(
+				stateFile,
+				cmd,
+				c.parsedArgs.Run.Reverse,
+				orderedStacks,
+			)
+		}
+	}
+
+	if c.parsedArgs.Run.DryRun {
+		logger.Trace().
+			Msg("Do a dry run - get order without actually running command.")
+
+		stackCmds := make([][][]string, len(orderedStacks))
+		for i := range orderedStacks {
+			stackCmds[i] = [][]string{cmd}
+		}
+		c.printRunPlan(
+			"The stacks will be executed using order below:",
+			orderedStacks, stackCmds, reasons, c.parsedArgs.Run.JSON,
+		)
+		return
+	}
+
+	report, err := run.Exec(
+		c.cfg(),
+		orderedStacks,
+		cmd,
+		c.stdin,
+		c.stdout,
+		c.stderr,
+		run.Options{
+			ContinueOnError: c.parsedArgs.Run.ContinueOnError,
+			Parallel:        c.parsedArgs.Run.Parallel,
+			PrefixOutput:    c.parsedArgs.Run.PrefixOutput,
+			LogDir:          c.runLogDir(),
+			State:           state,
+		}.WithRetryPolicy(
+			c.runConfig(),
+			c.parsedArgs.Run.Timeout,
+			c.parsedArgs.Run.Retries,
+			c.parsedArgs.Run.RetryDelay,
+		),
+	)
+
+	c.writeRunReport(c.parsedArgs.Run.ReportJSON, report.WriteJSON)
+	c.writeRunReport(c.parsedArgs.Run.ReportJUnit, report.WriteJUnit)
+
+	if err != nil {
+		fatal(err, "one or more commands failed")
+	}
+}
+
+func (c *cli) computeOrderedStacksToRun(noRecursive, reverse bool) (config.List[*config.SortableStack], selectionReasons) {
+	logger := log.With().
+		Str("action", "computeOrderedStacksToRun()").
+		Str("workingDir", c.wd()).
+		Logger()
+
+	var (
+		stacks  config.List[*config.SortableStack]
+		reasons selectionReasons
+	)
+	if noRecursive {
 		st, found, err := config.TryLoadStack(c.cfg(), prj.PrjAbsPath(c.rootdir(), c.wd()))
 		if err != nil {
 			fatal(err, "loading stack in current directory")
@@ -1546,9 +2156,11 @@ func (c *cli) runOnStacks() {
 		}
 
 		stacks = append(stacks, st.Sortable())
+		reasons = selectionReasons{}
+		reasons.add(st.Dir, "stack is the working directory (--no-recursive)")
 	} else {
 		var err error
-		stacks, err = c.computeSelectedStacks(true)
+		stacks, reasons, err = c.computeSelectedStacks(true)
 		if err != nil {
 			fatal(err, "computing selected stacks")
 		}
@@ -1565,43 +2177,278 @@ func (c *cli) runOnStacks() {
 		}
 	}
 
-	if c.parsedArgs.Run.Reverse {
+	if reverse {
 		logger.Trace().Msg("Reversing stacks order.")
 		config.ReverseStacks(orderedStacks)
 	}
 
-	if c.parsedArgs.Run.DryRun {
-		logger.Trace().
-			Msg("Do a dry run - get order without actually running command.")
-		if len(orderedStacks) > 0 {
-			c.output.MsgStdOut("The stacks will be executed using order below:")
+	return orderedStacks, reasons
+}
 
-			for i, s := range orderedStacks {
-				stackdir, _ := c.friendlyFmtDir(s.Dir().String())
-				c.output.MsgStdOut("\t%d. %s (%s)", i, s.Name, stackdir)
-			}
-		} else {
-			c.output.MsgStdOut("No stacks will be executed.")
+func (c *cli) listScripts() {
+	logger := log.With().
+		Str("action", "listScripts()").
+		Str("workingDir", c.wd()).
+		Logger()
+
+	wd := prj.PrjAbsPath(c.rootdir(), c.wd())
+	tree, ok := c.cfg().Lookup(wd)
+	if !ok {
+		logger.Fatal().Msg("working directory is not part of the project")
+	}
+
+	logger.Trace().Msg("listing scripts available on working dir and child dirs")
+
+	scripts := run.Scripts(c.cfg(), wd)
+	for _, node := range tree.AsList() {
+		if node.Dir() == wd {
+			continue
+		}
+		scripts = append(scripts, node.Node.Scripts...)
+	}
+
+	sort.Slice(scripts, func(i, j int) bool {
+		if scripts[i].Name != scripts[j].Name {
+			return scripts[i].Name < scripts[j].Name
+		}
+		return scripts[i].Range.Path().Dir().String() < scripts[j].Range.Path().Dir().String()
+	})
+
+	for _, script := range scripts {
+		definedAt, ok := c.friendlyFmtDir(script.Range.Path().Dir().String())
+		if !ok {
+			definedAt = script.Range.Path().Dir().String()
+		}
+		if script.Description == "" {
+			c.output.MsgStdOut("%s (defined at %s)", script.Name, definedAt)
+			continue
+		}
+		c.output.MsgStdOut("%s: %s (defined at %s)",
+			script.Name, script.Description, definedAt)
+	}
+}
+
+func (c *cli) runScript() {
+	name := c.parsedArgs.Script.Run.Name
+
+	logger := log.With().
+		Str("action", "runScript()").
+		Str("workingDir", c.wd()).
+		Str("script", name).
+		Logger()
+
+	c.gitSafeguardDefaultBranchIsReachable()
+
+	if c.parsedArgs.Script.Run.Parallel < 1 {
+		logger.Fatal().Msgf("--parallel must be at least 1")
+	}
+
+	if c.parsedArgs.Script.Run.JSON && !c.parsedArgs.Script.Run.DryRun {
+		logger.Fatal().Msg("--json requires --dry-run")
+	}
+
+	c.checkOutdatedGeneratedCode()
+
+	selectedStacks, reasons := c.computeOrderedStacksToRun(
+		c.parsedArgs.Script.Run.NoRecursive,
+		c.parsedArgs.Script.Run.Reverse,
+	)
+
+	var orderedStacks config.List[*config.SortableStack]
+	for _, st := range selectedStacks {
+		if _, ok := run.LookupScript(c.cfg(), st.Dir(), name); !ok {
+			logger.Debug().
+				Stringer("stack", st.Dir()).
+				Msg("script not available on stack, ignoring")
+			continue
 		}
+		orderedStacks = append(orderedStacks, st)
+	}
 
+	if len(selectedStacks) > 0 && len(orderedStacks) == 0 {
+		logger.Fatal().Msgf("script %q not found on any of the selected stacks", name)
+	}
+
+	if c.parsedArgs.Script.Run.DryRun {
+		stackCmds := make([][][]string, len(orderedStacks))
+		for i, s := range orderedStacks {
+			cmds, err := run.LoadScriptCmds(c.cfg(), s.Stack, name)
+			if err != nil {
+				fatal(err, "loading script commands")
+			}
+			stackCmds[i] = cmds
+		}
+		c.printRunPlan(
+			stdfmt.Sprintf("The script %q will be executed using order below:", name),
+			orderedStacks, stackCmds, reasons, c.parsedArgs.Script.Run.JSON,
+		)
 		return
 	}
 
-	err = run.Exec(
+	_, err := run.ExecScript(
 		c.cfg(),
 		orderedStacks,
-		c.parsedArgs.Run.Command,
+		name,
 		c.stdin,
 		c.stdout,
 		c.stderr,
-		c.parsedArgs.Run.ContinueOnError,
+		run.Options{
+			ContinueOnError: c.parsedArgs.Script.Run.ContinueOnError,
+			Parallel:        c.parsedArgs.Script.Run.Parallel,
+			PrefixOutput:    c.parsedArgs.Script.Run.PrefixOutput,
+		}.WithRetryPolicy(
+			c.runConfig(),
+			c.parsedArgs.Script.Run.Timeout,
+			c.parsedArgs.Script.Run.Retries,
+			c.parsedArgs.Script.Run.RetryDelay,
+		),
 	)
-
 	if err != nil {
 		fatal(err, "one or more commands failed")
 	}
 }
 
+// printRunPlan prints the execution plan of a dry run, as text or JSON.
+func (c *cli) printRunPlan(
+	header string,
+	stacks config.List[*config.SortableStack],
+	stackCmds [][][]string,
+	reasons selectionReasons,
+	asJSON bool,
+) {
+	plan, err := run.NewPlan(c.cfg(), stacks, stackCmds, reasons)
+	if err != nil {
+		fatal(err, "planning execution")
+	}
+
+	if asJSON {
+		if err := plan.WriteJSON(c.stdout); err != nil {
+			fatal(err, "writing execution plan")
+		}
+		return
+	}
+
+	if len(plan.Stacks) == 0 {
+		c.output.MsgStdOut("No stacks will be executed.")
+		return
+	}
+
+	c.output.MsgStdOut(header)
+
+	for i, planned := range plan.Stacks {
+		stackdir, _ := c.friendlyFmtDir(planned.Stack.Dir.String())
+		c.output.MsgStdOut("\t%d. %s (%s)", i, planned.Stack.Name, stackdir)
+
+		for _, reason := range planned.Reasons {
+			c.output.MsgStdOut("\t\treason: %s", reason)
+		}
+		c.output.MsgStdOut("\t\tdir: %s", planned.Dir)
+		for _, cmd := range planned.Cmds {
+			c.output.MsgStdOut("\t\tcmd: %s", strings.Join(cmd, " "))
+		}
+		for _, def := range planned.Env {
+			c.output.MsgStdOut("\t\tenv: %s=%s (defined at %s)",
+				def.Name, def.Value, def.Origin.Path())
+		}
+	}
+}
+
+func (c *cli) loadRunStateToResume(stateFile string) (config.List[*config.SortableStack], *run.State) {
+	logger := log.With().
+		Str("action", "loadRunStateToResume()").
+		Str("stateFile", stateFile).
+		Logger()
+
+	if stateFile == "" {
+		logger.Fatal().Msg("--resume requires --state-file when the project is not a git repository")
+	}
+
+	logger.Trace().Msg("loading run state")
+
+	state, err := run.LoadState(stateFile)
+	if err != nil {
+		errlog.Fatal(logger, err, "loading run state to resume")
+	}
+
+	cmd := c.parsedArgs.Run.Command
+	if len(cmd) > 0 && strings.Join(cmd, " ") != strings.Join(state.Cmd, " ") {
+		logger.Fatal().
+			Str("savedCmd", strings.Join(state.Cmd, " ")).
+			Msg("command differs from the command of the run being resumed")
+	}
+
+	stacks, err := state.ResumeStacks(c.cfg())
+	if err != nil {
+		errlog.Fatal(logger, err, "unable to resume run")
+	}
+
+	if len(stacks) == 0 {
+		logger.Info().Msg("all stacks of the resumed run already succeeded")
+	}
+	return stacks, state
+}
+
+// runStateFile returns the file where the run state is saved, or an empty
+// string if the run state must not be saved.
+func (c *cli) runStateFile() string {
+	if c.parsedArgs.Run.StateFile != "" {
+		if filepath.IsAbs(c.parsedArgs.Run.StateFile) {
+			return c.parsedArgs.Run.StateFile
+		}
+		return filepath.Join(c.wd(), c.parsedArgs.Run.StateFile)
+	}
+
+	if !c.prj.isRepo {
+		return ""
+	}
+
+	gitdir, err := c.prj.git.wrapper.GitDir()
+	if err != nil {
+		fatal(err, "looking up git dir to save run state")
+	}
+	return filepath.Join(gitdir, "terramate", defaultRunStateFilename)
+}
+
+// saveRunState tells if the state of a new run must be saved. The state is
+// only saved when asked for, while resumed runs always update their state.
+func (c *cli) saveRunState() bool {
+	return c.parsedArgs.Run.SaveState || c.parsedArgs.Run.StateFile != ""
+}
+
+func (c *cli) writeRunReport(fname string, write func(io.Writer) error) {
+	if fname == "" {
+		return
+	}
+
+	logger := log.With().
+		Str("action", "cli.writeRunReport()").
+		Str("file", fname).
+		Logger()
+
+	logger.Trace().Msg("writing run report")
+
+	f, err := os.Create(fname)
+	if err != nil {
+		errlog.Fatal(logger, err, "creating run report file")
+	}
+
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		errlog.Fatal(logger, err, "writing run report")
+	}
+}
+
+func (c *cli) runLogDir() string {
+	logdir := c.parsedArgs.Run.LogDir
+	if logdir == "" || filepath.IsAbs(logdir) {
+		return logdir
+	}
+	return filepath.Join(c.wd(), logdir)
+}
+
 func (c *cli) wd() string           { return c.prj.wd }
 func (c *cli) rootdir() string      { return c.prj.rootdir }
 func (c *cli) cfg() *config.Root    { return &c.prj.root }
@@ -1611,7 +2458,15 @@ func (c *cli) friendlyFmtDir(dir string) (string, bool) {
 	return prj.FriendlyFmtDir(c.rootdir(), c.wd(), dir)
 }
 
-func (c *cli) computeSelectedStacks(ensureCleanRepo bool) (config.List[*config.SortableStack], error) {
+// selectionReasons maps the path of the selected stacks to the reasons they
+// were selected.
+type selectionReasons map[prj.Path][]string
+
+func (r selectionReasons) add(dir prj.Path, reason string) {
+	r[dir] = append(r[dir], reason)
+}
+
+func (c *cli) computeSelectedStacks(ensureCleanRepo bool) (config.List[*config.SortableStack], selectionReasons, error) {
 	logger := log.With().
 		Str("action", "computeSelectedStacks()").
 		Str("workingDir", c.wd()).
@@ -1619,30 +2474,48 @@ func (c *cli) computeSelectedStacks(ensureCleanRepo bool) (config.List[*config.S
 
 	logger.Trace().Msg("Create new terramate manager.")
 
-	mgr := terramate.NewManager(c.cfg(), c.prj.baseRef)
+	mgr := c.newManager()
 
 	logger.Trace().Msg("Get list of stacks.")
 
 	report, err := c.listStacks(mgr, c.parsedArgs.Changed)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	c.gitFileSafeguards(report.Checks, ensureCleanRepo)
 
 	logger.Trace().Msg("Filter stacks by working directory.")
 
+	reasons := selectionReasons{}
 	entries := c.filterStacks(report.Stacks)
 	stacks := make(config.List[*config.SortableStack], len(entries))
 	for i, e := range entries {
 		stacks[i] = e.Stack.Sortable()
+
+		reasons.add(e.Stack.Dir, "stack is inside the working directory")
+		if e.Reason.Kind != "" {
+			reasons.add(e.Stack.Dir, e.Reason.String())
+		}
+		if !c.tags.IsEmpty() {
+			reasons.add(e.Stack.Dir, "stack matches the tags filter")
+		}
 	}
 
-	stacks, err = mgr.AddWantedOf(stacks)
+	wanted, err := mgr.AddWantedOf(stacks)
 	if err != nil {
-		return nil, errors.E(err, "adding wanted stacks")
+		return nil, nil, errors.E(err, "adding wanted stacks")
+	}
+
+	stacks = make(config.List[*config.SortableStack], len(wanted))
+	for i, e := range wanted {
+		stacks[i] = e.Stack.Sortable()
+
+		if e.Reason.Kind == terramate.WantedByChange {
+			reasons.add(e.Stack.Dir, e.Reason.String())
+		}
 	}
-	return stacks, nil
+	return stacks, reasons, nil
 }
 
 func (c *cli) filterStacks(stacks []terramate.Entry) []terramate.Entry {
@@ -23,6 +23,9 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -35,10 +38,16 @@ func main() {
 		hang()
 	case "env":
 		env()
+	case "echo":
+		echo(os.Args[2:])
 	case "cat":
 		cat(os.Args[2])
 	case "stack-abs-path":
 		stackAbsPath(os.Args[2])
+	case "sleep":
+		sleep(os.Args[2])
+	case "flaky":
+		flaky(os.Args[2], os.Args[3])
 	default:
 		log.Fatalf("unknown command %s", os.Args[1])
 	}
@@ -66,6 +75,11 @@ func env() {
 	}
 }
 
+// echo the args to stdout, separated by spaces.
+func echo(args []string) {
+	fmt.Println(strings.Join(args, " "))
+}
+
 // cat the file contents to stdout.
 func cat(fname string) {
 	bytes, err := os.ReadFile(fname)
@@ -86,3 +100,41 @@ func stackAbsPath(base string) {
 	}
 	fmt.Println("/" + filepath.ToSlash(rel))
 }
+
+// sleep for the given duration. Unlike hang, it exits on interruption.
+func sleep(duration string) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("ready")
+	time.Sleep(d)
+}
+
+// flaky fails the given number of times, printing the attempt number.
+// The attempts are counted using the given file.
+func flaky(fname string, failures string) {
+	n, err := strconv.Atoi(failures)
+	if err != nil {
+		panic(err)
+	}
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := f.WriteString("attempt\n"); err != nil {
+		panic(err)
+	}
+	if err := f.Close(); err != nil {
+		panic(err)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		panic(err)
+	}
+	attempt := strings.Count(string(data), "\n")
+	fmt.Printf("attempt %d\n", attempt)
+	if attempt <= n {
+		os.Exit(1)
+	}
+}
@@ -16,7 +16,9 @@ package e2etest
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/madlambda/spells/assert"
@@ -268,3 +270,317 @@ func TestRunWontDetectAsChangeDeletedTrigger(t *testing.T) {
 		testfile,
 	), runExpected{Stdout: ""})
 }
+
+func TestTriggerListShowAndClear(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack-a",
+		"s:stack-b",
+	})
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"experimental", "trigger", "create", "/stack-a", "--reason", "reason a",
+	), runExpected{IgnoreStdout: true})
+	assertRunResult(t, cli.run(
+		"experimental", "trigger", "/stack-b", "--reason", "reason b",
+	), runExpected{IgnoreStdout: true})
+
+	files, err := trigger.List(s.RootDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 2, len(files))
+
+	triggerRegex := func(file trigger.File) string {
+		return regexp.QuoteMeta(file.Path.String()) + `\n` +
+			`\tstack: ` + regexp.QuoteMeta(file.Stack.String()) + `\n` +
+			`\ttype: changed\n` +
+			`\tcreated: \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z\n` +
+			`\treason: ` + regexp.QuoteMeta(file.Info.Reason) + `\n`
+	}
+
+	assertRunResult(t, cli.run("experimental", "trigger", "list"), runExpected{
+		StdoutRegex: "^" + triggerRegex(files[0]) + triggerRegex(files[1]) + "$",
+	})
+
+	assertRunResult(t, cli.run("experimental", "trigger", "show", files[1].Path.String()), runExpected{
+		StdoutRegex: "^" + triggerRegex(files[1]) + "$",
+	})
+
+	assertRunResult(t, cli.run("experimental", "trigger", "clear"), runExpected{
+		Status:      1,
+		StderrRegex: "a stack path, --all or --expired must be given",
+	})
+
+	assertRunResult(t, cli.run("experimental", "trigger", "clear", "stack-a"), runExpected{
+		Stdout: fmt.Sprintf("Removed trigger %s\n", files[0].Path),
+	})
+
+	assertRunResult(t, cli.run("experimental", "trigger", "list"), runExpected{
+		StdoutRegex: "^" + triggerRegex(files[1]) + "$",
+	})
+
+	assertRunResult(t, cli.run("experimental", "trigger", "clear", "--all"), runExpected{
+		Stdout: fmt.Sprintf("Removed trigger %s\n", files[1].Path),
+	})
+
+	assertRunResult(t, cli.run("experimental", "trigger", "list"), runExpected{})
+	test.AssertDiff(t, test.ReadDir(t, trigger.Dir(s.RootDir())), []os.DirEntry{})
+}
+
+func TestTriggerExpired(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:expired",
+		"s:valid",
+	})
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("trigger-the-stacks")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"experimental", "trigger", "/expired", "--expires", "2000-01-01T00:00:00Z",
+	), runExpected{IgnoreStdout: true})
+	assertRunResult(t, cli.run(
+		"experimental", "trigger", "/valid", "--expires", "24h",
+	), runExpected{IgnoreStdout: true})
+	assertRunResult(t, cli.run(
+		"experimental", "trigger", "/valid", "--expires", "tomorrow",
+	), runExpected{
+		Status:      1,
+		StderrRegex: "invalid --expires",
+	})
+
+	git.CommitAll("commit the trigger files")
+
+	assertRunResult(t, cli.listChangedStacks(), runExpected{Stdout: "valid\n"})
+
+	assertRunResult(t, cli.run("experimental", "trigger", "list"), runExpected{
+		StdoutRegex: `expires: 2000-01-01T00:00:00Z \(expired\)`,
+	})
+
+	files, err := trigger.List(s.RootDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 2, len(files))
+
+	assertRunResult(t, cli.run("experimental", "trigger", "clear", "--expired"), runExpected{
+		Stdout: fmt.Sprintf("Removed trigger %s\n", files[0].Path),
+	})
+
+	files, err = trigger.List(s.RootDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 1, len(files))
+	assert.EqualStrings(t, "/valid", files[0].Stack.String())
+}
+
+func TestTriggerMultipleStacks(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name string
+		wd   string
+		args []string
+		want runExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "by tags",
+			args: []string{"--tags", "provider", "experimental", "trigger", "--reason", "bump"},
+			want: runExpected{
+				Stdout: listStacks(
+					`Created trigger for stack "/prod/app"`,
+					`Created trigger for stack "/staging/app"`,
+				),
+			},
+		},
+		{
+			name: "by no-tags",
+			args: []string{"--no-tags", "provider", "experimental", "trigger"},
+			want: runExpected{
+				Stdout: listStacks(
+					`Created trigger for stack "/prod/db"`,
+					`Created trigger for stack "/staging/db"`,
+				),
+			},
+		},
+		{
+			name: "by tags inside working dir",
+			wd:   "prod",
+			args: []string{"--tags", "provider", "experimental", "trigger"},
+			want: runExpected{
+				Stdout: listStacks(
+					`Created trigger for stack "/prod/app"`,
+				),
+			},
+		},
+		{
+			name: "by absolute glob",
+			args: []string{"experimental", "trigger", "/*/db"},
+			want: runExpected{
+				Stdout: listStacks(
+					`Created trigger for stack "/prod/db"`,
+					`Created trigger for stack "/staging/db"`,
+				),
+			},
+		},
+		{
+			name: "by relative glob",
+			wd:   "staging",
+			args: []string{"experimental", "trigger", "*"},
+			want: runExpected{
+				Stdout: listStacks(
+					`Created trigger for stack "/staging/app"`,
+					`Created trigger for stack "/staging/db"`,
+				),
+			},
+		},
+		{
+			name: "by glob and tags",
+			args: []string{"--tags", "provider", "experimental", "trigger", "/prod/**"},
+			want: runExpected{
+				Stdout: listStacks(
+					`Created trigger for stack "/prod/app"`,
+				),
+			},
+		},
+		{
+			name: "nothing selected",
+			args: []string{"experimental", "trigger", "/dev/*"},
+			want: runExpected{},
+		},
+		{
+			name: "no stack and no filter",
+			args: []string{"experimental", "trigger"},
+			want: runExpected{
+				Status:      1,
+				StderrRegex: "a stack path, a glob pattern, --tags, --no-tags or --changed must be given",
+			},
+		},
+		{
+			name: "stack path with filters",
+			args: []string{"--tags", "provider", "experimental", "trigger", "/prod/app"},
+			want: runExpected{
+				Status:      1,
+				StderrRegex: "a stack path can't be used with --tags",
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.New(t)
+			s.BuildTree([]string{
+				`s:prod/app:tags=["provider"]`,
+				`s:prod/db`,
+				`s:staging/app:tags=["provider"]`,
+				`s:staging/db`,
+			})
+
+			cli := newCLI(t, filepath.Join(s.RootDir(), tc.wd))
+			assertRunResult(t, cli.run(tc.args...), tc.want)
+		})
+	}
+}
+
+func TestTriggerChangedStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:changed",
+		"s:unchanged",
+	})
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("change-stack")
+
+	s.RootEntry().CreateFile("changed/main.tf", "# changed")
+	git.CommitAll("change stack")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("--changed", "experimental", "trigger", "--reason", "redeploy"), runExpected{
+		Stdout: listStacks(`Created trigger for stack "/changed"`),
+	})
+
+	files, err := trigger.List(s.RootDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 1, len(files))
+	assert.EqualStrings(t, "/changed", files[0].Stack.String())
+	assert.EqualStrings(t, "redeploy", files[0].Info.Reason)
+}
+
+func TestIgnoreChangeTrigger(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack-a",
+		"s:stack-b",
+		"f:stack-a/main.tf:# a",
+		"f:stack-b/main.tf:# b",
+	})
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("format-code")
+
+	cli := newCLI(t, s.RootDir())
+
+	s.RootEntry().CreateFile("stack-a/main.tf", "# a formatted")
+	s.RootEntry().CreateFile("stack-b/main.tf", "# b changed")
+	assertRunResult(t, cli.run(
+		"experimental", "trigger", "/stack-a", "--type", "ignore-change", "--reason", "formatting only",
+	), runExpected{IgnoreStdout: true})
+	git.CommitAll("format stack-a and change stack-b")
+
+	assertRunResult(t, cli.listChangedStacks(), runExpected{Stdout: "stack-b\n"})
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: "stack-b - stack has unmerged changes\n",
+		StderrRegex: `(?m)^Stacks with ignored changes:\n` +
+			`stack-a - stack changes are ignored because of trigger ` +
+			`"/\.tmtriggers/stack-a/ignore-change-[a-f0-9-]+\.tm\.hcl": formatting only$`,
+	})
+
+	assertRunResult(t, cli.run("run", "--changed", testHelperBin, "stack-abs-path", s.RootDir()), runExpected{
+		Stdout: "/stack-b\n",
+	})
+
+	// the trigger only ignores the changes of the commit range where it was
+	// added.
+	git.Checkout("main")
+	git.Merge("format-code")
+	git.Push("main")
+	git.CheckoutNew("change-stack-a")
+
+	s.RootEntry().CreateFile("stack-a/main.tf", "# a changed")
+	git.CommitAll("change stack-a")
+
+	assertRunResult(t, cli.listChangedStacks(), runExpected{Stdout: "stack-a\n"})
+}
+
+func TestTriggerInvalidType(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+	})
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("experimental", "trigger", "/stack", "--type", "unknown"), runExpected{
+		Status:      1,
+		StderrRegex: "--type must be one of",
+	})
+}
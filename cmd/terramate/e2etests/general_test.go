@@ -443,6 +443,34 @@ func TestE2ETerramateLogsWarningIfRootConfigIsNotAtProjectRoot(t *testing.T) {
 	})
 }
 
+func TestE2ETerramateNoWarningForRunEnvOnlyConfig(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stacks/stack",
+		`f:stacks/env.tm.hcl:terramate {
+  config {
+    run {
+      env {
+        FOO = "bar"
+      }
+    }
+  }
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	tmcli := newCLI(t, filepath.Join(s.RootDir(), "stacks"))
+	tmcli.loglevel = "warn"
+	assertRunResult(t, tmcli.listStacks(), runExpected{
+		Stdout: "stack\n",
+	})
+}
+
 func TestBug515(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,95 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/generate"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestGenerateUsesCache(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack-1",
+		"s:stack-2",
+		`f:generate.tm:generate_file "name.txt" {
+  content = terramate.stack.name
+}
+`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+	cachefile := filepath.Join(s.RootDir(), ".git", generate.CacheFile)
+
+	assertRunResult(t, cli.run("generate"), runExpected{
+		Stdout: generate.Report{
+			Successes: []generate.Result{
+				{
+					Dir:     project.NewPath("/stack-1"),
+					Created: []string{"name.txt"},
+				},
+				{
+					Dir:     project.NewPath("/stack-2"),
+					Created: []string{"name.txt"},
+				},
+			},
+		}.Full() + "\n",
+	})
+
+	_, err := os.Stat(cachefile)
+	assert.NoError(t, err, "cache file must be created")
+
+	const skipped = "skipping stack"
+
+	res := cli.run("generate", "--log-level", "debug")
+	assert.EqualInts(t, 0, res.Status, "unexpected status: %s", res.Stderr)
+	assert.IsTrue(t, strings.Count(res.Stderr, skipped) == 2, "stacks must be skipped: %s", res.Stderr)
+
+	res = cli.run("generate", "--force", "--log-level", "debug")
+	assert.EqualInts(t, 0, res.Status, "unexpected status: %s", res.Stderr)
+	assert.IsTrue(t, !strings.Contains(res.Stderr, skipped), "stacks must not be skipped: %s", res.Stderr)
+
+	s.RootEntry().CreateFile("stack-2/stack.tm.hcl", `stack {
+  name = "changed"
+}
+`)
+
+	assertRunResult(t, cli.run("experimental", "generate", "debug"), runExpected{
+		Stdout: `/stack-1 cache: hit
+/stack-1/name.txt origin: /generate.tm:1,1-3,2
+/stack-2/name.txt origin: /generate.tm:1,1-3,2
+`,
+	})
+
+	assertRunResult(t, cli.run("generate"), runExpected{
+		Stdout: generate.Report{
+			Successes: []generate.Result{
+				{
+					Dir:     project.NewPath("/stack-2"),
+					Changed: []string{"name.txt"},
+				},
+			},
+		}.Full() + "\n",
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/test/sandbox"
+
+	. "github.com/mineiros-io/terramate/test/hclwrite/hclutils"
+)
+
+func TestGenerateCheckAndDiff(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		"f:stack/orphan.txt:// TERRAMATE: GENERATED AUTOMATICALLY DO NOT EDIT\n\norphan\n",
+	})
+
+	s.RootEntry().CreateFile(config.DefaultFilename, Doc(
+		GenerateFile(
+			Labels("name.txt"),
+			Expr("content", "terramate.stack.name"),
+		),
+	).String())
+
+	cli := newCLI(t, s.RootDir())
+
+	assertRunResult(t, cli.run("generate", "--check"), runExpected{
+		Stdout: "stack/name.txt\nstack/orphan.txt\n",
+		Status: 1,
+	})
+
+	assertRunResult(t, cli.run("generate", "--diff"), runExpected{
+		Stdout: `--- /dev/null
++++ b/stack/name.txt
+@@ -0,0 +1 @@
++stack
+--- a/stack/orphan.txt
++++ /dev/null
+@@ -1,3 +0,0 @@
+-// TERRAMATE: GENERATED AUTOMATICALLY DO NOT EDIT
+-
+-orphan
+`,
+	})
+
+	// no file was changed.
+	assertRunResult(t, cli.run("generate", "--check"), runExpected{
+		Stdout: "stack/name.txt\nstack/orphan.txt\n",
+		Status: 1,
+	})
+
+	s.Generate()
+
+	assertRunResult(t, cli.run("generate", "--check"), runExpected{})
+	assertRunResult(t, cli.run("generate", "--diff"), runExpected{})
+
+	s.RootEntry().CreateFile(config.DefaultFilename, Doc(
+		GenerateHCL(
+			Labels("name.hcl"),
+			Content(
+				Expr("name", "terramate.stack.name"),
+			),
+		),
+	).String())
+
+	assertRunResult(t, cli.run("generate", "--check", "--diff"), runExpected{
+		Stdout: `--- /dev/null
++++ b/stack/name.hcl
+@@ -0,0 +1,3 @@
++// TERRAMATE: GENERATED AUTOMATICALLY DO NOT EDIT
++
++name = "stack"
+`,
+		Status: 1,
+	})
+}
+
+func TestGenerateCheckFailures(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		"f:stack/name.hcl:manual code",
+	})
+
+	s.RootEntry().CreateFile(config.DefaultFilename, Doc(
+		GenerateHCL(
+			Labels("name.hcl"),
+			Content(
+				Expr("name", "terramate.stack.name"),
+			),
+		),
+	).String())
+
+	cli := newCLI(t, s.RootDir())
+
+	assertRunResult(t, cli.run("generate", "--check"), runExpected{
+		StderrRegex: "manually defined code found",
+		Status:      1,
+	})
+	assertRunResult(t, cli.run("generate", "--diff"), runExpected{
+		StderrRegex: "manually defined code found",
+		Status:      1,
+	})
+}
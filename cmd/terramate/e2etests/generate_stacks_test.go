@@ -0,0 +1,181 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mineiros-io/terramate/generate"
+	"github.com/mineiros-io/terramate/generate/genhcl"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+const generateNameConfig = `f:generate.tm:generate_file "name.txt" {
+  content = terramate.stack.name
+}
+`
+
+func TestGenerateSelectedStacks(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name string
+		wd   string
+		args []string
+		want runExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "by path",
+			args: []string{"generate", "prod"},
+			want: runExpected{
+				Stdout: generatedNames("/prod/app", "/prod/db"),
+			},
+		},
+		{
+			name: "by multiple paths",
+			args: []string{"generate", "prod/app", "/staging/db"},
+			want: runExpected{
+				Stdout: generatedNames("/prod/app", "/staging/db"),
+			},
+		},
+		{
+			name: "by relative path",
+			wd:   "staging",
+			args: []string{"generate", "app"},
+			want: runExpected{
+				Stdout: generatedNames("/staging/app"),
+			},
+		},
+		{
+			name: "by path outside working dir",
+			wd:   "staging",
+			args: []string{"generate", "/prod/db"},
+			want: runExpected{
+				Stdout: generatedNames("/prod/db"),
+			},
+		},
+		{
+			name: "by tags",
+			args: []string{"--tags", "provider", "generate"},
+			want: runExpected{
+				Stdout: generatedNames("/prod/app", "/staging/app"),
+			},
+		},
+		{
+			name: "by no-tags",
+			args: []string{"--no-tags", "provider", "generate"},
+			want: runExpected{
+				Stdout: generatedNames("/prod/db", "/staging/db"),
+			},
+		},
+		{
+			name: "by tags inside working dir",
+			wd:   "prod",
+			args: []string{"--tags", "provider", "generate"},
+			want: runExpected{
+				Stdout: generatedNames("/prod/app"),
+			},
+		},
+		{
+			name: "by path and tags",
+			args: []string{"--tags", "provider", "generate", "staging"},
+			want: runExpected{
+				Stdout: generatedNames("/staging/app"),
+			},
+		},
+		{
+			name: "nothing selected",
+			args: []string{"--tags", "unknown", "generate"},
+			want: runExpected{
+				Stdout: generate.Report{}.Full() + "\n",
+			},
+		},
+		{
+			name: "non-existent path",
+			args: []string{"generate", "dev"},
+			want: runExpected{
+				Status:      1,
+				StderrRegex: "selecting stacks to generate",
+			},
+		},
+		{
+			name: "check selected stacks",
+			args: []string{"generate", "--check", "prod/db"},
+			want: runExpected{
+				Stdout: "prod/db/name.txt\n",
+				Status: 1,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.New(t)
+			s.BuildTree([]string{
+				`s:prod/app:tags=["provider"]`,
+				`s:prod/db`,
+				`s:staging/app:tags=["provider"]`,
+				`s:staging/db`,
+				generateNameConfig,
+				"f:orphan/file.hcl:" + genhcl.Header,
+			})
+
+			cli := newCLI(t, filepath.Join(s.RootDir(), tc.wd))
+			assertRunResult(t, cli.run(tc.args...), tc.want)
+		})
+	}
+}
+
+func TestGenerateChangedStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:changed",
+		"s:unchanged",
+		generateNameConfig,
+	})
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("change-stack")
+
+	s.RootEntry().CreateFile("changed/main.tf", "# changed")
+	git.CommitAll("change stack")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("--changed", "generate"), runExpected{
+		Stdout: generatedNames("/changed"),
+	})
+}
+
+// generatedNames returns the report of the generation of the name.txt file
+// on the given stacks.
+func generatedNames(stacks ...string) string {
+	report := generate.Report{}
+	for _, stack := range stacks {
+		report.Successes = append(report.Successes, generate.Result{
+			Dir:     project.NewPath(stack),
+			Created: []string{"name.txt"},
+		})
+	}
+	return report.Full() + "\n"
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestListChangedUsesChangesCache(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:modules/net/main.tf:# net`,
+		`f:stack-a/main.tf:module "net" {
+  source = "../modules/net"
+}
+`,
+		`f:stack-b/main.tf:# b`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-module")
+
+	cachefile := filepath.Join(s.RootDir(), ".git", terramate.ChangesCacheFile)
+
+	s.RootEntry().CreateFile("modules/net/main.tf", "# changed")
+	git.CommitAll("change module")
+
+	want := runExpected{
+		Stdout: listStacks(
+			`stack-a - stack changed because module "../modules/net" has unmerged changes`,
+		),
+	}
+
+	assertRunResult(t, cli.run("list", "--changed", "--why", "--disable-changes-cache"), want)
+
+	_, err := os.Stat(cachefile)
+	assert.IsTrue(t, errors.Is(err, os.ErrNotExist), "cache file must not be created")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), want)
+
+	_, err = os.Stat(cachefile)
+	assert.NoError(t, err, "cache file must be created")
+
+	// the cache is reused by the next runs.
+	assertRunResult(t, cli.run("list", "--changed", "--why"), want)
+
+	// and the files changed since the cache was saved are parsed again.
+	s.RootEntry().CreateFile("stack-b/main.tf", `module "net" {
+  source = "../modules/net"
+}
+`)
+	git.CommitAll("stack-b calls the module")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack-a - stack changed because module "../modules/net" has unmerged changes`,
+			`stack-b - stack has unmerged changes`,
+		),
+	})
+}
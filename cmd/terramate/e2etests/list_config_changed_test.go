@@ -0,0 +1,119 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestListChangedInheritedConfig(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/stack-1`,
+		`s:stacks/stack-1/child`,
+		`s:stacks/stack-2`,
+		`s:other`,
+		`f:stacks/globals.tm:globals {
+  a = 1
+}
+`,
+		`f:stacks/stack-1/globals.tm:globals {
+  b = 1
+}
+`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-globals")
+
+	s.RootEntry().CreateFile("stacks/globals.tm", `globals {
+  a = 2
+}
+`)
+	git.CommitAll("change globals")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stacks/stack-1 - stack configuration changed because inherited file "/stacks/globals.tm" changed`,
+			`stacks/stack-1/child - stack configuration changed because inherited file "/stacks/globals.tm" changed`,
+			`stacks/stack-2 - stack configuration changed because inherited file "/stacks/globals.tm" changed`,
+		),
+	})
+
+	git.Checkout("main")
+	git.CheckoutNew("change-parent-stack")
+
+	s.RootEntry().CreateFile("stacks/stack-1/globals.tm", `globals {
+  b = 2
+}
+`)
+	git.CommitAll("change parent stack globals")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stacks/stack-1 - stack has unmerged changes`,
+			`stacks/stack-1/child - stack configuration changed because inherited file "/stacks/stack-1/globals.tm" changed`,
+		),
+	})
+}
+
+func TestListChangedImportedConfig(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`s:stack-2`,
+		`f:stack-1/import.tm:import {
+  source = "/imports/globals.tm"
+}
+`,
+		`f:imports/globals.tm:import {
+  source = "/shared/globals.tm"
+}
+`,
+		`f:shared/globals.tm:globals {
+  a = 1
+}
+`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-imported")
+
+	s.RootEntry().CreateFile("shared/globals.tm", `globals {
+  a = 2
+}
+`)
+	git.CommitAll("change imported globals")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack-1 - stack configuration changed because imported file "/shared/globals.tm" changed`,
+		),
+	})
+}
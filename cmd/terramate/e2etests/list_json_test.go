@@ -0,0 +1,154 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+type (
+	jsonListReason struct {
+		Kind        string   `json:"kind"`
+		Description string   `json:"description"`
+		File        string   `json:"file"`
+		Pattern     string   `json:"pattern"`
+		Modules     []string `json:"modules"`
+		Commit      string   `json:"commit"`
+	}
+
+	jsonListStack struct {
+		Path   string          `json:"path"`
+		ID     string          `json:"id"`
+		Name   string          `json:"name"`
+		Reason *jsonListReason `json:"reason"`
+	}
+
+	jsonList struct {
+		Stacks []jsonListStack `json:"stacks"`
+	}
+)
+
+func TestListJSON(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a:id=stack-a`,
+		`s:stack-b`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	res := cli.run("list", "--json")
+	assertRunResult(t, res, runExpected{IgnoreStdout: true})
+
+	var got jsonList
+	assert.NoError(t, json.Unmarshal([]byte(res.Stdout), &got))
+	test.AssertDiff(t, got, jsonList{
+		Stacks: []jsonListStack{
+			{
+				Path: "/stack-a",
+				ID:   "stack-a",
+				Name: "stack-a",
+			},
+			{
+				Path: "/stack-b",
+				Name: "stack-b",
+			},
+		},
+	})
+}
+
+func TestListChangedWhyJSON(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/file`,
+		`s:stacks/module`,
+		`s:stacks/watch:watch=["/charts/"]`,
+		`s:stacks/unchanged`,
+		`f:stacks/module/main.tf:module "net" {
+  source = "../../modules/net"
+}
+`,
+		`f:modules/net/main.tf:# net`,
+		`f:charts/values.yaml:a: 1`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	s.RootEntry().CreateFile("stacks/file/main.tf", "# changed")
+	s.RootEntry().CreateFile("modules/net/main.tf", "# changed")
+	git.CommitAll("change stack and module")
+	first := git.RevParse("HEAD")
+
+	s.RootEntry().CreateFile("charts/values.yaml", "a: 2")
+	git.CommitAll("change values")
+	second := git.RevParse("HEAD")
+
+	cli := newCLI(t, s.RootDir())
+	res := cli.run("list", "--changed", "--why", "--json")
+	assertRunResult(t, res, runExpected{IgnoreStdout: true})
+
+	var got jsonList
+	assert.NoError(t, json.Unmarshal([]byte(res.Stdout), &got))
+	test.AssertDiff(t, got, jsonList{
+		Stacks: []jsonListStack{
+			{
+				Path: "/stacks/file",
+				Name: "file",
+				Reason: &jsonListReason{
+					Kind:        "stack-file",
+					Description: "stack has unmerged changes",
+					File:        "/stacks/file/main.tf",
+					Commit:      first,
+				},
+			},
+			{
+				Path: "/stacks/module",
+				Name: "module",
+				Reason: &jsonListReason{
+					Kind:        "local-module",
+					Description: `stack changed because module "../../modules/net" has unmerged changes`,
+					File:        "/modules/net/main.tf",
+					Modules:     []string{"../../modules/net"},
+					Commit:      first,
+				},
+			},
+			{
+				Path: "/stacks/watch",
+				Name: "watch",
+				Reason: &jsonListReason{
+					Kind:        "watched-file",
+					Description: `stack changed because watched pattern "/charts/" matched changed file "/charts/values.yaml"`,
+					File:        "/charts/values.yaml",
+					Pattern:     "/charts/",
+					Commit:      second,
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestListChangedSymlinkedModule(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:shared/modules/net/main.tf:# net`,
+		`l:shared/modules:stack-a/modules`,
+		`f:stack-a/main.tf:module "net" {
+  source = "./modules/net"
+}
+`,
+		`f:stack-b/main.tf:# b`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-module")
+
+	s.RootEntry().CreateFile("shared/modules/net/main.tf", "# changed")
+	git.CommitAll("change shared module")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack-a - stack changed because module "./modules/net" has unmerged changes`,
+		),
+	})
+
+	res := cli.run("list", "--changed", "--why", "--json")
+	assertRunResult(t, res, runExpected{IgnoreStdout: true})
+
+	var got jsonList
+	assert.NoError(t, json.Unmarshal([]byte(res.Stdout), &got))
+	test.AssertDiff(t, got, jsonList{
+		Stacks: []jsonListStack{
+			{
+				Path: "/stack-a",
+				Name: "stack-a",
+				Reason: &jsonListReason{
+					Kind:        "local-module",
+					Description: `stack changed because module "./modules/net" has unmerged changes`,
+					File:        "/shared/modules/net/main.tf",
+					Modules:     []string{"./modules/net"},
+					Commit:      git.RevParse("HEAD"),
+				},
+			},
+		},
+	})
+}
+
+func TestListChangedSymlinkedModuleLoop(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:modules/loop/main.tf:module "self" {
+  source = "./self"
+}
+`,
+		`f:stack/main.tf:module "loop" {
+  source = "../modules/loop"
+}
+`,
+		`l:modules/loop:modules/loop/self`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-module")
+
+	s.RootEntry().CreateFile("modules/loop/README.md", "# loop")
+	git.CommitAll("change module")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack - stack changed because module "../modules/loop" has unmerged changes`,
+		),
+	})
+}
+
+func TestListChangedSymlinkedModuleOutsideRepository(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:stack/main.tf:module "outside" {
+  source = "./outside"
+}
+`,
+	})
+
+	outside := t.TempDir()
+	test.WriteFile(t, outside, "main.tf", "# outside")
+	test.Symlink(t, outside, filepath.Join(s.RootDir(), "stack", "outside"))
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-stack")
+
+	s.RootEntry().CreateFile("other.txt", "changed")
+	git.CommitAll("change other file")
+
+	assertRunResult(t, cli.run("list", "--changed"), runExpected{
+		Status:      1,
+		StderrRegex: "outside the repository",
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestListChangedIncludeUncommitted(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:unstaged`,
+		`f:unstaged/main.tf:# main`,
+		`s:staged`,
+		`s:untracked`,
+		`s:deleted`,
+		`f:deleted/main.tf:# main`,
+		`s:not-changed`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("uncommitted-changes")
+
+	s.RootEntry().CreateFile("unstaged/main.tf", "# changed")
+	s.RootEntry().CreateFile("staged/main.tf", "# new")
+	git.Add(filepath.Join(s.RootDir(), "staged", "main.tf"))
+	s.RootEntry().CreateFile("untracked/main.tf", "# new")
+	s.RootEntry().RemoveFile("deleted/main.tf")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("list", "--changed"), runExpected{
+		IgnoreStderr: true,
+	})
+
+	assertRunResult(t, cli.run("--changed-include-uncommitted", "list", "--why"), runExpected{
+		Stdout: listStacks(
+			"deleted - stack has unmerged changes",
+			"staged - stack has unmerged changes",
+			"unstaged - stack has unmerged changes",
+			"untracked - stack has unmerged changes",
+		),
+		IgnoreStderr: true,
+	})
+
+	assertRunResult(t, cli.run(
+		"--changed-include-uncommitted", "run", testHelperBin, "stack-abs-path", s.RootDir(),
+	), runExpected{
+		Stdout: listStacks(
+			"/deleted",
+			"/staged",
+			"/unstaged",
+			"/untracked",
+		),
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestListChangedVendoredModule(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-a/generate.tm:generate_file "terragrunt.hcl" {
+  content = "source = \"${tm_vendor("github.com/mineiros-io/net?ref=v1")}\""
+}
+`,
+		`f:modules/github.com/mineiros-io/net/v1/main.tf:module "dep" {
+  source = "../../dep/v2"
+}
+`,
+		`f:modules/github.com/mineiros-io/dep/v2/main.tf:# dep`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-vendored-module")
+
+	s.RootEntry().CreateFile("modules/github.com/mineiros-io/net/v1/main.tf", `module "dep" {
+  source = "../../dep/v2"
+}
+# changed
+`)
+	git.CommitAll("change vendored module")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack-a - stack changed because vendored module "github.com/mineiros-io/net?ref=v1" has unmerged changes`,
+		),
+	})
+
+	git.Checkout("main")
+	git.CheckoutNew("change-vendored-dependency")
+
+	s.RootEntry().CreateFile("modules/github.com/mineiros-io/dep/v2/main.tf", "# changed")
+	git.CommitAll("change vendored dependency")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack-a - stack changed because vendored module "github.com/mineiros-io/net?ref=v1" ` +
+				`changed because module "../../dep/v2" has unmerged changes`,
+		),
+	})
+}
+
+func TestListChangedVendoredModuleCustomVendorDir(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:terramate.tm:terramate {
+  config {
+  }
+}
+
+vendor {
+  dir = "/vendor"
+}
+`,
+		`f:stack/generate.tm:generate_hcl "main.tf" {
+  content {
+    module "net" {
+      source = tm_vendor("github.com/mineiros-io/net?ref=v1")
+    }
+  }
+}
+`,
+		`f:vendor/github.com/mineiros-io/net/v1/main.tf:# net`,
+		`f:modules/github.com/mineiros-io/net/v1/main.tf:# not the vendor dir`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-other-dir")
+
+	s.RootEntry().CreateFile("modules/github.com/mineiros-io/net/v1/main.tf", "# changed")
+	git.CommitAll("change other dir")
+
+	assertRunResult(t, cli.listChangedStacks(), runExpected{})
+
+	s.RootEntry().CreateFile("vendor/github.com/mineiros-io/net/v1/main.tf", "# changed")
+	git.CommitAll("change vendored module")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack - stack changed because vendored module "github.com/mineiros-io/net?ref=v1" has unmerged changes`,
+		),
+	})
+}
@@ -234,3 +234,176 @@ func TestListWatchDirectoryFails(t *testing.T) {
 	}
 	assertRunResult(t, cli.listChangedStacks(), want)
 }
+
+func TestListWatchGlobPattern(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:shared/policies/network/ingress.rego:package ingress`,
+		`f:shared/policies/readme.md:policies`,
+		`s:stack:watch=["/shared/policies/**/*.rego"]`,
+		`s:other`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("change-the-readme")
+
+	s.RootEntry().CreateFile("shared/policies/readme.md", "changed")
+	git.CommitAll("readme changed")
+
+	assertRunResult(t, cli.listChangedStacks(), runExpected{})
+
+	git.CheckoutNew("change-the-policy")
+
+	s.RootEntry().CreateFile("shared/policies/network/ingress.rego", "package changed")
+	git.CommitAll("policy changed")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack - stack changed because watched pattern "/shared/policies/**/*.rego" ` +
+				`matched changed file "/shared/policies/network/ingress.rego"`,
+		),
+	})
+}
+
+func TestListWatchDirectory(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:charts/app/templates/deployment.yaml:kind: Deployment`,
+		`f:charts/other/values.yaml:replicas: 1`,
+		`s:stack:watch=["../charts/app/"]`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("change-the-other-chart")
+
+	s.RootEntry().CreateFile("charts/other/values.yaml", "replicas: 2")
+	git.CommitAll("other chart changed")
+
+	assertRunResult(t, cli.listChangedStacks(), runExpected{})
+
+	git.CheckoutNew("change-the-chart")
+
+	s.RootEntry().CreateFile("charts/app/templates/deployment.yaml", "kind: StatefulSet")
+	git.CommitAll("chart changed")
+
+	assertRunResult(t, cli.run("list", "--changed", "--why"), runExpected{
+		Stdout: listStacks(
+			`stack - stack changed because watched pattern "/charts/app/" ` +
+				`matched changed file "/charts/app/templates/deployment.yaml"`,
+		),
+	})
+}
+
+func TestListWatchPatternMatchingNothingFails(t *testing.T) {
+	t.Parallel()
+
+	for _, watch := range []string{
+		`["/shared/**/*.rego"]`,
+		`["/non-existent/"]`,
+	} {
+		s := sandbox.New(t)
+		s.BuildTree([]string{
+			`f:shared/file.txt:anything`,
+			`s:stack:watch=` + watch,
+		})
+
+		git := s.Git()
+		git.CommitAll("all")
+
+		// only the change detection checks the patterns match any file.
+		cli := newCLI(t, s.RootDir())
+		assertRunResult(t, cli.listStacks(), runExpected{
+			Stdout: listStacks("stack"),
+		})
+		assertRunResult(t, cli.listChangedStacks(), runExpected{
+			Status:      1,
+			StderrRegex: string(config.ErrStackInvalidWatch),
+		})
+	}
+}
+
+func TestListWatchFileAsDirFails(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:shared/file.txt:anything`,
+		`s:stack:watch=["/shared/file.txt/"]`,
+	})
+
+	git := s.Git()
+	git.CommitAll("all")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.listStacks(), runExpected{
+		Status:      1,
+		StderrRegex: string(config.ErrStackInvalidWatch),
+	})
+}
+
+func TestListWatchPatternMatchingNothingYet(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:shared/file.txt:anything`,
+		`s:stack:watch=["/shared/**/*.rego"]`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("add-policy")
+
+	assertRunResult(t, cli.listStacks(), runExpected{
+		Stdout: listStacks("stack"),
+	})
+
+	s.BuildTree([]string{"f:shared/policies/deny.rego:package deny"})
+	git.CommitAll("policy added")
+
+	assertRunResult(t, cli.listChangedStacks(), runExpected{
+		Stdout: listStacks("stack"),
+	})
+}
+
+func TestListWatchPatternMatchingDeletedFiles(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:shared/policies/deny.rego:package deny`,
+		`f:charts/app/values.yaml:replicas: 1`,
+		`s:stack-1:watch=["/shared/**/*.rego"]`,
+		`s:stack-2:watch=["/charts/app/"]`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("delete-files")
+
+	s.RootEntry().RemoveFile("shared/policies/deny.rego")
+	s.RootEntry().RemoveFile("charts/app/values.yaml")
+	git.CommitAll("files deleted")
+
+	assertRunResult(t, cli.listChangedStacks(), runExpected{
+		Stdout: listStacks("stack-1", "stack-2"),
+	})
+}
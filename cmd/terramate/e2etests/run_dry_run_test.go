@@ -0,0 +1,154 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+const dryRunEnvConfig = `
+terramate {
+  config {
+    run {
+      before_each = [["echo", "before"]]
+      env {
+        STACK = terramate.stack.name
+      }
+    }
+  }
+}
+`
+
+func TestRunDryRunPlan(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/a:tags=["prod"];wants=["/other"]`,
+		`s:stacks/b`,
+		`s:other`,
+		`f:env.tm:` + dryRunEnvConfig,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, filepath.Join(s.RootDir(), "stacks"))
+	assertRunResult(t, cli.run(
+		"--tags", "prod", "run", "--dry-run", "terraform", "apply",
+	), runExpected{
+		Stdout: listStacks(
+			"The stacks will be executed using order below:",
+			"\t0. other ()",
+			"\t\treason: stack is wanted by stack \"/stacks/a\"",
+			"\t\tdir: "+filepath.Join(s.RootDir(), "other"),
+			"\t\tcmd: echo before",
+			"\t\tcmd: terraform apply",
+			"\t\tenv: STACK=other (defined at /env.tm)",
+			"\t1. a (a)",
+			"\t\treason: stack is inside the working directory",
+			"\t\treason: stack matches the tags filter",
+			"\t\tdir: "+filepath.Join(s.RootDir(), "stacks", "a"),
+			"\t\tcmd: echo before",
+			"\t\tcmd: terraform apply",
+			"\t\tenv: STACK=a (defined at /env.tm)",
+		),
+	})
+}
+
+func TestRunDryRunPlanJSON(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack:id=stack-id`,
+		`f:env.tm:` + dryRunEnvConfig,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	res := cli.run("run", "--dry-run", "--json", "terraform", "plan")
+	assertRunResult(t, res, runExpected{IgnoreStdout: true})
+
+	type envVar struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Origin string `json:"origin"`
+	}
+
+	type plannedStack struct {
+		Order      int        `json:"order"`
+		ID         string     `json:"id"`
+		Name       string     `json:"name"`
+		Path       string     `json:"path"`
+		Reasons    []string   `json:"reasons"`
+		WorkingDir string     `json:"working_dir"`
+		Commands   [][]string `json:"commands"`
+		Env        []envVar   `json:"env"`
+	}
+
+	var plan struct {
+		Stacks []plannedStack `json:"stacks"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(res.Stdout), &plan))
+
+	test.AssertDiff(t, plan.Stacks, []plannedStack{
+		{
+			Order:      0,
+			ID:         "stack-id",
+			Name:       "stack",
+			Path:       "/stack",
+			Reasons:    []string{"stack is inside the working directory"},
+			WorkingDir: filepath.Join(s.RootDir(), "stack"),
+			Commands: [][]string{
+				{"echo", "before"},
+				{"terraform", "plan"},
+			},
+			Env: []envVar{
+				{
+					Name:   "STACK",
+					Value:  "stack",
+					Origin: "/env.tm",
+				},
+			},
+		},
+	})
+}
+
+func TestRunJSONRequiresDryRun(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--json", "terraform", "plan"), runExpected{
+		StderrRegex: "--json requires --dry-run",
+		Status:      1,
+	})
+}
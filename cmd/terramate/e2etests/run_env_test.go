@@ -0,0 +1,106 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunEnvIsMergedHierarchically(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		s     sandbox.S
+		isGit bool
+	}{
+		{
+			name:  "git project",
+			s:     sandbox.New(t),
+			isGit: true,
+		},
+		{
+			name: "non-git project",
+			s:    sandbox.NoGit(t),
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := tc.s
+			s.BuildTree([]string{
+				`s:stacks/stack-1`,
+				`s:stacks/stack-2`,
+				`f:env.tm:terramate {
+  config {
+    run {
+      env {
+        FROM_ROOT  = "root"
+        OVERRIDDEN = "root"
+      }
+    }
+  }
+}
+`,
+				`f:stacks/stack-1/env.tm:terramate {
+  config {
+    run {
+      env {
+        OVERRIDDEN = terramate.stack.name
+      }
+    }
+  }
+}
+`,
+			})
+
+			if tc.isGit {
+				git := s.Git()
+				git.CommitAll("first commit")
+			} else {
+				// run.env alone doesn't define the project root.
+				test.WriteRootConfig(t, s.RootDir())
+			}
+
+			cli := newCLI(t, s.RootDir())
+			assertRunResult(t, cli.run("experimental", "run-env"), runExpected{
+				Stdout: `
+stack "/stacks/stack-1":
+	FROM_ROOT=root (defined at /env.tm)
+	OVERRIDDEN=stack-1 (defined at /stacks/stack-1/env.tm)
+
+stack "/stacks/stack-2":
+	FROM_ROOT=root (defined at /env.tm)
+	OVERRIDDEN=root (defined at /env.tm)
+`,
+			})
+
+			// the run.env of a stack doesn't turn it into the project root.
+			cli = newCLI(t, filepath.Join(s.RootDir(), "stacks", "stack-1"))
+			assertRunResult(t, cli.run("experimental", "run-env"), runExpected{
+				Stdout: `
+stack "/stacks/stack-1":
+	FROM_ROOT=root (defined at /env.tm)
+	OVERRIDDEN=stack-1 (defined at /stacks/stack-1/env.tm)
+`,
+			})
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+const runHooksConfig = `
+terramate {
+  config {
+    run {
+      before_each = [[env.TM_TEST_HELPER, "echo", "before", terramate.stack.name]]
+      after_each  = [[env.TM_TEST_HELPER, "echo", "after", terramate.stack.name]]
+      on_failure  = [[env.TM_TEST_HELPER, "echo", "failed", terramate.stack.name]]
+    }
+  }
+}
+`
+
+func TestRunHooks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`s:stack-2`,
+		`f:stack-1/file.txt:stack-1` + "\n",
+		`f:stack-2/file.txt:stack-2` + "\n",
+		`f:hooks.tm:` + runHooksConfig,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", testHelperBin, "cat", "file.txt"), runExpected{
+		Stdout: listStacks(
+			"before stack-1",
+			"stack-1",
+			"after stack-1",
+			"before stack-2",
+			"stack-2",
+			"after stack-2",
+		),
+	})
+}
+
+func TestRunHooksOnFailure(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`s:stack-2`,
+		`f:stack-2/file.txt:stack-2` + "\n",
+		`f:hooks.tm:` + runHooksConfig,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--continue-on-error", testHelperBin, "cat", "file.txt",
+	), runExpected{
+		Stdout: listStacks(
+			"before stack-1",
+			"failed stack-1",
+			"before stack-2",
+			"stack-2",
+			"after stack-2",
+		),
+		IgnoreStderr: true,
+		Status:       1,
+	})
+}
+
+func TestRunHooksOnScripts(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:hooks.tm:` + runHooksConfig,
+		`f:script.tm:` + `
+script "hello" {
+  job {
+    commands = [[env.TM_TEST_HELPER, "echo", "hello"]]
+  }
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "hello"), runExpected{
+		Stdout: listStacks(
+			"before stack",
+			"hello",
+			"after stack",
+		),
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunPrefixOutput(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-a/file.txt:line1` + "\n" + `line2` + "\n",
+		`f:stack-b/file.txt:no newline at end`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--prefix-output", testHelperBin, "cat", "file.txt",
+	), runExpected{
+		Stdout: listStacks(
+			"[/stack-a] line1",
+			"[/stack-a] line2",
+			"[/stack-b] no newline at end",
+		),
+	})
+}
+
+func TestRunLogDir(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/ok`,
+		`s:stacks/failed`,
+		`f:stacks/ok/file.txt:ok` + "\n",
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	logdir := t.TempDir()
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--continue-on-error", "--log-dir", logdir,
+		testHelperBin, "cat", "file.txt",
+	), runExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	loadStatus := func(stackdir string) run.LogStatus {
+		t.Helper()
+
+		data, err := os.ReadFile(run.LogStatusFilePath(logdir, project.NewPath(stackdir)))
+		assert.NoError(t, err)
+
+		var status run.LogStatus
+		assert.NoError(t, json.Unmarshal(data, &status))
+		return status
+	}
+
+	assert.EqualStrings(t, "ok\n", string(test.ReadFile(t, logdir, "stacks/ok.log")))
+
+	okStatus := loadStatus("/stacks/ok")
+	assert.EqualInts(t, 0, okStatus.ExitCode)
+	assert.EqualStrings(t, "", okStatus.Error)
+	if okStatus.FinishedAt.Before(okStatus.StartedAt) {
+		t.Errorf("invalid start/end time: %v", okStatus)
+	}
+
+	failedLog := test.ReadFile(t, logdir, "stacks/failed.log")
+	if len(failedLog) == 0 {
+		t.Error("want stderr of failed command on log file")
+	}
+
+	failedStatus := loadStatus("/stacks/failed")
+	if failedStatus.ExitCode == 0 {
+		t.Errorf("want failed exit code, got: %v", failedStatus)
+	}
+	if failedStatus.Error == "" {
+		t.Errorf("want error on failed status, got: %v", failedStatus)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunParallelRespectsOrder(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b:after=["/stack-a"]`,
+		`s:stack-c:after=["/stack-b"]`,
+		`s:stack-c/child`,
+		`f:stack-a/file.txt:stack-a` + "\n",
+		`f:stack-b/file.txt:stack-b` + "\n",
+		`f:stack-c/file.txt:stack-c` + "\n",
+		`f:stack-c/child/file.txt:child` + "\n",
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--parallel", "4", testHelperBin, "cat", "file.txt",
+	), runExpected{
+		Stdout: listStacks("stack-a", "stack-b", "stack-c", "child"),
+	})
+
+	assertRunResult(t, cli.run(
+		"run", "--reverse", "--parallel", "4", testHelperBin, "cat", "file.txt",
+	), runExpected{
+		Stdout: listStacks("child", "stack-c", "stack-b", "stack-a"),
+	})
+}
+
+func TestRunParallelIndependentStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	layout := []string{}
+	want := []string{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		layout = append(layout,
+			"s:"+name,
+			"f:"+name+"/file.txt:"+name+"\n",
+		)
+		want = append(want, name)
+	}
+	s.BuildTree(layout)
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	res := cli.run("run", "--parallel", "3", testHelperBin, "cat", "file.txt")
+	assertRunResult(t, res, runExpected{IgnoreStdout: true})
+
+	got := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	sort.Strings(got)
+	test.AssertDiff(t, got, want)
+}
+
+func TestRunParallelContinueOnErrorSkipsDependentStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:failed`,
+		`s:dependent:after=["/failed"]`,
+		`s:dependent-of-dependent:after=["/dependent"]`,
+		`s:independent`,
+		`f:dependent/file.txt:dependent` + "\n",
+		`f:dependent-of-dependent/file.txt:dependent-of-dependent` + "\n",
+		`f:independent/file.txt:independent` + "\n",
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--parallel", "2", "--continue-on-error",
+		testHelperBin, "cat", "file.txt",
+	), runExpected{
+		Stdout:       listStacks("independent"),
+		IgnoreStderr: true,
+		Status:       1,
+	})
+}
+
+func TestRunParallelFailsWithInvalidValue(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.CreateStack("stack")
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--parallel", "0", testHelperBin, "env",
+	), runExpected{
+		StderrRegex: "--parallel must be at least 1",
+		Status:      1,
+	})
+}
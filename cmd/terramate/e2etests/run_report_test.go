@@ -0,0 +1,217 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunReport(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:failed:id=failed-id`,
+		`s:dependent:after=["/failed"]`,
+		`s:independent`,
+		`f:dependent/file.txt:dependent`,
+		`f:independent/file.txt:independent`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	reportdir := t.TempDir()
+	jsonReport := filepath.Join(reportdir, "report.json")
+	junitReport := filepath.Join(reportdir, "report.xml")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--parallel", "2", "--continue-on-error",
+		"--report-json", jsonReport,
+		"--report-junit", junitReport,
+		testHelperBin, "cat", "file.txt",
+	), runExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	type stackReport struct {
+		ID       string   `json:"id"`
+		Name     string   `json:"name"`
+		Path     string   `json:"path"`
+		Command  []string `json:"command"`
+		Status   string   `json:"status"`
+		Skipped  bool     `json:"skipped"`
+		ExitCode int      `json:"exit_code"`
+	}
+
+	var report struct {
+		Command []string      `json:"command"`
+		Stacks  []stackReport `json:"stacks"`
+	}
+
+	data := test.ReadFile(t, reportdir, "report.json")
+	assert.NoError(t, json.Unmarshal(data, &report))
+
+	wantCmd := []string{testHelperBin, "cat", "file.txt"}
+	test.AssertDiff(t, report.Command, wantCmd)
+
+	// The failed command exit code depends on the platform, so it is
+	// checked separately.
+	assert.EqualInts(t, 3, len(report.Stacks))
+	assert.IsTrue(t, report.Stacks[0].ExitCode != 0, "failed stack exit code must not be zero")
+	report.Stacks[0].ExitCode = 0
+
+	test.AssertDiff(t, report.Stacks, []stackReport{
+		{
+			ID:      "failed-id",
+			Name:    "failed",
+			Path:    "/failed",
+			Command: wantCmd,
+			Status:  "failed",
+		},
+		{
+			Name:     "dependent",
+			Path:     "/dependent",
+			Command:  wantCmd,
+			Status:   "skipped",
+			Skipped:  true,
+			ExitCode: -1,
+		},
+		{
+			Name:    "independent",
+			Path:    "/independent",
+			Command: wantCmd,
+			Status:  "succeeded",
+		},
+	})
+
+	var junit struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Skipped  int `xml:"skipped,attr"`
+	}
+
+	data = test.ReadFile(t, reportdir, "report.xml")
+	assert.NoError(t, xml.Unmarshal(data, &junit))
+	assert.EqualInts(t, 3, junit.Tests)
+	assert.EqualInts(t, 1, junit.Failures)
+	assert.EqualInts(t, 1, junit.Skipped)
+}
+
+func TestRunReportWithHooks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:hook-failed`,
+		`s:succeeded`,
+		`f:hook-failed/file.txt:hook-failed`,
+		`f:succeeded/file.txt:succeeded`,
+		`f:succeeded/after.txt:after`,
+		`f:hooks.tm:
+terramate {
+  config {
+    run {
+      after_each = [[env.TM_TEST_HELPER, "cat", "after.txt"]]
+    }
+  }
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	reportdir := t.TempDir()
+	jsonReport := filepath.Join(reportdir, "report.json")
+	junitReport := filepath.Join(reportdir, "report.xml")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--continue-on-error",
+		"--report-json", jsonReport,
+		"--report-junit", junitReport,
+		testHelperBin, "cat", "file.txt",
+	), runExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	type stackReport struct {
+		Path      string   `json:"path"`
+		Command   []string `json:"command"`
+		Status    string   `json:"status"`
+		ExitCode  int      `json:"exit_code"`
+		Error     string   `json:"error"`
+		HookError string   `json:"hook_error"`
+	}
+
+	var report struct {
+		Stacks []stackReport `json:"stacks"`
+	}
+
+	data := test.ReadFile(t, reportdir, "report.json")
+	assert.NoError(t, json.Unmarshal(data, &report))
+
+	// The result of the stack is the one of the stack command, not of
+	// the after_each hook.
+	assert.EqualInts(t, 2, len(report.Stacks))
+	assert.IsTrue(t, report.Stacks[0].HookError != "", "hook error must be reported")
+	report.Stacks[0].HookError = ""
+
+	wantCmd := []string{testHelperBin, "cat", "file.txt"}
+	test.AssertDiff(t, report.Stacks, []stackReport{
+		{
+			Path:    "/hook-failed",
+			Command: wantCmd,
+			Status:  "failed",
+		},
+		{
+			Path:    "/succeeded",
+			Command: wantCmd,
+			Status:  "succeeded",
+		},
+	})
+
+	var junit struct {
+		Failures int `xml:"failures,attr"`
+		Suite    struct {
+			Cases []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Message string `xml:"message,attr"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+
+	data = test.ReadFile(t, reportdir, "report.xml")
+	assert.NoError(t, xml.Unmarshal(data, &junit))
+	assert.EqualInts(t, 1, junit.Failures)
+	assert.EqualStrings(t, "/hook-failed", junit.Suite.Cases[0].Name)
+	assert.IsTrue(t, junit.Suite.Cases[0].Failure != nil, "hook failure must be reported")
+	assert.EqualStrings(t, "run hook failed", junit.Suite.Cases[0].Failure.Message)
+}
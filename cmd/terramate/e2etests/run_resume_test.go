@@ -0,0 +1,186 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunResumeExecutesOnlyStacksThatDidNotSucceed(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`s:stack-2:after=["/stack-1"]`,
+		`s:stack-3:after=["/stack-2"]`,
+		`f:stack-1/file.txt:stack-1` + "\n",
+		`f:stack-3/file.txt:stack-3` + "\n",
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--save-state", testHelperBin, "cat", "file.txt",
+	), runExpected{
+		Stdout:       "stack-1\n",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.RootEntry().CreateFile("stack-2/file.txt", "stack-2\n")
+	git.CommitAll("fix stack-2")
+
+	assertRunResult(t, cli.run("run", "--resume"), runExpected{
+		Stdout: listStacks("stack-2", "stack-3"),
+	})
+
+	// All stacks succeeded, nothing left to resume.
+	assertRunResult(t, cli.run("run", "--resume"), runExpected{
+		IgnoreStderr: true,
+	})
+}
+
+func TestRunResumeWithStateFile(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`s:stack-2`,
+		`f:stack-2/file.txt:stack-2` + "\n",
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--continue-on-error", "--state-file", stateFile,
+		testHelperBin, "cat", "file.txt",
+	), runExpected{
+		Stdout:       "stack-2\n",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.RootEntry().CreateFile("stack-1/file.txt", "stack-1\n")
+	git.CommitAll("fix stack-1")
+
+	assertRunResult(t, cli.run(
+		"run", "--resume", "--state-file", stateFile,
+		testHelperBin, "cat", "file.txt",
+	), runExpected{
+		Stdout: "stack-1\n",
+	})
+}
+
+func TestRunResumeFailsWithDifferentCommand(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--save-state", testHelperBin, "cat", "file.txt",
+	), runExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	assertRunResult(t, cli.run(
+		"run", "--resume", testHelperBin, "cat", "other.txt",
+	), runExpected{
+		StderrRegex: "command differs from the command of the run being resumed",
+		Status:      1,
+	})
+}
+
+func TestRunResumeFailsIfOrderChanged(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`s:stack-2`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--save-state", testHelperBin, "cat", "file.txt",
+	), runExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.DirEntry("stack-1").CreateFile(stack.DefaultFilename, `
+stack {
+  after = ["/stack-2"]
+}
+`)
+	git.CommitAll("change order")
+
+	assertRunResult(t, cli.run("run", "--resume"), runExpected{
+		StderrRegex: "order of execution changed",
+		Status:      1,
+	})
+}
+
+func TestRunResumeFailsWithoutSavedState(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--resume"), runExpected{
+		StderrRegex: "loading run state to resume",
+		Status:      1,
+	})
+
+	// the state is only saved when asked for.
+	assertRunResult(t, cli.run(
+		"run", testHelperBin, "cat", "file.txt",
+	), runExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+	assertRunResult(t, cli.run("run", "--resume"), runExpected{
+		StderrRegex: "loading run state to resume",
+		Status:      1,
+	})
+}
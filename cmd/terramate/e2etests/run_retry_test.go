@@ -0,0 +1,181 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunRetries(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--retries", "2", "--retry-delay", "10ms",
+		testHelperBin, "flaky", "attempts.txt", "2",
+	), runExpected{
+		Stdout: listStacks(
+			"attempt 1",
+			"attempt 2",
+			"attempt 3",
+		),
+	})
+}
+
+func TestRunRetriesExhausted(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:hooks.tm:` + runHooksConfig,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--retries", "1",
+		testHelperBin, "flaky", "attempts.txt", "5",
+	), runExpected{
+		Stdout: listStacks(
+			"before stack",
+			"attempt 1",
+			"before stack",
+			"attempt 2",
+			"failed stack",
+		),
+		StderrRegex: "attempt 2 of 2",
+		Status:      1,
+	})
+}
+
+func TestRunRetriesFromConfigOverriddenByStack(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`d:stack-2`,
+		`f:.gitignore:attempts.txt`,
+		`f:stack-2/stack.tm:stack {
+  run_retries = 0
+}
+`,
+		`f:run.tm:terramate {
+  config {
+    run {
+      retries     = 1
+      retry_delay = "10ms"
+    }
+  }
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--continue-on-error",
+		testHelperBin, "flaky", "attempts.txt", "1",
+	), runExpected{
+		Stdout: listStacks(
+			"attempt 1",
+			"attempt 2",
+			"attempt 1",
+		),
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	// flags override the project configuration.
+	cli = newCLI(t, filepath.Join(s.RootDir(), "stack-1"))
+	assertRunResult(t, cli.run(
+		"run", "--retries", "0",
+		testHelperBin, "flaky", "attempts.txt", "5",
+	), runExpected{
+		Stdout:       listStacks("attempt 3"),
+		IgnoreStderr: true,
+		Status:       1,
+	})
+}
+
+func TestRunTimeout(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`s:stack-2`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run", "--continue-on-error", "--timeout", "500ms",
+		testHelperBin, "sleep", "1m",
+	), runExpected{
+		Stdout: listStacks(
+			"ready",
+			"ready",
+		),
+		StderrRegex: "command timed out",
+		Status:      1,
+	})
+}
+
+func TestRunTimeoutRunsOnFailureHooks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`d:stack`,
+		`f:hooks.tm:` + runHooksConfig,
+		`f:stack/stack.tm:stack {
+  run_timeout = "500ms"
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", testHelperBin, "sleep", "1m"), runExpected{
+		Stdout: listStacks(
+			"before stack",
+			"ready",
+			"failed stack",
+		),
+		StderrRegex: "command timed out",
+		Status:      1,
+	})
+}
@@ -2298,10 +2298,10 @@ func TestRunWitCustomizedEnv(t *testing.T) {
 	t.Run("ExperimentalRunEnv", func(t *testing.T) {
 		want := fmt.Sprintf(`
 stack "/stack":
-	FROM_ENV=%s
-	FROM_GLOBAL=%s
-	FROM_META=%s
-	TERRAMATE_OVERRIDDEN=%s
+	FROM_ENV=%s (defined at /env.tm)
+	FROM_GLOBAL=%s (defined at /env.tm)
+	FROM_META=%s (defined at /env.tm)
+	TERRAMATE_OVERRIDDEN=%s (defined at /env.tm)
 `, exportedTerramateTest, stackGlobal, stackName, newTerramateOverriden)
 
 		assertRunResult(t, tm.run("experimental", "run-env"), runExpected{
@@ -0,0 +1,213 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestScriptRun(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/stack-a`,
+		`s:stacks/stack-b:after=["/stacks/stack-a"]`,
+		`f:stacks/stack-b/file.txt:stack-b file` + "\n",
+		`f:script.tm:` + `
+globals {
+  greeting = "hello"
+}
+
+script "greet" {
+  description = "greets the stack"
+  job {
+    commands = [
+      [env.TM_TEST_HELPER, "echo", global.greeting, terramate.stack.name],
+    ]
+  }
+  job {
+    commands = [
+      [env.TM_TEST_HELPER, "echo", "bye", terramate.stack.path.absolute],
+    ]
+  }
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "greet"), runExpected{
+		Stdout: listStacks(
+			"hello stack-a",
+			"bye /stacks/stack-a",
+			"hello stack-b",
+			"bye /stacks/stack-b",
+		),
+	})
+}
+
+func TestScriptRunStopsStackOnFirstFailedCommand(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-b/file.txt:stack-b file` + "\n",
+		`f:script.tm:` + `
+script "cat" {
+  job {
+    commands = [
+      [env.TM_TEST_HELPER, "cat", "file.txt"],
+      [env.TM_TEST_HELPER, "echo", "done"],
+    ]
+  }
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "cat"), runExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	assertRunResult(t, cli.run("script", "run", "--continue-on-error", "cat"), runExpected{
+		Stdout:       listStacks("stack-b file", "done"),
+		IgnoreStderr: true,
+		Status:       1,
+	})
+}
+
+func TestScriptRunInheritanceAndOverride(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/stack-a`,
+		`s:stacks/override/stack-b`,
+		`s:other`,
+		`f:stacks/script.tm:` + `
+script "hello" {
+  job {
+    commands = [[env.TM_TEST_HELPER, "echo", "parent"]]
+  }
+}
+`,
+		`f:stacks/override/script.tm:` + `
+script "hello" {
+  job {
+    commands = [[env.TM_TEST_HELPER, "echo", "override"]]
+  }
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+
+	// Stacks without the script are ignored.
+	assertRunResult(t, cli.run("script", "run", "hello"), runExpected{
+		Stdout: listStacks("override", "parent"),
+	})
+
+	assertRunResult(t, cli.run("script", "list"), runExpected{
+		Stdout: listStacks(
+			"hello (defined at stacks)",
+			"hello (defined at stacks/override)",
+		),
+	})
+
+	stackCLI := helperEnvCLI(t, filepath.Join(s.RootDir(), "stacks", "stack-a"))
+	assertRunResult(t, stackCLI.run("script", "list"), runExpected{
+		Stdout: listStacks("hello (defined at /stacks)"),
+	})
+}
+
+func TestScriptRunDryRun(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:script.tm:` + `
+script "deploy" {
+  description = "deploys the stack"
+  job {
+    commands = [
+      ["terraform", "init"],
+      ["terraform", "apply", "-var", "stack=${terramate.stack.name}"],
+    ]
+  }
+}
+`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "--dry-run", "deploy"), runExpected{
+		Stdout: listStacks(
+			`The script "deploy" will be executed using order below:`,
+			"\t0. stack (stack)",
+			"\t\treason: stack is inside the working directory",
+			"\t\tdir: "+filepath.Join(s.RootDir(), "stack"),
+			"\t\tcmd: terraform init",
+			"\t\tcmd: terraform apply -var stack=stack",
+		),
+	})
+
+	assertRunResult(t, cli.run("script", "list"), runExpected{
+		Stdout: listStacks("deploy: deploys the stack (defined at .)"),
+	})
+}
+
+func TestScriptRunFailsIfScriptNotFound(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := helperEnvCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "unknown"), runExpected{
+		StderrRegex: `script "unknown" not found`,
+		Status:      1,
+	})
+}
+
+// helperEnvCLI creates a CLI where the test helper binary is available as
+// env.TM_TEST_HELPER, so it can be used on Terramate configuration.
+func helperEnvCLI(t *testing.T, chdir string) tmcli {
+	cli := newCLI(t, chdir)
+	cli.env = append([]string{"TM_TEST_HELPER=" + testHelperBin}, testEnviron()...)
+	return cli
+}
@@ -81,6 +81,8 @@ type List[T DirElem] []T
 // the config in fromdir and all parent directories until / is reached.
 // If the configuration is found, it returns the whole configuration tree,
 // configpath != "" and found as true.
+// Directories that only define terramate.config.run.env are never used as the
+// root directory, since run.env can be defined in any directory of the project.
 func TryLoadConfig(fromdir string) (tree *Root, configpath string, found bool, err error) {
 	for {
 		logger := log.With().
@@ -98,12 +100,9 @@ func TryLoadConfig(fromdir string) (tree *Root, configpath string, found bool, e
 			if !errors.IsKind(err, hcl.ErrImport) {
 				return nil, "", false, err
 			}
-		} else if cfg.Terramate != nil && cfg.Terramate.Config != nil {
-			tree, err := loadTree(fromdir, fromdir, &cfg)
-			if err != nil {
-				return nil, fromdir, true, err
-			}
-			return NewRoot(tree), fromdir, true, err
+		} else if cfg.Terramate != nil && cfg.Terramate.Config != nil &&
+			!cfg.Terramate.OnlyRunEnv() {
+			return loadRootConfig(fromdir, &cfg)
 		}
 
 		parent, ok := parentDir(fromdir)
@@ -115,6 +114,14 @@ func TryLoadConfig(fromdir string) (tree *Root, configpath string, found bool, e
 	return nil, "", false, nil
 }
 
+func loadRootConfig(rootdir string, cfg *hcl.Config) (*Root, string, bool, error) {
+	tree, err := loadTree(rootdir, rootdir, cfg)
+	if err != nil {
+		return nil, rootdir, true, err
+	}
+	return NewRoot(tree), rootdir, true, nil
+}
+
 // NewRoot creates a new [Root] tree for the cfg tree.
 func NewRoot(tree *Tree) *Root {
 	r := &Root{
@@ -20,7 +20,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/bmatcuk/doublestar"
 	"github.com/mineiros-io/terramate/config/tag"
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl"
@@ -65,6 +67,23 @@ type (
 		// Watch is the list of files to be watched for changes.
 		Watch []project.Path
 
+		// WatchPatterns is the list of glob patterns and directories to be
+		// watched for changes. They are project absolute paths and the
+		// directories end with "/".
+		WatchPatterns []string
+
+		// RunTimeout, if not nil, overrides the timeout of the commands
+		// executed on this stack.
+		RunTimeout *time.Duration
+
+		// RunRetries, if not nil, overrides the number of retries of the
+		// commands executed on this stack.
+		RunRetries *int
+
+		// RunRetryDelay, if not nil, overrides the delay between the retries
+		// of the commands executed on this stack.
+		RunRetryDelay *time.Duration
+
 		// IsChanged tells if this is a changed stack.
 		IsChanged bool
 	}
@@ -102,7 +121,7 @@ func NewStackFromHCL(root string, cfg hcl.Config) (*Stack, error) {
 		name = filepath.Base(cfg.AbsDir())
 	}
 
-	watchFiles, err := validateWatchPaths(root, cfg.AbsDir(), cfg.Stack.Watch)
+	watchFiles, watchPatterns, err := validateWatchPaths(root, cfg.AbsDir(), cfg.Stack.Watch)
 	if err != nil {
 		return nil, errors.E(err, ErrStackInvalidWatch)
 	}
@@ -118,6 +137,11 @@ func NewStackFromHCL(root string, cfg hcl.Config) (*Stack, error) {
 		WantedBy:    cfg.Stack.WantedBy,
 		Watch:       watchFiles,
 		Dir:         project.PrjAbsPath(root, cfg.AbsDir()),
+
+		WatchPatterns: watchPatterns,
+		RunTimeout:    cfg.Stack.RunTimeout,
+		RunRetries:    cfg.Stack.RunRetries,
+		RunRetryDelay: cfg.Stack.RunRetryDelay,
 	}
 	err = stack.Validate()
 	if err != nil {
@@ -270,8 +294,11 @@ func (s *Stack) Sortable() *SortableStack {
 	}
 }
 
-func validateWatchPaths(rootdir string, stackpath string, paths []string) (project.Paths, error) {
-	var projectPaths project.Paths
+func validateWatchPaths(rootdir string, stackpath string, paths []string) (project.Paths, []string, error) {
+	var (
+		projectPaths project.Paths
+		patterns     []string
+	)
 	for _, pathstr := range paths {
 		var abspath string
 		if path.IsAbs(pathstr) {
@@ -280,23 +307,63 @@ func validateWatchPaths(rootdir string, stackpath string, paths []string) (proje
 			abspath = filepath.Join(stackpath, filepath.FromSlash(pathstr))
 		}
 		if !strings.HasPrefix(abspath, rootdir) {
-			return nil, errors.E("path %s is outside project root", pathstr)
+			return nil, nil, errors.E("path %s is outside project root", pathstr)
+		}
+
+		isDir := strings.HasSuffix(pathstr, "/")
+		prjpath := project.PrjAbsPath(rootdir, abspath)
+
+		if project.IsGlobPattern(pathstr) {
+			pattern := prjpath.String()
+			if isDir {
+				pattern = path.Join(pattern, "**")
+			}
+			if err := validateWatchPattern(pattern); err != nil {
+				return nil, nil, errors.E(err, "validating pattern %q", pathstr)
+			}
+			patterns = append(patterns, pattern)
+			continue
 		}
+
 		st, err := os.Stat(abspath)
+		if isDir {
+			if err == nil && !st.IsDir() {
+				return nil, nil, errors.E("stack.watch path %q ends with \"/\" "+
+					"but is not a directory", pathstr)
+			}
+			pattern := prjpath.String()
+			if pattern != "/" {
+				pattern += "/"
+			}
+			patterns = append(patterns, pattern)
+			continue
+		}
+
 		if err == nil {
 			if st.IsDir() {
-				return nil, errors.E("stack.watch must be a list of regular files "+
+				return nil, nil, errors.E("stack.watch must be a list of regular files, "+
+					"glob patterns or directories ending with \"/\" "+
 					"but directory %q was provided", pathstr)
 			}
 
 			if !st.Mode().IsRegular() {
-				return nil, errors.E("stack.watch must be a list of regular files "+
+				return nil, nil, errors.E("stack.watch must be a list of regular files "+
 					"but file %q has mode %s", pathstr, st.Mode())
 			}
 		}
-		projectPaths = append(projectPaths, project.PrjAbsPath(rootdir, abspath))
+		projectPaths = append(projectPaths, prjpath)
 	}
-	return projectPaths, nil
+	return projectPaths, patterns, nil
+}
+
+// validateWatchPattern checks that the glob pattern is valid. Whether the
+// pattern matches any file is only checked by the change detection, since the
+// files may be deleted by the changes being detected.
+func validateWatchPattern(pattern string) error {
+	if _, err := doublestar.Match(pattern, "/"); err != nil {
+		return errors.E(err, "invalid glob pattern")
+	}
+	return nil
 }
 
 // StacksFromTrees converts a List[*Tree] into a List[*Stack].
@@ -57,7 +57,7 @@ func ListTerramateFiles(dir string) ([]string, error) {
 		}
 
 		filename := dirEntry.Name()
-		if isTerramateFile(filename) {
+		if IsTerramateFile(filename) {
 			logger.Trace().Msg("Found Terramate file")
 			files = append(files, filename)
 		}
@@ -106,6 +106,7 @@ func ListTerramateDirs(dir string) ([]string, error) {
 	return dirs, nil
 }
 
-func isTerramateFile(filename string) bool {
+// IsTerramateFile tells if the filename is a Terramate configuration file.
+func IsTerramateFile(filename string) bool {
 	return strings.HasSuffix(filename, ".tm") || strings.HasSuffix(filename, ".tm.hcl")
 }
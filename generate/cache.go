@@ -0,0 +1,523 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	hhcl "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/event"
+	"github.com/mineiros-io/terramate/fs"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/stdlib"
+	"github.com/mineiros-io/terramate/tf"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// CacheFile is the path of the code generation cache file, relative to the
+// git directory of the repository.
+const CacheFile = "terramate/generate-cache.json"
+
+// cacheVersion is the version of the cache file format. Cache files of other
+// versions are discarded, so it must be incremented whenever the format or
+// the fingerprint inputs change.
+const cacheVersion = 1
+
+type (
+	// Cache caches the fingerprints of the inputs of the code generation of
+	// the stacks, so the stacks whose inputs didn't change since they were
+	// generated are skipped. The inputs of a stack are the Terramate version,
+	// the config files from the project root to the stack dir (including the
+	// imported files), the list of stacks of the project and the files read
+	// with the tm_file functions. A nil cache is valid and caches nothing.
+	Cache struct {
+		path      string
+		tmVersion string
+
+		mu     sync.Mutex
+		stacks map[string]cachedStack
+		dirty  bool
+
+		// calls are the tm_ function calls of the config files, keyed by
+		// the hash of their content.
+		calls map[string][]*hclsyntax.FunctionCallExpr
+	}
+
+	cacheData struct {
+		Version int                    `json:"version"`
+		Stacks  map[string]cachedStack `json:"stacks"`
+	}
+
+	cachedStack struct {
+		// Fingerprint is the fingerprint of the inputs of the stack.
+		Fingerprint string `json:"fingerprint"`
+
+		// Files are the hashes of the code of the generated files, keyed
+		// by their label.
+		Files map[string]string `json:"files"`
+
+		// VendorSources are the module sources vendored with tm_vendor,
+		// which are requested again when the stack is skipped.
+		VendorSources []string `json:"vendor_sources,omitempty"`
+	}
+)
+
+var (
+	// fileFuncs are the functions reading the file of their first argument.
+	fileFuncs = map[string]bool{
+		"file":             true,
+		"fileexists":       true,
+		"filebase64":       true,
+		"filebase64sha256": true,
+		"filebase64sha512": true,
+		"filemd5":          true,
+		"filesha1":         true,
+		"filesha256":       true,
+		"filesha512":       true,
+		"templatefile":     true,
+	}
+
+	// uncacheableFuncs are the functions whose result can't be fingerprinted.
+	uncacheableFuncs = map[string]bool{
+		"bcrypt":    true,
+		"fileset":   true,
+		"timestamp": true,
+		"uuid":      true,
+	}
+)
+
+// NewCache creates an empty cache saved on the given file. The tmVersion is
+// the version of Terramate, which is part of the fingerprint of the stacks.
+func NewCache(path, tmVersion string) *Cache {
+	return &Cache{
+		path:      path,
+		tmVersion: tmVersion,
+		stacks:    map[string]cachedStack{},
+		calls:     map[string][]*hclsyntax.FunctionCallExpr{},
+	}
+}
+
+// LoadCache loads the cache from the given file. Missing, invalid or outdated
+// cache files are not an error, an empty cache is returned instead.
+func LoadCache(path, tmVersion string) *Cache {
+	logger := log.With().
+		Str("action", "generate.LoadCache()").
+		Str("path", path).
+		Logger()
+
+	cache := NewCache(path, tmVersion)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		logger.Debug().Err(err).Msg("no code generation cache")
+		return cache
+	}
+
+	var data cacheData
+	if err := json.Unmarshal(content, &data); err != nil {
+		logger.Debug().Err(err).Msg("ignoring invalid code generation cache")
+		return cache
+	}
+
+	if data.Version != cacheVersion {
+		logger.Debug().
+			Int("version", data.Version).
+			Msg("ignoring code generation cache of other version")
+		return cache
+	}
+
+	for dir, cached := range data.Stacks {
+		cache.stacks[dir] = cached
+	}
+	return cache
+}
+
+// UpToDate tells if the generated code of the stack is up to date with the
+// inputs fingerprinted when it was last generated, which means the stack is
+// skipped by code generation.
+func (c *Cache) UpToDate(root *config.Root, st *config.Stack, vendorDir project.Path) bool {
+	_, ok := c.lookup(root, st, vendorDir)
+	return ok
+}
+
+// Save writes the cache file, if it changed.
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	content, err := json.Marshal(cacheData{
+		Version: cacheVersion,
+		Stacks:  c.stacks,
+	})
+	if err != nil {
+		return errors.E(err, "encoding code generation cache")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return errors.E(err, "creating code generation cache dir")
+	}
+
+	// the file is replaced atomically, so concurrent runs never read a
+	// partially written cache.
+	tmpfile, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return errors.E(err, "creating code generation cache file")
+	}
+
+	_, err = tmpfile.Write(content)
+	errClose := tmpfile.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmpfile.Name(), c.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpfile.Name())
+		return errors.E(err, "writing code generation cache file")
+	}
+
+	c.dirty = false
+	return nil
+}
+
+// lookup returns the fingerprint of the stack and if its generated code is up
+// to date with the cache. The fingerprint is empty if the stack can't be
+// cached.
+func (c *Cache) lookup(root *config.Root, st *config.Stack, vendorDir project.Path) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	logger := log.With().
+		Str("action", "generate.Cache.lookup()").
+		Stringer("stack", st.Dir).
+		Logger()
+
+	fingerprint, err := c.fingerprint(root, st, vendorDir)
+	if err != nil {
+		logger.Debug().Err(err).Msg("stack can't be cached")
+		return "", false
+	}
+
+	c.mu.Lock()
+	cached, ok := c.stacks[st.Dir.String()]
+	c.mu.Unlock()
+
+	if !ok || cached.Fingerprint != fingerprint {
+		logger.Debug().Msg("cache miss")
+		return fingerprint, false
+	}
+
+	if !generatedFilesMatch(root, st, cached.Files) {
+		logger.Debug().Msg("cache miss, generated files changed")
+		return fingerprint, false
+	}
+
+	logger.Debug().Msg("cache hit")
+	return fingerprint, true
+}
+
+// vendorRequests returns the vendor requests done by the last generation of
+// the stack.
+func (c *Cache) vendorRequests(dir project.Path, vendorDir project.Path) []event.VendorRequest {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	sources := c.stacks[dir.String()].VendorSources
+	c.mu.Unlock()
+
+	var requests []event.VendorRequest
+	for _, source := range sources {
+		modsrc, err := tf.ParseSource(source)
+		if err != nil {
+			// sources are stored only after being successfully parsed.
+			panic(errors.E(errors.ErrInternal, err, "parsing cached vendor source"))
+		}
+		requests = append(requests, event.VendorRequest{
+			Source:    modsrc,
+			VendorDir: vendorDir,
+		})
+	}
+	return requests
+}
+
+// store caches the fingerprint and the generated files of the stack.
+func (c *Cache) store(
+	dir project.Path,
+	fingerprint string,
+	files map[string]string,
+	requests []event.VendorRequest,
+) {
+	if c == nil || fingerprint == "" {
+		return
+	}
+
+	cached := cachedStack{
+		Fingerprint: fingerprint,
+		Files:       map[string]string{},
+	}
+	for filename, code := range files {
+		cached.Files[filename] = contentHash([]byte(code))
+	}
+	for _, req := range requests {
+		cached.VendorSources = append(cached.VendorSources, req.Source.Raw)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stacks[dir.String()] = cached
+	c.dirty = true
+}
+
+// remove removes the stack from the cache.
+func (c *Cache) remove(dir project.Path) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.stacks[dir.String()]; ok {
+		delete(c.stacks, dir.String())
+		c.dirty = true
+	}
+}
+
+// prune removes the stacks that don't exist anymore from the cache.
+func (c *Cache) prune(stacks config.List[*config.SortableStack]) {
+	if c == nil {
+		return
+	}
+
+	exists := map[string]bool{}
+	for _, elem := range stacks {
+		exists[elem.Dir().String()] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for dir := range c.stacks {
+		if !exists[dir] {
+			delete(c.stacks, dir)
+			c.dirty = true
+		}
+	}
+}
+
+// fingerprint computes the fingerprint of the inputs of the stack code
+// generation. It fails if the inputs can't be fingerprinted.
+func (c *Cache) fingerprint(root *config.Root, st *config.Stack, vendorDir project.Path) (string, error) {
+	h := sha256.New()
+	add := func(fields ...string) {
+		for _, field := range fields {
+			_, _ = fmt.Fprintf(h, "%d:%s;", len(field), field)
+		}
+	}
+
+	add("terramate", c.tmVersion)
+	add("root", root.HostDir())
+	add("vendor", vendorDir.String())
+	add("stack", st.Dir.String())
+	add("stacks")
+	add(root.Stacks().Strings()...)
+
+	files, err := configFiles(root, st.Dir)
+	if err != nil {
+		return "", err
+	}
+
+	stackdir := st.HostDir(root)
+	var evalctx *hhcl.EvalContext
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", errors.E(err, "reading config file")
+		}
+
+		hash := contentHash(content)
+		add("config", file, hash)
+
+		calls, err := c.funcCalls(file, hash, content)
+		if err != nil {
+			return "", err
+		}
+
+		for _, call := range calls {
+			name := strings.TrimPrefix(call.Name, "tm_")
+			if uncacheableFuncs[name] {
+				return "", errors.E(call.Range(), "%s() results can't be cached", call.Name)
+			}
+			if !fileFuncs[name] || len(call.Args) == 0 {
+				continue
+			}
+
+			if evalctx == nil {
+				evalctx = &hhcl.EvalContext{
+					Functions: stdlib.Functions(stackdir),
+				}
+			}
+
+			if err := addReadFile(h, evalctx, stackdir, call); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// funcCalls returns the tm_ function calls of the config file with the given
+// content hash.
+func (c *Cache) funcCalls(file, hash string, content []byte) ([]*hclsyntax.FunctionCallExpr, error) {
+	c.mu.Lock()
+	calls, ok := c.calls[hash]
+	c.mu.Unlock()
+
+	if ok {
+		return calls, nil
+	}
+
+	parsed, diags := hclsyntax.ParseConfig(content, file, hhcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, errors.E(diags, "parsing config file")
+	}
+
+	calls = []*hclsyntax.FunctionCallExpr{}
+	_ = hclsyntax.VisitAll(parsed.Body.(*hclsyntax.Body), func(node hclsyntax.Node) hhcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok && strings.HasPrefix(call.Name, "tm_") {
+			calls = append(calls, call)
+		}
+		return nil
+	})
+
+	c.mu.Lock()
+	c.calls[hash] = calls
+	c.mu.Unlock()
+
+	return calls, nil
+}
+
+// addReadFile adds the file read by the function call to the fingerprint.
+// The file path must be a constant expression, which is evaluated relative to
+// the stack dir like the tm_file functions do.
+func addReadFile(h hash.Hash, evalctx *hhcl.EvalContext, stackdir string, call *hclsyntax.FunctionCallExpr) error {
+	val, diags := call.Args[0].Value(evalctx)
+	if diags.HasErrors() || !val.IsWhollyKnown() || val.IsNull() || !val.Type().Equals(cty.String) {
+		return errors.E(call.Range(), "%s() reads a file which can't be statically resolved", call.Name)
+	}
+
+	path := val.AsString()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(stackdir, path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.E(call.Range(), err, "reading file of %s()", call.Name)
+	}
+
+	filehash := "missing"
+	if err == nil {
+		filehash = contentHash(content)
+	}
+	_, _ = fmt.Fprintf(h, "%d:%s;%d:%s;", len(path), path, len(filehash), filehash)
+	return nil
+}
+
+// configFiles returns the config files, including the imported ones, from the
+// project root up to the given dir.
+func configFiles(root *config.Root, dir project.Path) ([]string, error) {
+	dirs := []project.Path{dir}
+	for dir.String() != "/" {
+		dir = dir.Dir()
+		dirs = append(dirs, dir)
+	}
+
+	var files []string
+	for i := len(dirs) - 1; i >= 0; i-- {
+		hostdir := dirs[i].HostPath(root.HostDir())
+		filenames, err := fs.ListTerramateFiles(hostdir)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(filenames)
+		for _, filename := range filenames {
+			files = append(files, filepath.Join(hostdir, filename))
+		}
+
+		if node, ok := root.Lookup(dirs[i]); ok {
+			files = append(files, node.Node.ImportedFiles()...)
+		}
+	}
+	return files, nil
+}
+
+// generatedFilesMatch tells if the generated files of the stack on disk
+// match the given cached files.
+func generatedFilesMatch(root *config.Root, st *config.Stack, files map[string]string) bool {
+	stackdir := st.HostDir(root)
+
+	// the files with a header that were not generated must be deleted.
+	onDisk, err := ListGenFiles(root, stackdir)
+	if err != nil {
+		return false
+	}
+	for _, filename := range onDisk {
+		if _, ok := files[filename]; !ok {
+			return false
+		}
+	}
+
+	for filename, hash := range files {
+		content, err := os.ReadFile(filepath.Join(stackdir, filename))
+		if err != nil || contentHash(content) != hash {
+			return false
+		}
+	}
+	return true
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,270 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/event"
+	"github.com/mineiros-io/terramate/generate"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestGenerateWithCache(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack-1",
+		"s:stack-2",
+		`f:generate.tm:generate_file "name.txt" {
+  content = "${terramate.stack.name}-${global.value}"
+}
+`,
+		`f:globals.tm:globals {
+  value = 0
+}
+`,
+		`f:stack-1/globals.tm:globals {
+  value = 1
+}
+`,
+		`f:stack-2/globals.tm:globals {
+  value = 2
+}
+`,
+	})
+
+	cachefile := filepath.Join(t.TempDir(), generate.CacheFile)
+	vendorDir := project.NewPath("/modules")
+
+	generateWithCache := func(version string) generate.Report {
+		t.Helper()
+
+		cache := generate.LoadCache(cachefile, version)
+		report := generate.DoWithCache(s.ReloadConfig(), vendorDir, nil, cache)
+		assert.NoError(t, cache.Save())
+		return report
+	}
+
+	assertUpToDate := func(version string, stack string, want bool) {
+		t.Helper()
+
+		root := s.ReloadConfig()
+		st, err := config.LoadStack(root, project.NewPath(stack))
+		assert.NoError(t, err)
+
+		cache := generate.LoadCache(cachefile, version)
+		got := cache.UpToDate(root, st, vendorDir)
+		if got != want {
+			t.Fatalf("stack %s: got up to date %t, want %t", stack, got, want)
+		}
+	}
+
+	assertEqualReports(t, generateWithCache("v1"), generate.Report{
+		Successes: []generate.Result{
+			{
+				Dir:     project.NewPath("/stack-1"),
+				Created: []string{"name.txt"},
+			},
+			{
+				Dir:     project.NewPath("/stack-2"),
+				Created: []string{"name.txt"},
+			},
+		},
+	})
+
+	assertUpToDate("v1", "/stack-1", true)
+	assertUpToDate("v1", "/stack-2", true)
+	assertEqualReports(t, generateWithCache("v1"), generate.Report{})
+
+	t.Log("other Terramate versions don't use the cache")
+
+	assertUpToDate("v2", "/stack-1", false)
+	assertUpToDate("v2", "/stack-2", false)
+
+	t.Log("config changes are detected")
+
+	s.RootEntry().CreateFile("stack-1/globals.tm", `globals {
+  value = 3
+}
+`)
+	assertUpToDate("v1", "/stack-1", false)
+	assertUpToDate("v1", "/stack-2", true)
+	assertEqualReports(t, generateWithCache("v1"), generate.Report{
+		Successes: []generate.Result{
+			{
+				Dir:     project.NewPath("/stack-1"),
+				Changed: []string{"name.txt"},
+			},
+		},
+	})
+	assert.EqualStrings(t, "stack-1-3", s.StackEntry("stack-1").ReadFile("name.txt"))
+
+	t.Log("changes on generated files are detected")
+
+	s.RootEntry().CreateFile("stack-2/name.txt", "manually changed")
+	assertUpToDate("v1", "/stack-2", false)
+	assertEqualReports(t, generateWithCache("v1"), generate.Report{
+		Successes: []generate.Result{
+			{
+				Dir:     project.NewPath("/stack-2"),
+				Changed: []string{"name.txt"},
+			},
+		},
+	})
+	assert.EqualStrings(t, "stack-2-2", s.StackEntry("stack-2").ReadFile("name.txt"))
+
+	t.Log("orphaned generated files are detected")
+
+	s.BuildTree([]string{genfile("stack-2/orphan.hcl", "a = 1\n")})
+	assertUpToDate("v1", "/stack-2", false)
+	assertEqualReports(t, generateWithCache("v1"), generate.Report{
+		Successes: []generate.Result{
+			{
+				Dir:     project.NewPath("/stack-2"),
+				Deleted: []string{"orphan.hcl"},
+			},
+		},
+	})
+
+	t.Log("new stacks change the stacks list of all stacks")
+
+	s.BuildTree([]string{"s:stack-3"})
+	assertUpToDate("v1", "/stack-1", false)
+	assertUpToDate("v1", "/stack-2", false)
+	assertEqualReports(t, generateWithCache("v1"), generate.Report{
+		Successes: []generate.Result{
+			{
+				Dir:     project.NewPath("/stack-3"),
+				Created: []string{"name.txt"},
+			},
+		},
+	})
+	assertUpToDate("v1", "/stack-1", true)
+	assertUpToDate("v1", "/stack-2", true)
+	assertUpToDate("v1", "/stack-3", true)
+}
+
+func TestGenerateWithCacheFileFunctions(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		"s:dynamic",
+		"s:timestamp",
+		"f:stack/data.txt:data",
+		"f:dynamic/dynamic.txt:data",
+		`f:stack/generate.tm:generate_file "data.txt.copy" {
+  content = tm_file("data.txt")
+}
+`,
+		`f:dynamic/generate.tm:generate_file "data.txt.copy" {
+  content = tm_file("${terramate.stack.name}.txt")
+}
+`,
+		`f:timestamp/generate.tm:generate_file "now.txt" {
+  content = tm_timestamp()
+}
+`,
+	})
+
+	cachefile := filepath.Join(t.TempDir(), generate.CacheFile)
+	vendorDir := project.NewPath("/modules")
+
+	cache := generate.LoadCache(cachefile, "v1")
+	report := generate.DoWithCache(s.Config(), vendorDir, nil, cache)
+	assert.EqualInts(t, 0, len(report.Failures), "unexpected failures: %s", report)
+	assert.NoError(t, cache.Save())
+
+	upToDate := func(stack string) bool {
+		root := s.ReloadConfig()
+		st, err := config.LoadStack(root, project.NewPath(stack))
+		assert.NoError(t, err)
+		return generate.LoadCache(cachefile, "v1").UpToDate(root, st, vendorDir)
+	}
+
+	assert.IsTrue(t, upToDate("/stack"), "stack reading a static file must be cached")
+	assert.IsTrue(t, !upToDate("/dynamic"), "stack reading a dynamic file must not be cached")
+	assert.IsTrue(t, !upToDate("/timestamp"), "stack calling tm_timestamp must not be cached")
+
+	s.RootEntry().CreateFile("stack/data.txt", "changed")
+	assert.IsTrue(t, !upToDate("/stack"), "changes of the read file must be detected")
+}
+
+func TestGenerateWithCacheSendsVendorRequestsOfSkippedStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		`f:stack/generate.tm:generate_file "module.txt" {
+  content = tm_vendor("github.com/mineiros-io/terramate?ref=v1")
+}
+`,
+	})
+
+	cachefile := filepath.Join(t.TempDir(), generate.CacheFile)
+	vendorDir := project.NewPath("/vendor")
+
+	generateWithCache := func() (generate.Report, []event.VendorRequest) {
+		events := make(chan event.VendorRequest)
+		gotEvents := []event.VendorRequest{}
+		eventReceiverDone := make(chan struct{})
+
+		go func() {
+			for event := range events {
+				gotEvents = append(gotEvents, event)
+			}
+			close(eventReceiverDone)
+		}()
+
+		cache := generate.LoadCache(cachefile, "v1")
+		report := generate.DoWithCache(s.Config(), vendorDir, events, cache)
+		assert.NoError(t, cache.Save())
+
+		close(events)
+		<-eventReceiverDone
+		return report, gotEvents
+	}
+
+	wantEvents := []event.VendorRequest{
+		{
+			Source:    test.ParseSource(t, "github.com/mineiros-io/terramate?ref=v1"),
+			VendorDir: vendorDir,
+		},
+	}
+
+	report, events := generateWithCache()
+	assertEqualReports(t, report, generate.Report{
+		Successes: []generate.Result{
+			{
+				Dir:     project.NewPath("/stack"),
+				Created: []string{"module.txt"},
+			},
+		},
+	})
+	test.AssertEqualSets(t, events, wantEvents)
+
+	report, events = generateWithCache()
+	assertEqualReports(t, report, generate.Report{})
+	test.AssertEqualSets(t, events, wantEvents)
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// FileChange is a change code generation would do on a file.
+type FileChange struct {
+	// Path is the project path of the file.
+	Path project.Path
+
+	// OldCode is the code of the file on disk. It's empty if the file is
+	// created.
+	OldCode string
+
+	// NewCode is the generated code of the file. It's empty if the file is
+	// deleted.
+	NewCode string
+
+	// Created tells if the file doesn't exist on disk.
+	Created bool
+
+	// Deleted tells if the file would be deleted.
+	Deleted bool
+}
+
+// Diff returns the unified diff between the code of the file on disk and the
+// generated code.
+func (c FileChange) Diff() string {
+	fromFile := "a" + c.Path.String()
+	if c.Created {
+		fromFile = "/dev/null"
+	}
+	toFile := "b" + c.Path.String()
+	if c.Deleted {
+		toFile = "/dev/null"
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(c.OldCode),
+		B:        splitLines(c.NewCode),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+	if err != nil {
+		// the diff is written to a strings.Builder, which never fails.
+		panic(errors.E(errors.ErrInternal, err, "computing diff of %s", c.Path))
+	}
+	return diff
+}
+
+// splitLines splits the code in lines, keeping the line breaks. A line break
+// is added to the last line if missing.
+func splitLines(code string) []string {
+	if code == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(code, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// fileWriter writes and removes the generated files. In dry run mode, no file
+// is changed and the changes are recorded instead. It's safe to be used by
+// concurrent stack generations.
+type fileWriter struct {
+	rootdir string
+	dryRun  bool
+
+	mu      sync.Mutex
+	changes []FileChange
+}
+
+func (w *fileWriter) write(target string, genfile GenFile) error {
+	if !w.dryRun {
+		return writeGeneratedCode(target, genfile)
+	}
+
+	read := readFile
+	if genfile.Header() != "" {
+		// same check done by writeGeneratedCode.
+		read = readGeneratedFile
+	}
+
+	oldCode, exists, err := read(target)
+	if err != nil {
+		return err
+	}
+
+	w.addChange(FileChange{
+		Path:    project.PrjAbsPath(w.rootdir, target),
+		OldCode: oldCode,
+		NewCode: genfile.Header() + genfile.Body(),
+		Created: !exists,
+	})
+	return nil
+}
+
+func (w *fileWriter) remove(target string) error {
+	if !w.dryRun {
+		return os.Remove(target)
+	}
+
+	oldCode, exists, err := readFile(target)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return &fs.PathError{Op: "remove", Path: target, Err: fs.ErrNotExist}
+	}
+
+	w.addChange(FileChange{
+		Path:    project.PrjAbsPath(w.rootdir, target),
+		OldCode: oldCode,
+		Deleted: true,
+	})
+	return nil
+}
+
+func (w *fileWriter) addChange(change FileChange) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.changes = append(w.changes, change)
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/generate"
+	"github.com/mineiros-io/terramate/generate/genhcl"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/test"
+	errtest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestGenerateCheck(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		`f:stack/generate.tm:generate_hcl "main.tf" {
+  content {
+    a = global.value
+  }
+}
+
+generate_file "removed.txt" {
+  content = "removed"
+}
+`,
+		`f:globals.tm:globals {
+  value = 1
+}
+`,
+		`f:root.tm:generate_file "/root.txt" {
+  context = root
+  content = "root"
+}
+`,
+	})
+
+	report := s.Generate()
+	assert.EqualInts(t, 0, len(report.Failures), "unexpected failures: %s", report)
+
+	report, changes := generate.Check(s.Config(), project.NewPath("/modules"))
+	assert.EqualInts(t, 0, len(report.Failures), "unexpected failures: %s", report)
+	assert.EqualInts(t, 0, len(changes), "unexpected changes: %v", changes)
+
+	s.RootEntry().CreateFile("globals.tm", `globals {
+  value = 2
+}
+`)
+	s.RootEntry().CreateFile("root.tm", `generate_file "/root.txt" {
+  context = root
+  content = "root changed"
+}
+`)
+	stack := s.StackEntry("stack")
+	stack.CreateFile("generate.tm", `generate_hcl "main.tf" {
+  content {
+    a = global.value
+  }
+}
+
+generate_file "new.txt" {
+  content = "new"
+}
+
+generate_file "removed.txt" {
+  condition = false
+  content   = "removed"
+}
+`)
+	s.RootEntry().CreateDir("dir").CreateFile("orphan.tf", genhcl.Header+"\n\norphan = true\n")
+
+	report, changes = generate.Check(s.ReloadConfig(), project.NewPath("/modules"))
+	assert.EqualInts(t, 0, len(report.Failures), "unexpected failures: %s", report)
+
+	header := genhcl.Header + "\n\n"
+	test.AssertDiff(t, changes, []generate.FileChange{
+		{
+			Path:    project.NewPath("/dir/orphan.tf"),
+			OldCode: header + "orphan = true\n",
+			Deleted: true,
+		},
+		{
+			Path:    project.NewPath("/root.txt"),
+			OldCode: "root",
+			NewCode: "root changed",
+		},
+		{
+			Path:    project.NewPath("/stack/main.tf"),
+			OldCode: header + "a = 1\n",
+			NewCode: header + "a = 2\n",
+		},
+		{
+			Path:    project.NewPath("/stack/new.txt"),
+			NewCode: "new",
+			Created: true,
+		},
+		{
+			Path:    project.NewPath("/stack/removed.txt"),
+			OldCode: "removed",
+			Deleted: true,
+		},
+	})
+
+	assert.EqualStrings(t, `--- a/stack/main.tf
++++ b/stack/main.tf
+@@ -1,3 +1,3 @@
+ `+genhcl.Header+`
+ 
+-a = 1
++a = 2
+`, changes[2].Diff())
+
+	assert.EqualStrings(t, `--- /dev/null
++++ b/stack/new.txt
+@@ -0,0 +1 @@
++new
+`, changes[3].Diff())
+
+	// nothing was changed.
+	assert.EqualStrings(t, header+"a = 1\n", stack.ReadFile("main.tf"))
+	assert.EqualStrings(t, "removed", stack.ReadFile("removed.txt"))
+	assert.EqualStrings(t, "root", string(s.RootEntry().ReadFile("root.txt")))
+	assert.EqualStrings(t, header+"orphan = true\n", string(s.RootEntry().ReadFile("dir/orphan.tf")))
+
+	s.Generate()
+
+	_, changes = generate.Check(s.Config(), project.NewPath("/modules"))
+	assert.EqualInts(t, 0, len(changes), "unexpected changes: %v", changes)
+}
+
+func TestGenerateCheckManualCodeExists(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		`f:stack/generate.tm:generate_hcl "main.tf" {
+  content {
+    a = 1
+  }
+}
+`,
+		"f:stack/main.tf:a = 0",
+	})
+
+	report, changes := generate.Check(s.Config(), project.NewPath("/modules"))
+	assert.EqualInts(t, 0, len(changes), "unexpected changes: %v", changes)
+	assert.EqualInts(t, 1, len(report.Failures), "want failure: %s", report)
+	errtest.Assert(t, report.Failures[0].Error, errors.E(generate.ErrManualCodeExists))
+}
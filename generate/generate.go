@@ -20,8 +20,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/mineiros-io/terramate/config"
 	"github.com/mineiros-io/terramate/errors"
@@ -156,6 +158,39 @@ func Load(root *config.Root, vendorDir project.Path) ([]LoadResult, error) {
 	return results, nil
 }
 
+// ListStackVendorRequests lists the vendor requests made by the tm_vendor calls
+// of the generate blocks of the given stack. The given vendorDir is used when
+// calculating the vendor path using tm_vendor.
+func ListStackVendorRequests(
+	root *config.Root,
+	st *config.Stack,
+	vendorDir project.Path,
+) ([]event.VendorRequest, error) {
+	loadres := globals.ForStack(root, st)
+	if err := loadres.AsError(); err != nil {
+		return nil, err
+	}
+
+	vendorRequests := make(chan event.VendorRequest)
+	done := make(chan []event.VendorRequest)
+	go func() {
+		var requests []event.VendorRequest
+		for req := range vendorRequests {
+			requests = append(requests, req)
+		}
+		done <- requests
+	}()
+
+	_, err := loadStackCodeCfgs(root, st, loadres.Globals, vendorDir, vendorRequests)
+	close(vendorRequests)
+	requests := <-done
+
+	if err != nil {
+		return nil, errors.E(err, "while loading configs of stack %s", st.Dir)
+	}
+	return requests, nil
+}
+
 // Do will generate code for the entire configuration.
 //
 // There generation mechanism depend on the generate_* block context attribute:
@@ -188,11 +223,90 @@ func Do(
 	vendorDir project.Path,
 	vendorRequests chan<- event.VendorRequest,
 ) Report {
-	stackReport := forEachStack(root, vendorDir,
-		vendorRequests, doStackGeneration)
-	rootReport := doRootGeneration(root)
+	return do(root, vendorDir, vendorRequests, &fileWriter{}, nil, nil)
+}
+
+// DoWithCache does the same as [Do] but skips the stacks whose generated code
+// is up to date with the given cache, which is updated with the fingerprints
+// of the generated stacks. The vendor requests of the skipped stacks are
+// sent again, so missing vendored modules are still downloaded. Saving the
+// cache is up to the caller.
+func DoWithCache(
+	root *config.Root,
+	vendorDir project.Path,
+	vendorRequests chan<- event.VendorRequest,
+	cache *Cache,
+) Report {
+	return do(root, vendorDir, vendorRequests, &fileWriter{}, cache, nil)
+}
+
+// DoStacks does the same as [DoWithCache] but only for the given stacks. The
+// generate blocks with root context and the orphaned files outside of stacks
+// are not handled, since they don't belong to any stack. The cache can be
+// nil.
+func DoStacks(
+	root *config.Root,
+	vendorDir project.Path,
+	vendorRequests chan<- event.VendorRequest,
+	cache *Cache,
+	stacks project.Paths,
+) Report {
+	return do(root, vendorDir, vendorRequests, &fileWriter{}, cache, newStackFilter(stacks))
+}
+
+// Check does the same as [Do] but without changing any file. Instead, the
+// changes code generation would do are returned, sorted by path, together
+// with the report of the code generation that would happen. The tm_vendor
+// calls are not handled.
+func Check(root *config.Root, vendorDir project.Path) (Report, []FileChange) {
+	return check(root, vendorDir, nil)
+}
+
+// CheckStacks does the same as [Check] but only for the given stacks, like
+// [DoStacks] does.
+func CheckStacks(root *config.Root, vendorDir project.Path, stacks project.Paths) (Report, []FileChange) {
+	return check(root, vendorDir, newStackFilter(stacks))
+}
+
+func check(root *config.Root, vendorDir project.Path, filter stackFilter) (Report, []FileChange) {
+	w := &fileWriter{
+		rootdir: root.HostDir(),
+		dryRun:  true,
+	}
+	report := do(root, vendorDir, nil, w, nil, filter)
+	sort.Slice(w.changes, func(i, j int) bool {
+		return w.changes[i].Path.String() < w.changes[j].Path.String()
+	})
+	return report, w.changes
+}
+
+func do(
+	root *config.Root,
+	vendorDir project.Path,
+	vendorRequests chan<- event.VendorRequest,
+	w *fileWriter,
+	cache *Cache,
+	filter stackFilter,
+) Report {
+	stackReport := forEachStack(root, vendorDir, vendorRequests, cache, filter,
+		func(
+			root *config.Root,
+			stack *config.Stack,
+			globals *eval.Object,
+			vendorDir project.Path,
+			vendorRequests chan<- event.VendorRequest,
+		) dirReport {
+			return doStackGeneration(root, stack, globals, vendorDir, vendorRequests, w)
+		})
+
+	if filter != nil {
+		stackReport.sort()
+		return stackReport
+	}
+
+	rootReport := doRootGeneration(root, w)
 	report := mergeReports(stackReport, rootReport)
-	return cleanupOrphaned(root, report)
+	return cleanupOrphaned(root, report, w)
 }
 
 func doStackGeneration(
@@ -201,6 +315,7 @@ func doStackGeneration(
 	globals *eval.Object,
 	vendorDir project.Path,
 	vendorRequests chan<- event.VendorRequest,
+	w *fileWriter,
 ) dirReport {
 	stackpath := stack.HostDir(root)
 	logger := log.With().
@@ -208,7 +323,9 @@ func doStackGeneration(
 		Stringer("stack", stack.Dir).
 		Logger()
 
-	report := dirReport{}
+	report := dirReport{
+		files: map[string]string{},
+	}
 
 	logger.Debug().Msg("generating files")
 
@@ -255,12 +372,13 @@ func doStackGeneration(
 		}
 
 		body := file.Header() + file.Body()
+		report.files[filename] = body
 
 		// Change detection + remove entries that got re-generated
 		oldFileBody, oldExists := allFiles[filename]
 
 		if !oldExists || oldFileBody != body {
-			err := writeGeneratedCode(path, file)
+			err := w.write(path, file)
 			if err != nil {
 				report.err = errors.E(err, "saving file %q", filename)
 				return report
@@ -296,7 +414,7 @@ func doStackGeneration(
 		report.addDeletedFile(filename)
 
 		path := filepath.Join(stackpath, filename)
-		err = os.Remove(path)
+		err = w.remove(path)
 		if err != nil {
 			report.err = errors.E("removing file %s", filename)
 			return report
@@ -309,7 +427,7 @@ func doStackGeneration(
 	return report
 }
 
-func doRootGeneration(root *config.Root) Report {
+func doRootGeneration(root *config.Root, w *fileWriter) Report {
 	logger := log.With().
 		Str("action", "generate.doRootGeneration").
 		Logger()
@@ -383,7 +501,7 @@ func doRootGeneration(root *config.Root) Report {
 
 	logger.Debug().Msg("no conflicts found")
 
-	generateRootFiles(root, files, &report)
+	generateRootFiles(root, files, &report, w)
 	return report
 }
 
@@ -487,7 +605,7 @@ processSubdirs:
 				return nil, errors.E(err, "checking if file is generated %q", file)
 			}
 
-			if hasGenHCLHeader(string(data)) {
+			if hasGenCodeHeader(string(data)) {
 				genfiles = append(genfiles, filepath.ToSlash(
 					filepath.Join(relSubdir, entry.Name())))
 			}
@@ -735,7 +853,7 @@ func readGeneratedFile(path string) (string, bool, error) {
 
 	logger.Trace().Msg("Check if file has terramate header.")
 
-	if hasGenHCLHeader(data) {
+	if hasGenCodeHeader(data) {
 		return data, true, nil
 	}
 
@@ -786,6 +904,8 @@ func forEachStack(
 	root *config.Root,
 	vendorDir project.Path,
 	vendorRequests chan<- event.VendorRequest,
+	cache *Cache,
+	filter stackFilter,
 	fn forEachStackFunc,
 ) Report {
 	logger := log.With().
@@ -803,26 +923,148 @@ func forEachStack(
 		return report
 	}
 
-	for _, elem := range stacks {
-		logger := logger.With().
-			Stringer("stack", elem).
-			Logger()
+	cache.prune(stacks)
+
+	if filter != nil {
+		selected := config.List[*config.SortableStack]{}
+		for _, elem := range stacks {
+			if filter[elem.Dir()] {
+				selected = append(selected, elem)
+			}
+		}
+		stacks = selected
+	}
+
+	// The stacks are generated concurrently, which is safe because each
+	// stack owns the files of its own directory (and subdirs that are not
+	// stacks). The results are collected by index so the report keeps the
+	// same order of the stacks.
+	results := make([]stackResult, len(stacks))
+	indexes := make(chan int)
+
+	workers := runtime.NumCPU()
+	if workers > len(stacks) {
+		workers = len(stacks)
+	}
+
+	logger.Trace().
+		Int("workers", workers).
+		Msg("Generating stacks.")
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				elem := stacks[i]
+				logger := logger.With().
+					Stringer("stack", elem).
+					Logger()
+
+				fingerprint, upToDate := cache.lookup(root, elem.Stack, vendorDir)
+				if upToDate {
+					logger.Debug().Msg("Generated code is up to date, skipping stack.")
+
+					if vendorRequests != nil {
+						for _, req := range cache.vendorRequests(elem.Dir(), vendorDir) {
+							vendorRequests <- req
+						}
+					}
+					continue
+				}
+
+				logger.Trace().Msg("Load stack globals.")
+
+				globalsReport := globals.ForStack(root, elem.Stack)
+				if err := globalsReport.AsError(); err != nil {
+					results[i].err = errors.E(ErrLoadingGlobals, err)
+					cache.remove(elem.Dir())
+					continue
+				}
+
+				logger.Trace().Msg("Calling stack callback.")
+
+				if cache == nil {
+					results[i].report = fn(root, elem.Stack, globalsReport.Globals, vendorDir, vendorRequests)
+					continue
+				}
+
+				stackRequests, recorded := recordVendorRequests(vendorRequests)
+				stackReport := fn(root, elem.Stack, globalsReport.Globals, vendorDir, stackRequests)
+				requests := recorded()
 
-		logger.Trace().Msg("Load stack globals.")
+				if stackReport.isSuccess() {
+					cache.store(elem.Dir(), fingerprint, stackReport.files, requests)
+				} else {
+					cache.remove(elem.Dir())
+				}
+				results[i].report = stackReport
+			}
+		}()
+	}
+
+	for i := range stacks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-		globalsReport := globals.ForStack(root, elem.Stack)
-		if err := globalsReport.AsError(); err != nil {
-			report.addFailure(elem.Dir(), errors.E(ErrLoadingGlobals, err))
+	for i, elem := range stacks {
+		if err := results[i].err; err != nil {
+			report.addFailure(elem.Dir(), err)
 			continue
 		}
+		report.addDirReport(elem.Dir(), results[i].report)
+	}
+
+	return report
+}
+
+// recordVendorRequests returns a channel which forwards the vendor requests
+// to the given channel, if not nil, and a function which stops forwarding and
+// returns all the forwarded requests.
+func recordVendorRequests(
+	vendorRequests chan<- event.VendorRequest,
+) (chan<- event.VendorRequest, func() []event.VendorRequest) {
+	requests := make(chan event.VendorRequest)
+	done := make(chan struct{})
+
+	var recorded []event.VendorRequest
+	go func() {
+		for req := range requests {
+			recorded = append(recorded, req)
+			if vendorRequests != nil {
+				vendorRequests <- req
+			}
+		}
+		close(done)
+	}()
+
+	return requests, func() []event.VendorRequest {
+		close(requests)
+		<-done
+		return recorded
+	}
+}
 
-		logger.Trace().Msg("Calling stack callback.")
+// stackFilter is the set of stacks to generate. A nil filter selects all
+// stacks.
+type stackFilter map[project.Path]bool
 
-		stackReport := fn(root, elem.Stack, globalsReport.Globals, vendorDir, vendorRequests)
-		report.addDirReport(elem.Dir(), stackReport)
+func newStackFilter(stacks project.Paths) stackFilter {
+	filter := stackFilter{}
+	for _, dir := range stacks {
+		filter[dir] = true
 	}
+	return filter
+}
 
-	return report
+// stackResult is the result of the generation of a single stack.
+type stackResult struct {
+	report dirReport
+	err    error
 }
 
 func allStackGeneratedFiles(
@@ -863,7 +1105,7 @@ func allStackGeneratedFiles(
 	return allFiles, nil
 }
 
-func generateRootFiles(root *config.Root, genfiles []GenFile, report *Report) {
+func generateRootFiles(root *config.Root, genfiles []GenFile, report *Report, w *fileWriter) {
 	logger := log.With().
 		Str("action", "generate.generateRootFiles()").
 		Logger()
@@ -932,7 +1174,7 @@ func generateRootFiles(root *config.Root, genfiles []GenFile, report *Report) {
 			dirReport := dirReport{}
 			dir := path.Dir(label)
 
-			err := os.Remove(abspath)
+			err := w.remove(abspath)
 			if err != nil {
 				dirReport.err = errors.E(err, "deleting file")
 			} else {
@@ -963,7 +1205,7 @@ func generateRootFiles(root *config.Root, genfiles []GenFile, report *Report) {
 				Bool("fileChanged", body != diskContent).
 				Msg("writing file")
 
-			err := writeGeneratedCode(abspath, genfile)
+			err := w.write(abspath, genfile)
 			if err != nil {
 				dirReport.err = errors.E(err, "saving file %s", label)
 				report.addDirReport(dir, dirReport)
@@ -990,7 +1232,7 @@ func genFileLogger(logger zerolog.Logger, genfile GenFile) zerolog.Logger {
 }
 
 func genFileBlockLogger(logger zerolog.Logger, block hcl.GenFileBlock) zerolog.Logger {
-	return genBlockLogger(logger, "generate_file", block.Label, block.Context)
+	return genBlockLogger(logger, block.BlockType(), block.Label, block.Context)
 }
 
 func genBlockLogger(logger zerolog.Logger, blockname, label, context string) zerolog.Logger {
@@ -1000,10 +1242,10 @@ func genBlockLogger(logger zerolog.Logger, blockname, label, context string) zer
 		Logger()
 }
 
-func hasGenHCLHeader(code string) bool {
+func hasGenCodeHeader(code string) bool {
 	// When changing headers we need to support old ones (or break).
 	// For now keeping them here, to avoid breaks.
-	for _, header := range []string{genhcl.Header, genhcl.HeaderV0} {
+	for _, header := range []string{genhcl.Header, genhcl.HeaderV0, genfile.YAMLHeader} {
 		if strings.HasPrefix(code, header) {
 			return true
 		}
@@ -1133,8 +1375,8 @@ func validateRootGenerateBlock(root *config.Root, block hcl.GenFileBlock) error
 		if config.IsStack(root, destdir) {
 			return errors.E(ErrInvalidGenBlockLabel,
 				block.Range,
-				"%s: generate_file.context=root generates inside a stack %s",
-				target,
+				"%s: %s.context=root generates inside a stack %s",
+				target, block.BlockType(),
 				project.PrjAbsPath(root.HostDir(), destdir),
 			)
 		}
@@ -1287,7 +1529,7 @@ func loadStackCodeCfgs(
 	return genfilesConfigs, nil
 }
 
-func cleanupOrphaned(root *config.Root, report Report) Report {
+func cleanupOrphaned(root *config.Root, report Report, w *fileWriter) Report {
 	logger := log.With().
 		Str("action", "generate.cleanupOrphaned()").
 		Logger()
@@ -1313,7 +1555,7 @@ func cleanupOrphaned(root *config.Root, report Report) Report {
 	for _, genfile := range orphanedGenFiles {
 		genfileAbspath := filepath.Join(root.HostDir(), genfile)
 		dir := project.NewPath("/" + filepath.ToSlash(filepath.Dir(genfile)))
-		if err := os.Remove(genfileAbspath); err != nil {
+		if err := w.remove(genfileAbspath); err != nil {
 			if deleteFailures[dir] == nil {
 				deleteFailures[dir] = errors.L()
 			}
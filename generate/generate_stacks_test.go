@@ -0,0 +1,103 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/generate"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestGenerateStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stacks/a",
+		"s:stacks/b",
+		"s:other",
+		genfile("stacks/a/orphan.hcl", "a = 1\n"),
+		genfile("stacks/b/orphan.hcl", "b = 1\n"),
+		genfile("dir/orphan.hcl", "dir = 1\n"),
+		`f:generate.tm:generate_file "name.txt" {
+  content = terramate.stack.name
+}
+
+generate_file "/root.txt" {
+  context = root
+  content = "root"
+}
+`,
+	})
+
+	vendorDir := project.NewPath("/modules")
+	stacks := project.Paths{
+		project.NewPath("/stacks/a"),
+		project.NewPath("/other"),
+	}
+
+	report, changes := generate.CheckStacks(s.Config(), vendorDir, stacks)
+	assert.EqualInts(t, 0, len(report.Failures), "unexpected failures: %s", report)
+
+	gotChanged := []string{}
+	for _, change := range changes {
+		gotChanged = append(gotChanged, change.Path.String())
+	}
+	test.AssertDiff(t, gotChanged, []string{
+		"/other/name.txt",
+		"/stacks/a/name.txt",
+		"/stacks/a/orphan.hcl",
+	})
+
+	assertEqualReports(t, generate.DoStacks(s.Config(), vendorDir, nil, nil, stacks), generate.Report{
+		Successes: []generate.Result{
+			{
+				Dir:     project.NewPath("/other"),
+				Created: []string{"name.txt"},
+			},
+			{
+				Dir:     project.NewPath("/stacks/a"),
+				Created: []string{"name.txt"},
+				Deleted: []string{"orphan.hcl"},
+			},
+		},
+	})
+
+	assertEqualReports(t, generate.DoStacks(s.Config(), vendorDir, nil, nil, project.Paths{}), generate.Report{})
+
+	t.Log("the other stacks, root files and orphans outside stacks are left untouched")
+
+	assertEqualReports(t, s.Generate(), generate.Report{
+		Successes: []generate.Result{
+			{
+				Dir:     project.NewPath("/"),
+				Created: []string{"root.txt"},
+			},
+			{
+				Dir:     project.NewPath("/dir"),
+				Deleted: []string{"orphan.hcl"},
+			},
+			{
+				Dir:     project.NewPath("/stacks/b"),
+				Created: []string{"name.txt"},
+				Deleted: []string{"orphan.hcl"},
+			},
+		},
+	})
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/generate"
+	genfilepkg "github.com/mineiros-io/terramate/generate/genfile"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/test"
+	. "github.com/mineiros-io/terramate/test/hclwrite/hclutils"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestGenerateStructuredFiles(t *testing.T) {
+	t.Parallel()
+
+	testCodeGeneration(t, []testcase{
+		{
+			name: "generate_json and generate_yaml on stacks",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stacks",
+					add: Doc(
+						GenerateJSON(
+							Labels("config.json"),
+							Expr("content", `{
+								stack = terramate.stack.path.absolute
+								tags  = ["a", "b"]
+							}`),
+						),
+						GenerateYAML(
+							Labels("k8s/namespace.yaml"),
+							Expr("content", `{
+								kind = "Namespace"
+								metadata = {
+									name = terramate.stack.name
+								}
+							}`),
+						),
+					),
+				},
+			},
+			want: []generatedFile{
+				{
+					dir: "/stacks/stack-1",
+					files: map[string]fmt.Stringer{
+						"config.json": stringer(`{
+  "stack": "/stacks/stack-1",
+  "tags": [
+    "a",
+    "b"
+  ]
+}`),
+						"k8s/namespace.yaml": stringer(genfilepkg.YAMLHeader + `
+
+"kind": "Namespace"
+"metadata":
+  "name": "stack-1"`),
+					},
+				},
+				{
+					dir: "/stacks/stack-2",
+					files: map[string]fmt.Stringer{
+						"config.json": stringer(`{
+  "stack": "/stacks/stack-2",
+  "tags": [
+    "a",
+    "b"
+  ]
+}`),
+						"k8s/namespace.yaml": stringer(genfilepkg.YAMLHeader + `
+
+"kind": "Namespace"
+"metadata":
+  "name": "stack-2"`),
+					},
+				},
+			},
+			wantReport: generate.Report{
+				Successes: []generate.Result{
+					{
+						Dir:     project.NewPath("/stacks/stack-1"),
+						Created: []string{"config.json", "k8s/namespace.yaml"},
+					},
+					{
+						Dir:     project.NewPath("/stacks/stack-2"),
+						Created: []string{"config.json", "k8s/namespace.yaml"},
+					},
+				},
+			},
+		},
+		{
+			name: "generate_json conflicts with generate_file",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stack",
+					add: Doc(
+						GenerateJSON(
+							Labels("file.json"),
+							Expr("content", `{}`),
+						),
+						GenerateFile(
+							Labels("file.json"),
+							Str("content", "{}"),
+						),
+					),
+				},
+			},
+			wantReport: generate.Report{
+				Failures: []generate.FailureResult{
+					{
+						Result: generate.Result{
+							Dir: project.NewPath("/stack"),
+						},
+						Error: errors.E(generate.ErrConflictingConfig),
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestGenerateStructuredFilesOutdatedAndCleanup(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		`f:stack/generate.tm:generate_yaml "file.yaml" {
+  content = {
+    a = global.value
+  }
+}
+
+generate_json "file.json" {
+  content = {
+    a = global.value
+  }
+}
+`,
+		`f:globals.tm:globals {
+  value = 1
+}
+`,
+	})
+
+	report := s.Generate()
+	assert.EqualInts(t, 0, len(report.Failures), "unexpected failures: %s", report)
+
+	stack := s.StackEntry("stack")
+	assert.EqualStrings(t, genfilepkg.YAMLHeader+"\n\n\"a\": 1\n", stack.ReadFile("file.yaml"))
+	assert.EqualStrings(t, "{\n  \"a\": 1\n}\n", stack.ReadFile("file.json"))
+
+	outdated, err := generate.DetectOutdated(s.Config(), project.NewPath("/modules"))
+	assert.NoError(t, err)
+	assertEqualStringList(t, outdated, []string{})
+
+	s.RootEntry().CreateFile("globals.tm", `globals {
+  value = 2
+}
+`)
+
+	outdated, err = generate.DetectOutdated(s.ReloadConfig(), project.NewPath("/modules"))
+	assert.NoError(t, err)
+	assertEqualStringList(t, outdated, []string{"stack/file.json", "stack/file.yaml"})
+
+	// the YAML files have a header, so they are deleted when the block is
+	// removed.
+	stack.CreateFile("generate.tm", `generate_json "file.json" {
+  content = {
+    a = global.value
+  }
+}
+`)
+
+	s.ReloadConfig()
+	report = s.Generate()
+	test.AssertDiff(t, report.Successes, []generate.Result{
+		{
+			Dir:     project.NewPath("/stack"),
+			Changed: []string{"file.json"},
+			Deleted: []string{"file.yaml"},
+		},
+	})
+}
@@ -12,10 +12,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package genfile implements generate_file code generation.
+// Package genfile implements generate_file, generate_json and generate_yaml
+// code generation.
 package genfile
 
 import (
+	"bytes"
+	stdjson "encoding/json"
 	"fmt"
 	"path"
 	"sort"
@@ -31,7 +34,9 @@ import (
 	"github.com/mineiros-io/terramate/lets"
 	"github.com/mineiros-io/terramate/project"
 	"github.com/mineiros-io/terramate/stack"
+	"github.com/zclconf/go-cty-yaml"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/json"
 )
 
 const (
@@ -54,6 +59,11 @@ const (
 	ErrLabelConflict errors.Kind = "label conflict detected"
 )
 
+// YAMLHeader is the header of the files generated by generate_yaml blocks.
+// The JSON format has no comments, so the files generated by generate_json
+// blocks have no header.
+const YAMLHeader = "# TERRAMATE: GENERATED AUTOMATICALLY DO NOT EDIT"
+
 const (
 	// StackContext is the stack context name.
 	StackContext = "stack"
@@ -62,11 +72,13 @@ const (
 	RootContext = "root"
 )
 
-// File represents generated file from a single generate_file block.
+// File represents generated file from a single generate_file, generate_json
+// or generate_yaml block.
 type File struct {
 	label     string
 	context   string
 	origin    info.Range
+	format    hcl.GenFileFormat
 	body      string
 	condition bool
 	asserts   []config.Assert
@@ -107,12 +119,16 @@ func (f File) Asserts() []config.Assert {
 
 // Header returns the header of this file.
 func (f File) Header() string {
+	if f.format == hcl.GenFileYAML {
+		return YAMLHeader + "\n\n"
+	}
 	// For now we don't support headers for arbitrary files
 	return ""
 }
 
 func (f File) String() string {
-	return fmt.Sprintf("generate_file %q (condition %t) (body %q) (origin %q)",
+	return fmt.Sprintf("%s %q (condition %t) (body %q) (origin %q)",
+		hcl.GenFileBlock{Format: f.format}.BlockType(),
 		f.Label(), f.Condition(), f.Body(), f.Range().Path())
 }
 
@@ -197,6 +213,7 @@ func Eval(block hcl.GenFileBlock, evalctx *eval.Context) (File, error) {
 		return File{
 			label:     name,
 			origin:    block.Range,
+			format:    block.Format,
 			condition: condition,
 			context:   block.Context,
 		}, nil
@@ -226,6 +243,7 @@ func Eval(block hcl.GenFileBlock, evalctx *eval.Context) (File, error) {
 		return File{
 			label:     name,
 			origin:    block.Range,
+			format:    block.Format,
 			condition: condition,
 			context:   block.Context,
 			asserts:   asserts,
@@ -237,18 +255,16 @@ func Eval(block hcl.GenFileBlock, evalctx *eval.Context) (File, error) {
 		return File{}, errors.E(ErrContentEval, err)
 	}
 
-	if value.Type() != cty.String {
-		return File{}, errors.E(
-			ErrInvalidContentType,
-			"content has type %s but must be string",
-			value.Type().FriendlyName(),
-		)
+	body, err := render(block.Format, value)
+	if err != nil {
+		return File{}, err
 	}
 
 	return File{
 		label:     name,
 		origin:    block.Range,
-		body:      value.AsString(),
+		format:    block.Format,
+		body:      body,
 		condition: condition,
 		context:   block.Context,
 		asserts:   asserts,
@@ -279,3 +295,47 @@ func loadGenFileBlocks(tree *config.Root, cfgdir project.Path) ([]hcl.GenFileBlo
 	res = append(res, parentRes...)
 	return res, nil
 }
+
+// render renders the evaluated content of a block as the file body of the
+// given format. Objects are rendered with their keys sorted, so the same
+// content always renders the same body.
+func render(format hcl.GenFileFormat, value cty.Value) (string, error) {
+	if format == hcl.GenFileRaw {
+		if value.Type() != cty.String {
+			return "", errors.E(
+				ErrInvalidContentType,
+				"content has type %s but must be string",
+				value.Type().FriendlyName(),
+			)
+		}
+		return value.AsString(), nil
+	}
+
+	if !value.Type().IsObjectType() && !value.Type().IsMapType() {
+		return "", errors.E(
+			ErrInvalidContentType,
+			"content has type %s but must be an object",
+			value.Type().FriendlyName(),
+		)
+	}
+
+	if format == hcl.GenFileYAML {
+		data, err := yaml.Standard.Marshal(value)
+		if err != nil {
+			return "", errors.E(ErrContentEval, err, "rendering content as YAML")
+		}
+		return string(data), nil
+	}
+
+	data, err := json.Marshal(value, value.Type())
+	if err != nil {
+		return "", errors.E(ErrContentEval, err, "rendering content as JSON")
+	}
+
+	var body bytes.Buffer
+	if err := stdjson.Indent(&body, data, "", "  "); err != nil {
+		return "", errors.E(ErrContentEval, err, "rendering content as JSON")
+	}
+	body.WriteString("\n")
+	return body.String(), nil
+}
@@ -947,6 +947,7 @@ type (
 	}
 	genFile struct {
 		origin    info.Range
+		header    string
 		body      string
 		condition bool
 		asserts   []config.Assert
@@ -1025,6 +1026,9 @@ func testGenfile(t *testing.T, tcase testcase) {
 			assert.EqualStrings(t, wantbody, gotbody,
 				"generated file body differs",
 			)
+			assert.EqualStrings(t, want.file.header, gotfile.Header(),
+				"generated file header differs",
+			)
 		}
 	})
 }
@@ -0,0 +1,286 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package genfile_test
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/generate/genfile"
+	"github.com/mineiros-io/terramate/hcl"
+	. "github.com/mineiros-io/terramate/test/hclutils"
+	. "github.com/mineiros-io/terramate/test/hclwrite/hclutils"
+)
+
+func TestLoadGenerateStructuredFiles(t *testing.T) {
+	t.Parallel()
+
+	const yamlHeader = genfile.YAMLHeader + "\n\n"
+
+	tcases := []testcase{
+		{
+			name:  "empty object",
+			stack: "/stack",
+			configs: []hclconfig{
+				{
+					path: "/stack/test.tm",
+					add: Doc(
+						GenerateJSON(
+							Labels("test.json"),
+							Expr("content", `{}`),
+						),
+						GenerateYAML(
+							Labels("test.yaml"),
+							Expr("content", `{}`),
+						),
+					),
+				},
+			},
+			want: []result{
+				{
+					name: "test.json",
+					file: genFile{
+						body:      "{}\n",
+						condition: true,
+					},
+				},
+				{
+					name: "test.yaml",
+					file: genFile{
+						header:    yamlHeader,
+						body:      "{}\n",
+						condition: true,
+					},
+				},
+			},
+		},
+		{
+			name:  "keys are sorted",
+			stack: "/stack",
+			configs: []hclconfig{
+				{
+					path: "/stack/test.tm",
+					add: Doc(
+						GenerateJSON(
+							Labels("test.json"),
+							Expr("content", `{
+								b = 1
+								a = "str"
+								c = {
+									list = ["a", true, null]
+									d    = 2.5
+								}
+							}`),
+						),
+						GenerateYAML(
+							Labels("test.yaml"),
+							Expr("content", `{
+								b = 1
+								a = "str"
+								c = {
+									list = ["a", true, null]
+									d    = 2.5
+								}
+							}`),
+						),
+					),
+				},
+			},
+			want: []result{
+				{
+					name: "test.json",
+					file: genFile{
+						condition: true,
+						body: `{
+  "a": "str",
+  "b": 1,
+  "c": {
+    "d": 2.5,
+    "list": [
+      "a",
+      true,
+      null
+    ]
+  }
+}
+`,
+					},
+				},
+				{
+					name: "test.yaml",
+					file: genFile{
+						condition: true,
+						header:    yamlHeader,
+						body: `"a": "str"
+"b": 1
+"c":
+  "d": 2.5
+  "list":
+  - "a"
+  - true
+  - null
+`,
+					},
+				},
+			},
+		},
+		{
+			name:  "lets, metadata and globals are available",
+			stack: "/stack",
+			configs: []hclconfig{
+				{
+					path: "/globals.tm",
+					add: Globals(
+						Str("namespace", "prod"),
+					),
+				},
+				{
+					path: "/stack/test.tm",
+					add: GenerateYAML(
+						Labels("manifests/namespace.yaml"),
+						Lets(
+							Expr("name", `"${global.namespace}-${terramate.stack.name}"`),
+						),
+						Expr("content", `{
+							apiVersion = "v1"
+							kind       = "Namespace"
+							metadata = {
+								name = let.name
+							}
+						}`),
+					),
+				},
+			},
+			want: []result{
+				{
+					name: "manifests/namespace.yaml",
+					file: genFile{
+						condition: true,
+						header:    yamlHeader,
+						body: `"apiVersion": "v1"
+"kind": "Namespace"
+"metadata":
+  "name": "prod-stack"
+`,
+					},
+				},
+			},
+		},
+		{
+			name:  "condition false generates nothing",
+			stack: "/stack",
+			configs: []hclconfig{
+				{
+					path: "/stack/test.tm",
+					add: GenerateJSON(
+						Labels("test.json"),
+						Bool("condition", false),
+						Expr("content", `{
+							a = 1
+						}`),
+					),
+				},
+			},
+			want: []result{
+				{
+					name: "test.json",
+					file: genFile{
+						condition: false,
+					},
+				},
+			},
+		},
+		{
+			name:  "failed assertion generates nothing",
+			stack: "/stack",
+			configs: []hclconfig{
+				{
+					path: "/stack/test.tm",
+					add: GenerateJSON(
+						Labels("test.json"),
+						Assert(
+							Bool("assertion", false),
+							Str("message", "msg"),
+						),
+						Expr("content", `{
+							a = 1
+						}`),
+					),
+				},
+			},
+			want: []result{
+				{
+					name: "test.json",
+					file: genFile{
+						condition: true,
+						asserts: []config.Assert{
+							{
+								Range:     Mkrange("/stack/test.tm", Start(4, 17, 56), End(4, 22, 61)),
+								Assertion: false,
+								Message:   "msg",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "string content fails",
+			stack: "/stack",
+			configs: []hclconfig{
+				{
+					path: "/stack/test.tm",
+					add: GenerateJSON(
+						Labels("test.json"),
+						Str("content", "{}"),
+					),
+				},
+			},
+			wantErr: errors.E(genfile.ErrInvalidContentType),
+		},
+		{
+			name:  "list content fails",
+			stack: "/stack",
+			configs: []hclconfig{
+				{
+					path: "/stack/test.tm",
+					add: GenerateYAML(
+						Labels("test.yaml"),
+						Expr("content", `["a"]`),
+					),
+				},
+			},
+			wantErr: errors.E(genfile.ErrInvalidContentType),
+		},
+		{
+			name:  "block without content fails",
+			stack: "/stack",
+			configs: []hclconfig{
+				{
+					path: "/stack/test.tm",
+					add: GenerateYAML(
+						Labels("test.yaml"),
+					),
+				},
+			},
+			wantErr: errors.E(hcl.ErrTerramateSchema),
+		},
+	}
+
+	for _, tcase := range tcases {
+		testGenfile(t, tcase)
+	}
+}
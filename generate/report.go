@@ -287,6 +287,9 @@ type dirReport struct {
 	changed []string
 	deleted []string
 	err     error
+
+	// files are the generated files and their code, keyed by label.
+	files map[string]string
 }
 
 func (s *dirReport) addCreatedFile(filename string) {
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/config"
 	"github.com/mineiros-io/terramate/event"
 	"github.com/mineiros-io/terramate/generate"
 	"github.com/mineiros-io/terramate/project"
@@ -337,3 +339,113 @@ func TestGenerateVendorRequestEvents(t *testing.T) {
 
 	test.AssertEqualSets(t, gotEvents, wantEvents)
 }
+
+func TestGenerateVendorRequestEventsFromManyStacks(t *testing.T) {
+	t.Parallel()
+
+	// the stacks are generated concurrently, but the events must all be
+	// sent and the report must keep the order of the stacks.
+	const nstacks = 50
+
+	s := sandbox.New(t)
+
+	layout := []string{}
+	for i := 0; i < nstacks; i++ {
+		layout = append(layout, fmt.Sprintf("s:stacks/stack-%02d", i))
+	}
+	s.BuildTree(layout)
+
+	s.RootEntry().CreateFile("config.tm", Doc(
+		GenerateFile(
+			Labels("file.txt"),
+			Expr("content", `tm_vendor("github.com/mineiros-io/terramate?ref=${terramate.stack.name}")`),
+		),
+	).String())
+
+	vendorDir := project.NewPath("/vendor")
+	events := make(chan event.VendorRequest)
+	gotEvents := []event.VendorRequest{}
+	eventReceiverDone := make(chan struct{})
+
+	go func() {
+		for event := range events {
+			gotEvents = append(gotEvents, event)
+		}
+		close(eventReceiverDone)
+	}()
+
+	report := generate.Do(s.Config(), vendorDir, events)
+
+	close(events)
+	<-eventReceiverDone
+
+	wantReport := generate.Report{}
+	wantEvents := []event.VendorRequest{}
+	for i := 0; i < nstacks; i++ {
+		name := fmt.Sprintf("stack-%02d", i)
+		wantReport.Successes = append(wantReport.Successes, generate.Result{
+			Dir:     project.NewPath("/stacks/" + name),
+			Created: []string{"file.txt"},
+		})
+		wantEvents = append(wantEvents, event.VendorRequest{
+			Source:    test.ParseSource(t, "github.com/mineiros-io/terramate?ref="+name),
+			VendorDir: vendorDir,
+		})
+
+		got := s.StackEntry("stacks/" + name).ReadFile("file.txt")
+		assert.EqualStrings(t, "../../vendor/github.com/mineiros-io/terramate/"+name, got)
+	}
+
+	assertEqualReports(t, report, wantReport)
+	test.AssertEqualSets(t, gotEvents, wantEvents)
+}
+
+func TestListStackVendorRequests(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		"s:other",
+	})
+
+	s.RootEntry().CreateFile("stack/config.tm", Doc(
+		GenerateHCL(
+			Labels("file.hcl"),
+			Content(
+				Expr("vendor", `tm_vendor("github.com/mineiros-io/terramate?ref=v1")`),
+			),
+		),
+		GenerateFile(
+			Labels("file.txt"),
+			Expr("content", `tm_vendor("github.com/mineiros-io/terramate?ref=v2")`),
+		),
+	).String())
+
+	vendorDir := project.NewPath("/vendor")
+	root := s.Config()
+
+	stack, err := config.LoadStack(root, project.NewPath("/stack"))
+	assert.NoError(t, err)
+
+	requests, err := generate.ListStackVendorRequests(root, stack, vendorDir)
+	assert.NoError(t, err)
+
+	test.AssertEqualSets(t, requests, []event.VendorRequest{
+		{
+			Source:    test.ParseSource(t, "github.com/mineiros-io/terramate?ref=v1"),
+			VendorDir: vendorDir,
+		},
+		{
+			Source:    test.ParseSource(t, "github.com/mineiros-io/terramate?ref=v2"),
+			VendorDir: vendorDir,
+		},
+	})
+
+	other, err := config.LoadStack(root, project.NewPath("/other"))
+	assert.NoError(t, err)
+
+	requests, err = generate.ListStackVendorRequests(root, other, vendorDir)
+	assert.NoError(t, err)
+	assert.EqualInts(t, 0, len(requests), "unexpected requests: %+v", requests)
+}
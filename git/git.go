@@ -15,6 +15,8 @@
 package git
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
@@ -72,6 +74,12 @@ type (
 		Branches []string
 	}
 
+	// Blob is a file of a git tree.
+	Blob struct {
+		Name string // Name of the file.
+		Hash string // Hash is the id of the blob object of the file.
+	}
+
 	// LogLine is a log summary.
 	LogLine struct {
 		CommitID string
@@ -573,6 +581,117 @@ func (git *Git) DiffNames(from, to string) ([]string, error) {
 	return removeEmptyLines(strings.Split(diff, "\n")), nil
 }
 
+// DiffNamesWorktree returns the names of the files which differ between the
+// from commit id and the working tree, including the staged changes. The file
+// names are relative to the configuration WorkingDir.
+func (git *Git) DiffNamesWorktree(from string) ([]string, error) {
+	log.Trace().
+		Str("action", "DiffNamesWorktree()").
+		Str("workingDir", git.config.WorkingDir).
+		Str("reference", from).
+		Msg("Get working tree differences.")
+
+	// git diff refreshes the index stat information in memory, so files which
+	// were only touched are not reported as changed, and the optional locks
+	// are disabled so the refreshed index is never written back.
+	diff, err := git.exec("--no-optional-locks", "diff", "--name-only", "--relative", from)
+	if err != nil {
+		return nil, fmt.Errorf("diff: %w", err)
+	}
+
+	return removeEmptyLines(strings.Split(diff, "\n")), nil
+}
+
+// ListBlobs lists the files of the WorkingDir directory on the given rev,
+// together with their blob object ids, without walking into child trees.
+func (git *Git) ListBlobs(rev string) ([]Blob, error) {
+	out, err := git.exec("ls-tree", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs []Blob
+	for _, line := range removeEmptyLines(strings.Split(out, "\n")) {
+		// <mode> SP <type> SP <object> TAB <file>
+		meta, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("ls-tree: unexpected output line %q", line)
+		}
+		if fields := strings.Fields(meta); len(fields) == 3 && fields[1] == "blob" {
+			blobs = append(blobs, Blob{
+				Name: name,
+				Hash: fields[2],
+			})
+		}
+	}
+	return blobs, nil
+}
+
+// ListIndexBlobs lists the regular files of the index inside the WorkingDir
+// directory, recursively, together with their blob object ids. The files
+// modified in the working tree are not listed, so the listed ids are the ids of
+// the working tree content. The file names are relative to the WorkingDir.
+func (git *Git) ListIndexBlobs() ([]Blob, error) {
+	out, err := git.exec("ls-files", "--stage")
+	if err != nil {
+		return nil, fmt.Errorf("ls-files: %w", err)
+	}
+
+	modified, err := git.ListUncommitted()
+	if err != nil {
+		return nil, err
+	}
+	isModified := make(map[string]bool, len(modified))
+	for _, file := range modified {
+		isModified[file] = true
+	}
+
+	var blobs []Blob
+	for _, line := range removeEmptyLines(strings.Split(out, "\n")) {
+		// <mode> SP <object> SP <stage> TAB <file>
+		meta, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("ls-files: unexpected output line %q", line)
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[2] != "0" || isModified[name] {
+			continue
+		}
+		if fields[0] != "100644" && fields[0] != "100755" {
+			// symlinks and submodules have no file content.
+			continue
+		}
+		blobs = append(blobs, Blob{
+			Name: name,
+			Hash: fields[1],
+		})
+	}
+	return blobs, nil
+}
+
+// BlobHash returns the id of the blob object of the given content, the same
+// as computed by "git hash-object".
+func BlobHash(content []byte) string {
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "blob %d\x00", len(content))
+	_, _ = h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LastCommitOf returns the commit id of the most recent commit of the
+// from..to range which changed the given file. The file path is relative to
+// the configuration WorkingDir. An empty string is returned if no commit in
+// the range changed the file.
+func (git *Git) LastCommitOf(from, to, file string) (string, error) {
+	return git.exec("rev-list", "-1", from+".."+to, "--", file)
+}
+
+// ShowFile returns the content of the file on the given rev. The file path is
+// relative to the configuration WorkingDir.
+func (git *Git) ShowFile(rev, file string) (string, error) {
+	return git.exec("show", rev+":./"+file)
+}
+
 // NewBranch creates a new branch reference pointing to current HEAD.
 func (git *Git) NewBranch(name string) error {
 	log.Trace().
@@ -743,6 +862,11 @@ func (git *Git) Root() (string, error) {
 	return git.exec("rev-parse", "--show-toplevel")
 }
 
+// GitDir returns the absolute path of the git directory of the repository.
+func (git *Git) GitDir() (string, error) {
+	return git.exec("rev-parse", "--absolute-git-dir")
+}
+
 // IsRepository tell if the git wrapper setup is operating in a valid git
 // repository.
 func (git *Git) IsRepository() bool {
@@ -18,6 +18,8 @@ package git_test
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -142,6 +144,122 @@ func TestRevParse(t *testing.T) {
 	assert.EqualStrings(t, CookedCommitID, out, "commit mismatch")
 }
 
+func TestGitDir(t *testing.T) {
+	repodir := mkOneCommitRepo(t)
+
+	git := test.NewGitWrapper(t, repodir, []string{})
+	out, err := git.GitDir()
+	assert.NoError(t, err, "rev-parse --absolute-git-dir failed")
+
+	want, err := filepath.EvalSymlinks(filepath.Join(repodir, ".git"))
+	assert.NoError(t, err)
+	got, err := filepath.EvalSymlinks(out)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, want, got, "git dir mismatch")
+}
+
+func TestShowFile(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"f:dir/a.txt:a",
+		"f:dir/b.txt:b",
+		"f:dir/child/c.txt:c",
+	})
+	git := s.Git()
+	git.CommitAll("add files")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "dir"), "a.txt", "changed")
+
+	gw := test.NewGitWrapper(t, filepath.Join(s.RootDir(), "dir"), []string{})
+	content, err := gw.ShowFile("HEAD", "a.txt")
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "a", content)
+}
+
+func TestListBlobsHashes(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"f:dir/a.txt:a",
+		"f:dir/b.txt:b",
+		"f:dir/child/c.txt:c",
+	})
+	s.Git().CommitAll("add files")
+
+	gw := test.NewGitWrapper(t, filepath.Join(s.RootDir(), "dir"), []string{})
+	blobs, err := gw.ListBlobs("HEAD")
+	assert.NoError(t, err)
+	assert.EqualInts(t, 2, len(blobs), "unexpected blobs: %v", blobs)
+
+	for _, blob := range blobs {
+		content, err := gw.ShowFile("HEAD", blob.Name)
+		assert.NoError(t, err)
+		assert.EqualStrings(t, blob.Hash, git.BlobHash([]byte(content)),
+			"hash mismatch for %s", blob.Name)
+	}
+}
+
+func TestLastCommitOf(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"f:dir/a.txt:a",
+		"f:dir/b.txt:b",
+	})
+	git := s.Git()
+	git.CommitAll("add files")
+	base := git.RevParse("HEAD")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "dir"), "a.txt", "changed")
+	git.CommitAll("change a.txt")
+	changedA := git.RevParse("HEAD")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "dir"), "b.txt", "changed")
+	git.CommitAll("change b.txt")
+
+	gw := test.NewGitWrapper(t, filepath.Join(s.RootDir(), "dir"), []string{})
+	commit, err := gw.LastCommitOf(base, "HEAD", "a.txt")
+	assert.NoError(t, err)
+	assert.EqualStrings(t, changedA, commit)
+
+	commit, err = gw.LastCommitOf(changedA, "HEAD", "a.txt")
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "", commit)
+}
+
+func TestDiffNamesWorktree(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"f:dir/changed.txt:a",
+		"f:dir/staged.txt:a",
+		"f:dir/deleted.txt:a",
+		"f:dir/touched.txt:a",
+		"f:other.txt:a",
+	})
+	git := s.Git()
+	git.CommitAll("add files")
+
+	dir := filepath.Join(s.RootDir(), "dir")
+	test.WriteFile(t, dir, "changed.txt", "changed")
+	test.WriteFile(t, dir, "staged.txt", "changed")
+	test.WriteFile(t, dir, "touched.txt", "a")
+	test.WriteFile(t, s.RootDir(), "other.txt", "changed")
+	test.RemoveFile(t, dir, "deleted.txt")
+	git.Add(filepath.Join(dir, "staged.txt"))
+
+	index := filepath.Join(s.RootDir(), ".git", "index")
+	indexStat, err := os.Stat(index)
+	assert.NoError(t, err)
+
+	gw := test.NewGitWrapper(t, dir, []string{})
+	files, err := gw.DiffNamesWorktree("HEAD")
+	assert.NoError(t, err)
+	test.AssertDiff(t, files, []string{"changed.txt", "deleted.txt", "staged.txt"})
+
+	gotStat, err := os.Stat(index)
+	assert.NoError(t, err)
+	assert.IsTrue(t, gotStat.ModTime().Equal(indexStat.ModTime()),
+		"git index must not be written")
+}
+
 func TestClone(t *testing.T) {
 	const (
 		filename = "test.txt"
@@ -398,3 +516,25 @@ func assertEqualRemotes(t *testing.T, got []git.Remote, want []git.Remote) {
 func init() {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 }
+
+func TestListIndexBlobs(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"f:dir/a.txt:a",
+		"f:dir/b.txt:b",
+		"f:dir/child/c.txt:c",
+	})
+	s.Git().CommitAll("add files")
+
+	// modified and untracked files are not listed.
+	test.WriteFile(t, filepath.Join(s.RootDir(), "dir"), "b.txt", "changed")
+	test.WriteFile(t, filepath.Join(s.RootDir(), "dir"), "d.txt", "d")
+
+	gw := test.NewGitWrapper(t, filepath.Join(s.RootDir(), "dir"), []string{})
+	blobs, err := gw.ListIndexBlobs()
+	assert.NoError(t, err)
+	test.AssertDiff(t, blobs, []git.Blob{
+		{Name: "a.txt", Hash: git.BlobHash([]byte("a"))},
+		{Name: "child/c.txt", Hash: git.BlobHash([]byte("c"))},
+	})
+}
@@ -17,6 +17,7 @@ package hcl_test
 import (
 	"testing"
 
+	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl"
 
 	. "github.com/mineiros-io/terramate/test/hclutils"
@@ -115,6 +116,67 @@ func TestHCLParserGenerateBlocksRange(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "structured files",
+			input: []cfgfile{
+				{
+					filename: "generates.tm",
+					body: Doc(
+						GenerateJSON(
+							Labels("file.json"),
+							Expr("content", "{}"),
+						),
+						GenerateYAML(
+							Labels("file.yaml"),
+							Expr("content", "{}"),
+							Expr("context", "root"),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Generate: hcl.GenerateConfig{
+						Files: []hcl.GenFileBlock{
+							{
+								Label:  "file.json",
+								Format: hcl.GenFileJSON,
+								Range: Range(
+									"generates.tm",
+									Start(1, 1, 0),
+									End(3, 2, 44),
+								),
+							},
+							{
+								Label:  "file.yaml",
+								Format: hcl.GenFileYAML,
+								Range: Range(
+									"generates.tm",
+									Start(4, 1, 45),
+									End(7, 2, 106),
+								),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "generate_json with no label - fails",
+			input: []cfgfile{
+				{
+					filename: "generates.tm",
+					body: GenerateJSON(
+						Expr("content", "{}"),
+					).String(),
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
 	}
 
 	for _, tcase := range tcases {
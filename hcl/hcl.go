@@ -16,11 +16,13 @@ package hcl
 
 import (
 	"fmt"
+	"math/big"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
@@ -56,15 +58,20 @@ type Config struct {
 	Vendor    *VendorConfig
 	Asserts   []AssertConfig
 	Generate  GenerateConfig
+	Scripts   []*Script
 
 	Imported RawConfig
 
 	// absdir is the absolute path to the configuration directory.
 	absdir string
+
+	// importedFiles are the absolute paths of the imported files.
+	importedFiles []string
 }
 
 // GenerateConfig includes code generation related configurations, like
-// generate_file and generate_hcl.
+// generate_file and generate_hcl. The generate_json and generate_yaml blocks
+// are parsed as generate_file blocks with a specific format.
 type GenerateConfig struct {
 	Files []GenFileBlock
 	HCLs  []GenHCLBlock
@@ -85,6 +92,29 @@ type RunConfig struct {
 
 	// Env contains environment definitions for run.
 	Env *RunEnv
+
+	// BeforeEach are the commands executed on each stack before the
+	// command being run.
+	BeforeEach *ast.Attribute
+
+	// AfterEach are the commands executed on each stack after the
+	// command being run succeeds.
+	AfterEach *ast.Attribute
+
+	// OnFailure are the commands executed on each stack when the command
+	// being run or any of its hooks fail.
+	OnFailure *ast.Attribute
+
+	// Timeout is the maximum duration of the command on each stack.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	// Retries is the number of times a failed command is retried on
+	// each stack.
+	Retries int
+
+	// RetryDelay is the duration to wait before retrying a failed command.
+	RetryDelay time.Duration
 }
 
 // RunEnv represents Terramate run environment.
@@ -150,6 +180,9 @@ type Terramate struct {
 
 	// Config is the parsed config blocks.
 	Config *RootConfig
+
+	// onlyRunEnv tells if the block only defines terramate.config.run.env.
+	onlyRunEnv bool
 }
 
 // Stack is the parsed "stack" HCL block.
@@ -184,6 +217,18 @@ type Stack struct {
 
 	// Watch is a list of files to be watched for changes.
 	Watch []string
+
+	// RunTimeout, if not nil, overrides the terramate.config.run.timeout
+	// for this stack.
+	RunTimeout *time.Duration
+
+	// RunRetries, if not nil, overrides the terramate.config.run.retries
+	// for this stack.
+	RunRetries *int
+
+	// RunRetryDelay, if not nil, overrides the
+	// terramate.config.run.retry_delay for this stack.
+	RunRetryDelay *time.Duration
 }
 
 // GenHCLBlock represents a parsed generate_hcl block.
@@ -202,7 +247,25 @@ type GenHCLBlock struct {
 	Asserts []AssertConfig
 }
 
-// GenFileBlock represents a parsed generate_file block
+// GenFileFormat is the format of the file generated by a GenFileBlock.
+type GenFileFormat string
+
+const (
+	// GenFileRaw is the format of the generate_file blocks, which content is
+	// the raw string of the file.
+	GenFileRaw GenFileFormat = ""
+
+	// GenFileJSON is the format of the generate_json blocks, which content is
+	// an object rendered as JSON.
+	GenFileJSON GenFileFormat = "json"
+
+	// GenFileYAML is the format of the generate_yaml blocks, which content is
+	// an object rendered as YAML.
+	GenFileYAML GenFileFormat = "yaml"
+)
+
+// GenFileBlock represents a parsed generate_file, generate_json or
+// generate_yaml block.
 type GenFileBlock struct {
 	// Range is the range of the entire block definition.
 	Range info.Range
@@ -218,6 +281,40 @@ type GenFileBlock struct {
 	Context string
 	// Asserts represents all assert blocks
 	Asserts []AssertConfig
+	// Format of the generated file.
+	Format GenFileFormat
+}
+
+// BlockType returns the type of the block which defined the generated file.
+func (b GenFileBlock) BlockType() string {
+	switch b.Format {
+	case GenFileJSON:
+		return "generate_json"
+	case GenFileYAML:
+		return "generate_yaml"
+	}
+	return "generate_file"
+}
+
+// Script represents a parsed script block.
+type Script struct {
+	// Range is the range of the entire block definition.
+	Range info.Range
+	// Name of the script, defined by the block label.
+	Name string
+	// Description of the script.
+	Description string
+	// Jobs of the script, in the order they are defined.
+	Jobs []*ScriptJob
+}
+
+// ScriptJob represents a parsed job block of a script.
+type ScriptJob struct {
+	// Range is the range of the entire block definition.
+	Range info.Range
+	// Commands attribute of the job. It must evaluate to a list of
+	// commands, where each command is a list of strings.
+	Commands *ast.Attribute
 }
 
 // Evaluator represents a Terramate evaluator
@@ -255,6 +352,10 @@ type TerramateParser struct {
 	// parsedFiles stores a map of all parsed files
 	parsedFiles map[string]parsedFile
 
+	// importedFiles stores the files imported by this parser and by the
+	// sub-parsers of the imports.
+	importedFiles []string
+
 	strict bool
 	// if true, calling Parse() or MinimalParse() will fail.
 	parsed bool
@@ -443,6 +544,14 @@ func (p *TerramateParser) ParsedBodies() map[string]*hclsyntax.Body {
 	return parsed
 }
 
+// ImportedFiles returns the absolute paths of all the files imported by the
+// parsed configuration, including the files imported by the imported files.
+func (p *TerramateParser) ImportedFiles() []string {
+	files := append([]string{}, p.importedFiles...)
+	sort.Strings(files)
+	return files
+}
+
 // Imports returns all import blocks.
 func (p *TerramateParser) Imports() (ast.Blocks, error) {
 	errs := errors.L()
@@ -579,6 +688,8 @@ func (p *TerramateParser) handleImport(importBlock *ast.Block) error {
 	}
 
 	p.addParsedFile(p.dir, external, src)
+	p.importedFiles = append(p.importedFiles, src)
+	p.importedFiles = append(p.importedFiles, importParser.importedFiles...)
 	return nil
 }
 
@@ -698,6 +809,26 @@ func (p *TerramateParser) parseStack(stackblock *ast.Block) (*Stack, error) {
 		case "watch":
 			errs.Append(assignSet(attr.Name, &stack.Watch, attrVal))
 
+		case "run_timeout", "run_retry_delay":
+			d, err := valueAsDuration(attrVal)
+			if err != nil {
+				errs.Append(hclAttrErr(attr, "field stack.%s %s", attr.Name, err))
+				continue
+			}
+			if attr.Name == "run_timeout" {
+				stack.RunTimeout = &d
+			} else {
+				stack.RunRetryDelay = &d
+			}
+
+		case "run_retries":
+			retries, err := valueAsRetries(attrVal)
+			if err != nil {
+				errs.Append(hclAttrErr(attr, "field stack.run_retries %s", err))
+				continue
+			}
+			stack.RunRetries = &retries
+
 		default:
 			errs.Append(errors.E(
 				attr.NameRange, "unrecognized attribute stack.%q", attr.Name,
@@ -740,11 +871,15 @@ func (c Config) HasRunEnv() bool {
 // AbsDir returns the absolute path of the configuration directory.
 func (c Config) AbsDir() string { return c.absdir }
 
+// ImportedFiles returns the absolute paths of the files imported by the
+// configuration, directly or through other imported files.
+func (c Config) ImportedFiles() []string { return c.importedFiles }
+
 // IsEmpty returns true if the config is empty, false otherwise.
 func (c Config) IsEmpty() bool {
 	return c.Stack == nil && c.Terramate == nil &&
 		c.Vendor == nil && len(c.Asserts) == 0 &&
-		len(c.Globals) == 0 &&
+		len(c.Globals) == 0 && len(c.Scripts) == 0 &&
 		len(c.Generate.Files) == 0 && len(c.Generate.HCLs) == 0
 }
 
@@ -875,8 +1010,8 @@ func parseGenerateHCLBlock(block *ast.Block) (GenHCLBlock, error) {
 	}, nil
 }
 
-// parseGenerateFileBlock parses all Terramate files on the given dir, returning
-// parsed generate_file blocks.
+// parseGenerateFileBlock parses a generate_file, generate_json or
+// generate_yaml block.
 func parseGenerateFileBlock(block *ast.Block) (GenFileBlock, error) {
 	err := validateGenerateFileBlock(block)
 	if err != nil {
@@ -912,8 +1047,8 @@ func parseGenerateFileBlock(block *ast.Block) (GenFileBlock, error) {
 		context = hcl.ExprAsKeyword(contextAttr.Expr)
 		if context != "stack" && context != "root" {
 			errs.Append(errors.E(contextAttr.Expr.Range(),
-				"generate_file.context supported values are \"stack\" and \"root\""+
-					" but given %q", context))
+				"%s.context supported values are \"stack\" and \"root\""+
+					" but given %q", block.Type, context))
 		}
 	}
 
@@ -935,6 +1070,14 @@ func parseGenerateFileBlock(block *ast.Block) (GenFileBlock, error) {
 		lets = ast.NewMergedBlock("lets", []string{})
 	}
 
+	format := GenFileRaw
+	switch block.Type {
+	case "generate_json":
+		format = GenFileJSON
+	case "generate_yaml":
+		format = GenFileYAML
+	}
+
 	return GenFileBlock{
 		Range:     block.Range,
 		Label:     block.Labels[0],
@@ -943,6 +1086,7 @@ func parseGenerateFileBlock(block *ast.Block) (GenFileBlock, error) {
 		Content:   block.Body.Attributes["content"],
 		Condition: block.Body.Attributes["condition"],
 		Context:   context,
+		Format:    format,
 	}, nil
 }
 
@@ -1043,12 +1187,12 @@ func validateGenerateFileBlock(block *ast.Block) error {
 	errs := errors.L()
 	if len(block.Labels) != 1 {
 		errs.Append(errors.E(ErrTerramateSchema, block.OpenBraceRange,
-			"generate_file must have single label instead got %v",
-			block.Labels,
+			"%s must have single label instead got %v",
+			block.Type, block.Labels,
 		))
 	} else if block.Labels[0] == "" {
 		errs.Append(errors.E(ErrTerramateSchema, block.OpenBraceRange,
-			"generate_file label can't be empty"))
+			"%s label can't be empty", block.Type))
 	}
 	schema := &hcl.BodySchema{
 		Attributes: []hcl.AttributeSchema{
@@ -1296,6 +1440,108 @@ func parseAssertConfig(assert *ast.Block) (AssertConfig, error) {
 	return cfg, nil
 }
 
+func parseScriptBlock(block *ast.Block) (*Script, error) {
+	errs := errors.L()
+
+	if len(block.Labels) != 1 {
+		errs.Append(errors.E(ErrTerramateSchema, block.LabelRanges(),
+			"script must have exactly one label but has %d", len(block.Labels)))
+	}
+
+	script := &Script{
+		Range: block.Range,
+	}
+	if len(block.Labels) > 0 {
+		script.Name = block.Labels[0]
+	}
+
+	for _, attr := range block.Attributes.SortedList() {
+		switch attr.Name {
+		case "description":
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				errs.Append(errors.E(ErrTerramateSchema, diags,
+					"failed to evaluate script.description attribute"))
+				continue
+			}
+			if value.Type() != cty.String {
+				errs.Append(attrErr(attr,
+					"script.description must be a string but given %q",
+					value.Type().FriendlyName(),
+				))
+				continue
+			}
+			script.Description = value.AsString()
+		default:
+			errs.Append(errors.E(ErrTerramateSchema, attr.NameRange,
+				"unrecognized attribute script.%s", attr.Name,
+			))
+		}
+	}
+
+	foundJob := false
+	for _, subBlock := range block.Blocks {
+		if subBlock.Type != "job" {
+			errs.Append(errors.E(ErrTerramateSchema, subBlock.DefRange(),
+				"unexpected block %s inside script", subBlock.Type))
+			continue
+		}
+
+		foundJob = true
+		job, err := parseScriptJobBlock(subBlock)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		script.Jobs = append(script.Jobs, job)
+	}
+
+	if !foundJob {
+		errs.Append(errors.E(ErrTerramateSchema, block.DefRange(),
+			"script must have at least one job block"))
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+
+	return script, nil
+}
+
+func parseScriptJobBlock(block *ast.Block) (*ScriptJob, error) {
+	errs := errors.L()
+
+	errs.Append(checkNoLabels(block))
+	errs.Append(checkNoBlocks(block))
+
+	job := &ScriptJob{
+		Range: block.Range,
+	}
+
+	for _, attr := range block.Attributes.SortedList() {
+		switch attr.Name {
+		case "commands":
+			attr := attr
+			job.Commands = &attr
+		default:
+			errs.Append(errors.E(ErrTerramateSchema, attr.NameRange,
+				"unrecognized attribute script.job.%s", attr.Name,
+			))
+		}
+	}
+
+	if job.Commands == nil {
+		errs.Append(errors.E(ErrTerramateSchema, block.DefRange(),
+			"script.job.commands is required"))
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
 func parseVendorConfig(cfg *VendorConfig, vendor *ast.Block) error {
 	logger := log.With().
 		Str("action", "hcl.parseVendorConfig()").
@@ -1434,6 +1680,21 @@ func parseRunConfig(runCfg *RunConfig, runBlock *ast.MergedBlock) error {
 
 	errs := errors.L()
 	for _, attr := range runBlock.Attributes.SortedList() {
+		attr := attr
+
+		// The hooks are evaluated for each stack when running commands.
+		switch attr.Name {
+		case "before_each":
+			runCfg.BeforeEach = &attr
+			continue
+		case "after_each":
+			runCfg.AfterEach = &attr
+			continue
+		case "on_failure":
+			runCfg.OnFailure = &attr
+			continue
+		}
+
 		value, diags := attr.Expr.Value(nil)
 		if diags.HasErrors() {
 			errs.Append(errors.E(diags,
@@ -1454,6 +1715,27 @@ func parseRunConfig(runCfg *RunConfig, runBlock *ast.MergedBlock) error {
 				continue
 			}
 			runCfg.CheckGenCode = value.True()
+		case "timeout":
+			d, err := valueAsDuration(value)
+			if err != nil {
+				errs.Append(attrErr(attr, "terramate.config.run.timeout %s", err))
+				continue
+			}
+			runCfg.Timeout = d
+		case "retry_delay":
+			d, err := valueAsDuration(value)
+			if err != nil {
+				errs.Append(attrErr(attr, "terramate.config.run.retry_delay %s", err))
+				continue
+			}
+			runCfg.RetryDelay = d
+		case "retries":
+			retries, err := valueAsRetries(value)
+			if err != nil {
+				errs.Append(attrErr(attr, "terramate.config.run.retries %s", err))
+				continue
+			}
+			runCfg.Retries = retries
 		default:
 			errs.Append(errors.E("unrecognized attribute terramate.config.run.env.%s",
 				attr.Name))
@@ -1471,6 +1753,38 @@ func parseRunConfig(runCfg *RunConfig, runBlock *ast.MergedBlock) error {
 	return errs.AsError()
 }
 
+// valueAsDuration converts a string value, like "1m30s", to a non-negative
+// duration. The returned error is meant to be prefixed with the attribute name.
+func valueAsDuration(val cty.Value) (time.Duration, error) {
+	if val.Type() != cty.String {
+		return 0, errors.E("must be a duration string but is %q",
+			val.Type().FriendlyName())
+	}
+	d, err := time.ParseDuration(val.AsString())
+	if err != nil {
+		return 0, errors.E("is not a valid duration: %s", err.Error())
+	}
+	if d < 0 {
+		return 0, errors.E("must not be negative but is %s", d)
+	}
+	return d, nil
+}
+
+// valueAsRetries converts a number value to a non-negative number of retries.
+// The returned error is meant to be prefixed with the attribute name.
+func valueAsRetries(val cty.Value) (int, error) {
+	if val.Type() != cty.Number {
+		return 0, errors.E("must be a number but is %q",
+			val.Type().FriendlyName())
+	}
+	bf := val.AsBigFloat()
+	retries, acc := bf.Int64()
+	if acc != big.Exact || retries < 0 {
+		return 0, errors.E("must be a non-negative integer but is %s", bf.String())
+	}
+	return int(retries), nil
+}
+
 func parseRunEnv(runEnv *RunEnv, envBlock *ast.MergedBlock) error {
 	if len(envBlock.Attributes) > 0 {
 		runEnv.Attributes = envBlock.Attributes
@@ -1588,7 +1902,8 @@ func (p *TerramateParser) parseTerramateSchema() (Config, error) {
 		Logger()
 
 	config := Config{
-		absdir: p.dir,
+		absdir:        p.dir,
+		importedFiles: p.ImportedFiles(),
 	}
 
 	errKind := ErrTerramateSchema
@@ -1662,14 +1977,32 @@ func (p *TerramateParser) parseTerramateSchema() (Config, error) {
 				config.Generate.HCLs = append(config.Generate.HCLs, genhcl)
 			}
 
-		case "generate_file":
-			logger.Trace().Msg("Found \"generate_file\" block")
+		case "generate_file", "generate_json", "generate_yaml":
+			logger.Trace().Msgf("Found %q block", block.Type)
 
 			genfile, err := parseGenerateFileBlock(block)
 			errs.Append(err)
 			if err == nil {
 				config.Generate.Files = append(config.Generate.Files, genfile)
 			}
+
+		case "script":
+			logger.Trace().Msg("Found \"script\" block")
+
+			script, err := parseScriptBlock(block)
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+
+			for _, other := range config.Scripts {
+				if other.Name == script.Name {
+					errs.Append(errors.E(errKind, block.DefRange(),
+						"duplicated script %q, first defined at %s",
+						script.Name, other.Range))
+				}
+			}
+			config.Scripts = append(config.Scripts, script)
 		}
 	}
 
@@ -1747,6 +2080,10 @@ func (p *TerramateParser) checkConfigSanity(cfg Config) error {
 	tmblock := rawconfig.MergedBlocks["terramate"]
 	if tmblock != nil && p.dir != p.rootdir {
 		for _, raworigin := range tmblock.RawOrigins {
+			// The run environment can be defined on any directory.
+			if onlyDefinesRunEnv(raworigin) {
+				continue
+			}
 			if filepath.Dir(raworigin.Range.HostPath()) != p.dir {
 				errs.Append(
 					errors.E(ErrUnexpectedTerramate, raworigin.TypeRange,
@@ -1890,12 +2227,50 @@ func parseTerramateBlock(block *ast.MergedBlock) (Terramate, error) {
 		}
 	}
 
+	tm.onlyRunEnv = true
+	for _, raw := range block.RawOrigins {
+		tm.onlyRunEnv = tm.onlyRunEnv && onlyDefinesRunEnv(raw)
+	}
+
 	if err := errs.AsError(); err != nil {
 		return Terramate{}, err
 	}
 	return tm, nil
 }
 
+// OnlyRunEnv tells if the terramate block only defines
+// terramate.config.run.env blocks, which is the only Terramate configuration
+// allowed outside the project root directory.
+func (tm Terramate) OnlyRunEnv() bool {
+	return tm.onlyRunEnv
+}
+
+// onlyDefinesRunEnv tells if the given raw terramate block defines only
+// terramate.config.run.env blocks.
+func onlyDefinesRunEnv(block *ast.Block) bool {
+	if len(block.Attributes) > 0 {
+		return false
+	}
+	foundEnv := false
+	for _, cfgBlock := range block.Blocks {
+		if cfgBlock.Type != "config" || len(cfgBlock.Attributes) > 0 {
+			return false
+		}
+		for _, runBlock := range cfgBlock.Blocks {
+			if runBlock.Type != "run" || len(runBlock.Attributes) > 0 {
+				return false
+			}
+			for _, envBlock := range runBlock.Blocks {
+				if envBlock.Type != "env" {
+					return false
+				}
+				foundEnv = true
+			}
+		}
+	}
+	return foundEnv
+}
+
 func hclAttrErr(attr *hcl.Attribute, msg string, args ...interface{}) error {
 	return errors.E(ErrTerramateSchema, attr.Expr.Range(), fmt.Sprintf(msg, args...))
 }
@@ -18,13 +18,16 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	hhcl "github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl"
 	"github.com/mineiros-io/terramate/hcl/ast"
+	"github.com/mineiros-io/terramate/test"
 	. "github.com/mineiros-io/terramate/test/hclutils"
 )
 
@@ -300,6 +303,98 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "run hooks defined",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      before_each = [["echo", "before", terramate.stack.name]]
+						      after_each  = [["echo", "after"], ["echo", global.after]]
+						      on_failure  = [["echo", "failed"]]
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								BeforeEach:   hookAttr(t, "before_each", `[["echo", "before", terramate.stack.name]]`),
+								AfterEach:    hookAttr(t, "after_each", `[["echo", "after"], ["echo", global.after]]`),
+								OnFailure:    hookAttr(t, "on_failure", `[["echo", "failed"]]`),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run timeout and retries defined",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      timeout     = "1h30m"
+						      retries     = 2
+						      retry_delay = "10s"
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								Timeout:      90 * time.Minute,
+								Retries:      2,
+								RetryDelay:   10 * time.Second,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid run timeout and retries",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      timeout     = 10
+						      retries     = 1.5
+						      retry_delay = "-1s"
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
 		{
 			name: "attrs on run.env in single block/file",
 			input: []cfgfile{
@@ -607,6 +702,55 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:     "run.env in non-root directory",
+			parsedir: "dir",
+			input: []cfgfile{
+				{
+					filename: "dir/cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        FOO = "bar"
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvCfg(`FOO = "bar"`),
+			},
+		},
+		{
+			name:     "run attributes in non-root directory fails",
+			parsedir: "dir",
+			input: []cfgfile{
+				{
+					filename: "dir/cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      check_gen_code = false
+						      env {
+						        FOO = "bar"
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrUnexpectedTerramate),
+				},
+			},
+		},
 		{
 			name: "redefined run.check_gen_code attribute on different files fails",
 			input: []cfgfile{
@@ -671,3 +815,12 @@ func TestHCLParserConfigRun(t *testing.T) {
 		testParser(t, tc)
 	}
 }
+
+func hookAttr(t *testing.T, name string, expr string) *ast.Attribute {
+	return &ast.Attribute{
+		Attribute: &hhcl.Attribute{
+			Name: name,
+			Expr: test.NewExpr(t, expr),
+		},
+	}
+}
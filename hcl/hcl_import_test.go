@@ -15,10 +15,13 @@
 package hcl_test
 
 import (
+	"path/filepath"
 	"testing"
 
+	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/test"
 	. "github.com/mineiros-io/terramate/test/hclutils"
 )
 
@@ -353,3 +356,24 @@ func TestHCLImport(t *testing.T) {
 		testParser(t, tc)
 	}
 }
+
+func TestHCLImportedFiles(t *testing.T) {
+	rootdir := t.TempDir()
+	stackdir := test.Mkdir(t, rootdir, "stack")
+	test.WriteFile(t, stackdir, "cfg.tm", `import {
+		source = "/shared/globals.tm"
+	}`)
+	test.WriteFile(t, filepath.Join(rootdir, "shared"), "globals.tm", `import {
+		source = "/other/globals.tm"
+	}`)
+	test.WriteFile(t, filepath.Join(rootdir, "other"), "globals.tm", `globals {
+		a = 1
+	}`)
+
+	cfg, err := hcl.ParseDir(rootdir, stackdir)
+	assert.NoError(t, err)
+	test.AssertDiff(t, cfg.ImportedFiles(), []string{
+		filepath.Join(rootdir, "other", "globals.tm"),
+		filepath.Join(rootdir, "shared", "globals.tm"),
+	})
+}
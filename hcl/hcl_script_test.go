@@ -0,0 +1,277 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_test
+
+import (
+	"testing"
+
+	hhcl "github.com/hashicorp/hcl/v2"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/hcl/ast"
+	"github.com/mineiros-io/terramate/test"
+	. "github.com/mineiros-io/terramate/test/hclwrite/hclutils"
+)
+
+func TestHCLParserScript(t *testing.T) {
+	commands := func(expr string) *ast.Attribute {
+		return &ast.Attribute{
+			Attribute: &hhcl.Attribute{
+				Name: "commands",
+				Expr: test.NewExpr(t, expr),
+			},
+		}
+	}
+
+	tcases := []testcase{
+		{
+			name: "script with single job",
+			input: []cfgfile{
+				{
+					filename: "script.tm",
+					body: Script(
+						Labels("deploy"),
+						Str("description", "deploy the stack"),
+						Job(
+							Expr("commands", `[["terraform", "init"], ["terraform", "apply"]]`),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Scripts: []*hcl.Script{
+						{
+							Name:        "deploy",
+							Description: "deploy the stack",
+							Jobs: []*hcl.ScriptJob{
+								{
+									Commands: commands(`[["terraform", "init"], ["terraform", "apply"]]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script with multiple jobs and expressions",
+			input: []cfgfile{
+				{
+					filename: "script.tm",
+					body: Script(
+						Labels("plan"),
+						Job(
+							Expr("commands", `[["terraform", "init"]]`),
+						),
+						Job(
+							Expr("commands", `[["terraform", "plan", "-out", global.planfile]]`),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Scripts: []*hcl.Script{
+						{
+							Name: "plan",
+							Jobs: []*hcl.ScriptJob{
+								{
+									Commands: commands(`[["terraform", "init"]]`),
+								},
+								{
+									Commands: commands(`[["terraform", "plan", "-out", global.planfile]]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "multiple scripts on multiple files",
+			input: []cfgfile{
+				{
+					filename: "init.tm",
+					body: Script(
+						Labels("init"),
+						Job(
+							Expr("commands", `[["terraform", "init"]]`),
+						),
+					).String(),
+				},
+				{
+					filename: "plan.tm",
+					body: Script(
+						Labels("plan"),
+						Job(
+							Expr("commands", `[["terraform", "plan"]]`),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Scripts: []*hcl.Script{
+						{
+							Name: "init",
+							Jobs: []*hcl.ScriptJob{
+								{
+									Commands: commands(`[["terraform", "init"]]`),
+								},
+							},
+						},
+						{
+							Name: "plan",
+							Jobs: []*hcl.ScriptJob{
+								{
+									Commands: commands(`[["terraform", "plan"]]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script without label fails",
+			input: []cfgfile{
+				{
+					filename: "script.tm",
+					body: Script(
+						Job(
+							Expr("commands", `[["terraform", "init"]]`),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "script without jobs fails",
+			input: []cfgfile{
+				{
+					filename: "script.tm",
+					body: Script(
+						Labels("deploy"),
+					).String(),
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "script with non-string description fails",
+			input: []cfgfile{
+				{
+					filename: "script.tm",
+					body: Script(
+						Labels("deploy"),
+						Expr("description", "666"),
+						Job(
+							Expr("commands", `[["terraform", "init"]]`),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "script with unrecognized attribute and block fails",
+			input: []cfgfile{
+				{
+					filename: "script.tm",
+					body: Script(
+						Labels("deploy"),
+						Str("unknown", "value"),
+						Block("unknown"),
+						Job(
+							Expr("commands", `[["terraform", "init"]]`),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "job without commands fails",
+			input: []cfgfile{
+				{
+					filename: "script.tm",
+					body: Script(
+						Labels("deploy"),
+						Job(
+							Str("command", "terraform"),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "duplicated script on same directory fails",
+			input: []cfgfile{
+				{
+					filename: "script.tm",
+					body: Script(
+						Labels("deploy"),
+						Job(
+							Expr("commands", `[["terraform", "init"]]`),
+						),
+					).String(),
+				},
+				{
+					filename: "script2.tm",
+					body: Script(
+						Labels("deploy"),
+						Job(
+							Expr("commands", `[["terraform", "apply"]]`),
+						),
+					).String(),
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcases {
+		testParser(t, tc)
+	}
+}
@@ -16,6 +16,7 @@ package hcl_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl"
@@ -67,6 +68,50 @@ func TestHCLParserStack(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "stack with run timeout and retries",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+						  run_timeout     = "5m"
+						  run_retries     = 0
+						  run_retry_delay = "1s"
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Stack: &hcl.Stack{
+						RunTimeout:    durationPtr(5 * time.Minute),
+						RunRetries:    intPtr(0),
+						RunRetryDelay: durationPtr(time.Second),
+					},
+				},
+			},
+		},
+		{
+			name: "stack with invalid run timeout and retries",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+						  run_timeout = "forever"
+						  run_retries = -1
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
 		{
 			name: "stack with unrecognized blocks",
 			input: []cfgfile{
@@ -596,3 +641,6 @@ func TestHCLParserStack(t *testing.T) {
 		testParser(t, tc)
 	}
 }
+
+func durationPtr(d time.Duration) *time.Duration { return &d }
+func intPtr(i int) *int                          { return &i }
@@ -54,8 +54,11 @@ func NewTopLevelRawConfig() RawConfig {
 		"stack":         (*RawConfig).addBlock,
 		"vendor":        (*RawConfig).addBlock,
 		"generate_file": (*RawConfig).addBlock,
+		"generate_json": (*RawConfig).addBlock,
+		"generate_yaml": (*RawConfig).addBlock,
 		"generate_hcl":  (*RawConfig).addBlock,
 		"assert":        (*RawConfig).addBlock,
+		"script":        (*RawConfig).addBlock,
 		"import":        func(r *RawConfig, b *ast.Block) error { return nil },
 	})
 }
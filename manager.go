@@ -15,17 +15,23 @@
 package terramate
 
 import (
-	"fmt"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/bmatcuk/doublestar"
+	hhcl "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/mineiros-io/terramate/config"
 	"github.com/mineiros-io/terramate/errors"
+	tmfs "github.com/mineiros-io/terramate/fs"
+	"github.com/mineiros-io/terramate/generate"
 	"github.com/mineiros-io/terramate/git"
+	"github.com/mineiros-io/terramate/modvendor"
 	"github.com/mineiros-io/terramate/project"
 	"github.com/mineiros-io/terramate/run"
 	"github.com/mineiros-io/terramate/run/dag"
@@ -39,6 +45,64 @@ type (
 	Manager struct {
 		root       *config.Root // whole config
 		gitBaseRef string       // gitBaseRef is the git ref where we compare changes.
+
+		// includeUncommitted tells if the uncommitted and untracked files of
+		// the working tree are considered changed.
+		includeUncommitted bool
+
+		// vendorDir is the project dir where the modules are vendored. If
+		// set, the changes of the modules vendored with tm_vendor by the
+		// stacks are detected.
+		vendorDir project.Path
+
+		// realRootDir is the root dir with its symlinks resolved. It's lazily
+		// computed by realRoot().
+		realRootDir string
+
+		// useChangesCache tells if the change detection cache, stored in the
+		// git directory, is used.
+		useChangesCache bool
+
+		// withReasonCommits tells if the commits of the changed files are
+		// set in the change reasons.
+		withReasonCommits bool
+
+		// detection is the state of the ongoing ListChanged call.
+		detection *detectionState
+	}
+
+	// detectionState is the state shared by the checks of a change detection.
+	detectionState struct {
+		baseRev string
+		headRev string
+
+		// realGitRoot is the top level directory of the git repository with
+		// its symlinks resolved.
+		realGitRoot string
+
+		// changedFiles are the changed files, relative to the root dir.
+		changedFiles []string
+
+		// moduleChanges are the changes of the files of the already checked
+		// modules, or of the remote modules they call, by the real path of
+		// the modules. A nil reason means the module didn't change.
+		moduleChanges map[string]*ChangeReason
+
+		cache *changesCache
+
+		// indexBlobs are the blob hashes of the clean files of the git
+		// index, by path relative to the git root. They are lazily loaded
+		// by indexBlobs().
+		indexBlobs map[string]string
+
+		// validDirs tells if the cached modules of the directories, by path
+		// relative to the git root, are still valid.
+		validDirs map[string]bool
+
+		// closure are the directories, relative to the git root, visited by
+		// the check of the stack being checked and inClosure is their set.
+		closure   []string
+		inClosure map[string]bool
 	}
 
 	// StacksReport is the report of project's stacks and the result of its
@@ -46,6 +110,10 @@ type (
 	StacksReport struct {
 		Stacks []Entry
 
+		// Ignored are the changed stacks which changes are ignored because of
+		// ignore-change triggers.
+		Ignored []Entry
+
 		// Checks contains the result info of default checks.
 		Checks RepoChecks
 	}
@@ -59,7 +127,7 @@ type (
 	// Entry is a stack entry result.
 	Entry struct {
 		Stack  *config.Stack
-		Reason string // Reason why this entry was returned.
+		Reason ChangeReason // Reason why this entry was returned.
 	}
 )
 
@@ -75,6 +143,38 @@ func NewManager(root *config.Root, gitBaseRef string) *Manager {
 	}
 }
 
+// WithUncommittedChanges makes the change detection compare the git base ref
+// with the working tree, so uncommitted (staged or not) and untracked files
+// are also considered changed.
+func (m *Manager) WithUncommittedChanges() *Manager {
+	m.includeUncommitted = true
+	return m
+}
+
+// WithVendorDir makes the change detection consider the changes in the
+// modules vendored inside vendorDir by the tm_vendor calls of the stacks.
+func (m *Manager) WithVendorDir(vendorDir project.Path) *Manager {
+	m.vendorDir = vendorDir
+	return m
+}
+
+// WithChangesCache makes the change detection cache the module calls of the
+// Terraform files in the ChangesCacheFile of the git directory, so files which
+// didn't change are not parsed again by the next change detections.
+func (m *Manager) WithChangesCache() *Manager {
+	m.useChangesCache = true
+	return m
+}
+
+// WithReasonCommits makes the change detection set the most recent commit
+// which changed the file of each change reason. Finding the commits requires
+// a git call for each changed stack, so it must only be enabled when the
+// reasons are shown.
+func (m *Manager) WithReasonCommits() *Manager {
+	m.withReasonCommits = true
+	return m
+}
+
 // List walks the basedir directory looking for terraform stacks.
 // It returns a lexicographic sorted list of stack directories.
 func (m *Manager) List() (*StacksReport, error) {
@@ -153,12 +253,19 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 
 	logger.Debug().Msg("List changed files.")
 
-	changedFiles, err := listChangedFiles(m.root.HostDir(), m.gitBaseRef)
+	changedFiles, err := m.listChangedFiles(m.root.HostDir())
 	if err != nil {
 		return nil, errors.E(errListChanged, err)
 	}
 
+	m.detection, err = m.newDetectionState(g, changedFiles)
+	if err != nil {
+		return nil, errors.E(errListChanged, err)
+	}
+	defer func() { m.detection = nil }()
+
 	stackSet := map[project.Path]Entry{}
+	ignoredSet := map[project.Path]ChangeReason{}
 
 	for _, path := range changedFiles {
 		abspath := filepath.Join(m.root.HostDir(), path)
@@ -188,6 +295,27 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 				}
 			}
 
+			info, err := trigger.ParseFile(abspath)
+			if err != nil {
+				return nil, errors.E(errListChanged, err, "parsing trigger file %s", projpath)
+			}
+
+			if info.IsExpired(time.Now()) {
+				logger.Debug().Msg("ignoring expired trigger file")
+				continue
+			}
+
+			if info.Type == trigger.IgnoreChangeType {
+				logger.Debug().Msg("ignore-change trigger detected")
+
+				ignoredSet[triggeredStack] = ChangeReason{
+					Kind:          IgnoredChange,
+					File:          projpath,
+					TriggerReason: info.Reason,
+				}
+				continue
+			}
+
 			cfg, found := m.root.Lookup(triggeredStack)
 			if !found || !cfg.IsStack() {
 				logger.Debug().Msg("trigger path is not a stack, nothing to do")
@@ -200,8 +328,12 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 			}
 
 			stackSet[s.Dir] = Entry{
-				Stack:  s,
-				Reason: "stack has been triggered by: " + projpath.String(),
+				Stack: s,
+				Reason: ChangeReason{
+					Kind:          TriggerChange,
+					File:          projpath,
+					TriggerReason: info.Reason,
+				},
 			}
 			continue
 		}
@@ -242,8 +374,24 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 		}
 
 		stackSet[s.Dir] = Entry{
-			Stack:  s,
-			Reason: "stack has unmerged changes",
+			Stack: s,
+			Reason: ChangeReason{
+				Kind: StackFileChange,
+				File: projpath,
+			},
+		}
+	}
+
+	logger.Debug().Msg("List stacks with changed configuration.")
+
+	cfgChanged, err := m.listConfigChangedStacks(g, changedFiles)
+	if err != nil {
+		return nil, errors.E(errListChanged, err)
+	}
+
+	for dir, entry := range cfgChanged {
+		if _, ok := stackSet[dir]; !ok {
+			stackSet[dir] = entry
 		}
 	}
 
@@ -254,6 +402,12 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 		return nil, errors.E(errListChanged, "searching for stacks", err)
 	}
 
+	logger.Debug().Msg("Check the watched patterns of all stacks.")
+
+	if err := m.checkWatchPatterns(allstacks, changedFiles); err != nil {
+		return nil, errors.E(errListChanged, err)
+	}
+
 	logger.Trace().Msg("Range over all stacks.")
 
 rangeStacks:
@@ -276,78 +430,108 @@ rangeStacks:
 			stack.IsChanged = true
 			stackSet[stack.Dir] = Entry{
 				Stack: stack,
-				Reason: fmt.Sprintf(
-					"stack changed because watched file %q changed",
-					changed,
-				),
+				Reason: ChangeReason{
+					Kind: WatchedFileChange,
+					File: changed,
+				},
 			}
 			continue rangeStacks
 		}
 
-		logger.Debug().
-			Stringer("stack", stack).
-			Msg("Apply function to stack.")
+		if pattern, changed, ok := hasChangedWatchedPatterns(stack, changedFiles); ok {
+			logger.Debug().
+				Stringer("stack", stack).
+				Str("pattern", pattern).
+				Stringer("watchfile", changed).
+				Msg("changed.")
 
-		err := m.filesApply(stack.HostDir(m.root), func(file fs.DirEntry) error {
-			if path.Ext(file.Name()) != ".tf" {
-				return nil
+			stack.IsChanged = true
+			stackSet[stack.Dir] = Entry{
+				Stack: stack,
+				Reason: ChangeReason{
+					Kind:    WatchedFileChange,
+					File:    changed,
+					Pattern: pattern,
+				},
 			}
+			continue rangeStacks
+		}
+
+		logger.Debug().
+			Stringer("stack", stack).
+			Msg("Check if the modules called by the stack changed.")
 
+		changed, why, err := m.stackModulesChanged(stack)
+		if err != nil {
+			return nil, errors.E(errListChanged, "checking module changes", err)
+		}
+		if changed {
 			logger.Debug().
 				Stringer("stack", stack).
-				Msg("Get tf file path.")
+				Msg("Module changed.")
 
-			tfpath := filepath.Join(stack.HostDir(m.root), file.Name())
+			stack.IsChanged = true
+			stackSet[stack.Dir] = Entry{
+				Stack:  stack,
+				Reason: why,
+			}
+		}
+	}
 
-			logger.Trace().
-				Stringer("stack", stack).
-				Str("configFile", tfpath).
-				Msg("Parse modules.")
+	existingStacks := make(map[string]bool, len(allstacks))
+	for _, stackEntry := range allstacks {
+		existingStacks[stackEntry.Stack.Dir.String()] = true
+	}
+	m.detection.cache.pruneStacks(existingStacks)
 
-			modules, err := tf.ParseModules(tfpath)
-			if err != nil {
-				return errors.E(errListChanged, "parsing modules", err)
+	if m.hasChangedVendoredFiles(changedFiles) {
+		logger.Debug().Msg("Check stacks using changed vendored modules.")
+
+		for _, stackEntry := range allstacks {
+			stack := stackEntry.Stack
+			if _, ok := stackSet[stack.Dir]; ok {
+				continue
 			}
 
-			logger.Trace().
-				Stringer("stack", stack).
-				Str("configFile", tfpath).
-				Msg("Range over modules.")
+			changed, why, err := m.vendoredModulesChanged(stack)
+			if err != nil {
+				return nil, errors.E(errListChanged, "checking vendored module changes", err)
+			}
 
-			for _, mod := range modules {
-				logger.Trace().
+			if changed {
+				logger.Debug().
 					Stringer("stack", stack).
-					Str("configFile", tfpath).
-					Msg("Check if module changed.")
+					Str("source", why.VendorSource).
+					Msg("Vendored module changed.")
 
-				changed, why, err := m.moduleChanged(mod, stack.HostDir(m.root), make(map[string]bool))
-				if err != nil {
-					return errors.E(errListChanged, err, "checking module %q", mod.Source)
-				}
-
-				if changed {
-					logger.Debug().
-						Stringer("stack", stack).
-						Str("configFile", tfpath).
-						Msg("Module changed.")
-
-					stack.IsChanged = true
-					stackSet[stack.Dir] = Entry{
-						Stack: stack,
-						Reason: fmt.Sprintf(
-							"stack changed because %q changed because %s",
-							mod.Source, why,
-						),
-					}
-					return nil
+				stack.IsChanged = true
+				stackSet[stack.Dir] = Entry{
+					Stack:  stack,
+					Reason: why,
 				}
 			}
-			return nil
-		})
+		}
+	}
 
-		if err != nil {
-			return nil, errors.E(errListChanged, "checking module changes", err)
+	logger.Trace().Msg("Remove stacks with ignored changes.")
+
+	ignoredStacks := []Entry{}
+	for dir, reason := range ignoredSet {
+		entry, ok := stackSet[dir]
+		if !ok {
+			continue
 		}
+
+		logger.Debug().
+			Stringer("stack", dir).
+			Msg("ignoring stack changes.")
+
+		delete(stackSet, dir)
+		entry.Stack.IsChanged = false
+		ignoredStacks = append(ignoredStacks, Entry{
+			Stack:  entry.Stack,
+			Reason: reason,
+		})
 	}
 
 	logger.Trace().Msg("Make set of changed stacks.")
@@ -360,15 +544,223 @@ rangeStacks:
 	logger.Trace().Msg("Sort changed stacks.")
 
 	sort.Sort(EntrySlice(changedStacks))
+	sort.Sort(EntrySlice(ignoredStacks))
+
+	if m.withReasonCommits {
+		logger.Trace().Msg("Get commits of the changes.")
+
+		if err := m.setReasonCommits(g, changedStacks); err != nil {
+			return nil, errors.E(errListChanged, err)
+		}
+		if err := m.setReasonCommits(g, ignoredStacks); err != nil {
+			return nil, errors.E(errListChanged, err)
+		}
+	}
+
+	if err := m.detection.cache.save(); err != nil {
+		// the cache is only an optimization, so failing to save it must not
+		// fail the change detection.
+		logger.Warn().Err(err).Msg("saving change detection cache")
+	}
 
 	return &StacksReport{
-		Checks: checks,
-		Stacks: changedStacks,
+		Checks:  checks,
+		Stacks:  changedStacks,
+		Ignored: ignoredStacks,
 	}, nil
 }
 
-// AddWantedOf returns all wanted stacks from the given stacks.
-func (m *Manager) AddWantedOf(scopeStacks config.List[*config.SortableStack]) (config.List[*config.SortableStack], error) {
+// setReasonCommits sets the commit of the reasons which have a changed file to
+// the most recent commit, since the git base ref, which changed the file.
+// Uncommitted changes have no commit.
+func (m *Manager) setReasonCommits(g *git.Git, entries []Entry) error {
+	baseRef, err := g.RevParse(m.gitBaseRef)
+	if err != nil {
+		return errors.E(err, "getting revision %q", m.gitBaseRef)
+	}
+
+	for i := range entries {
+		reason := &entries[i].Reason
+		if reason.File.String() == "" {
+			continue
+		}
+		// project paths are absolute, git needs paths relative to the root.
+		commit, err := g.LastCommitOf(baseRef, "HEAD", reason.File.String()[1:])
+		if err != nil {
+			return errors.E(err, "getting last commit of file %q", reason.File)
+		}
+		reason.Commit = commit
+	}
+	return nil
+}
+
+// listConfigChangedStacks lists the stacks which configuration changed because
+// of the changed files. The configuration of a stack changes when a Terramate
+// file of a parent directory defining inherited configuration changes or when
+// a file imported by the stack or by any of its parent directories changes.
+// Changes in the files of the stack directory itself are not considered.
+func (m *Manager) listConfigChangedStacks(g *git.Git, changedFiles []string) (map[project.Path]Entry, error) {
+	logger := log.With().
+		Str("action", "listConfigChangedStacks()").
+		Logger()
+
+	importedBy := map[project.Path][]project.Path{}
+	for _, cfg := range m.root.Tree().AsList() {
+		for _, file := range cfg.Node.ImportedFiles() {
+			imported := project.PrjAbsPath(m.root.HostDir(), file)
+			importedBy[imported] = append(importedBy[imported], cfg.Dir())
+		}
+	}
+
+	stackSet := map[project.Path]Entry{}
+	markStacks := func(dir project.Path, reason ChangeReason) error {
+		cfg, found := m.root.Lookup(dir)
+		if !found {
+			return nil
+		}
+		for _, stackTree := range cfg.Stacks() {
+			if _, ok := stackSet[stackTree.Dir()]; ok {
+				continue
+			}
+			s, err := config.NewStackFromHCL(m.root.HostDir(), stackTree.Node)
+			if err != nil {
+				return err
+			}
+			stackSet[s.Dir] = Entry{
+				Stack:  s,
+				Reason: reason,
+			}
+		}
+		return nil
+	}
+
+	for _, file := range changedFiles {
+		changed := project.PrjAbsPath(m.root.HostDir(), filepath.Join(m.root.HostDir(), file))
+
+		for _, importer := range importedBy[changed] {
+			logger.Debug().
+				Stringer("path", changed).
+				Stringer("importer", importer).
+				Msg("imported file changed")
+
+			err := markStacks(importer, ChangeReason{
+				Kind: ImportedConfigChange,
+				File: changed,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !tmfs.IsTerramateFile(path.Base(file)) {
+			continue
+		}
+
+		cfg, found := m.root.Lookup(changed.Dir())
+		if !found || len(cfg.Children) == 0 {
+			continue
+		}
+
+		inherited, err := m.changedFileDefinesInheritedConfig(g, file)
+		if err != nil {
+			return nil, err
+		}
+		if !inherited {
+			logger.Debug().
+				Stringer("path", changed).
+				Msg("ignoring changed file without inherited configuration")
+			continue
+		}
+
+		logger.Debug().
+			Stringer("path", changed).
+			Msg("inherited file changed")
+
+		for _, child := range cfg.Children {
+			err := markStacks(child.Dir(), ChangeReason{
+				Kind: InheritedConfigChange,
+				File: changed,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stackSet, nil
+}
+
+// changedFileDefinesInheritedConfig tells if the changed Terramate file defines
+// configuration inherited by the child directories, either in its current
+// content or in its content on the base ref, so removed configuration is
+// detected too. The file path is relative to the project root.
+func (m *Manager) changedFileDefinesInheritedConfig(g *git.Git, file string) (bool, error) {
+	logger := log.With().
+		Str("action", "changedFileDefinesInheritedConfig()").
+		Str("file", file).
+		Logger()
+
+	abspath := filepath.Join(m.root.HostDir(), file)
+	content, err := os.ReadFile(abspath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, errors.E(err, "reading changed file %q", file)
+	}
+	if err == nil && definesInheritedConfig(abspath, content) {
+		return true, nil
+	}
+
+	baseContent, err := g.ShowFile(m.detection.baseRev, file)
+	if err != nil {
+		logger.Debug().
+			Err(err).
+			Msg("changed file not found in the base ref")
+		return false, nil
+	}
+	return definesInheritedConfig(abspath, []byte(baseContent)), nil
+}
+
+// definesInheritedConfig tells if the Terramate file content defines any
+// configuration inherited by the child directories: globals, code generation
+// blocks, scripts, imports or terramate.config.run.env. Content which can't be
+// parsed is considered as defining inherited configuration.
+func definesInheritedConfig(filename string, content []byte) bool {
+	parsed, diags := hclsyntax.ParseConfig(content, filename, hhcl.InitialPos)
+	if diags.HasErrors() {
+		return true
+	}
+
+	body := parsed.Body.(*hclsyntax.Body)
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "globals", "import", "script", "generate_hcl", "generate_file",
+			"generate_json", "generate_yaml":
+			return true
+		case "terramate":
+			if hasNestedBlock(block.Body, "config", "run", "env") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasNestedBlock tells if the body has the blocks of the given types nested
+// in the given order.
+func hasNestedBlock(body *hclsyntax.Body, types ...string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, block := range body.Blocks {
+		if block.Type == types[0] && hasNestedBlock(block.Body, types[1:]...) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddWantedOf returns all wanted stacks from the given stacks. The entries of
+// the given stacks have no reason and the entries of the stacks added because
+// they are wanted have a wanted-by reason.
+func (m *Manager) AddWantedOf(scopeStacks config.List[*config.SortableStack]) ([]Entry, error) {
 	logger := log.With().
 		Str("action", "manager.AddWantedOf").
 		Logger()
@@ -418,20 +810,32 @@ func (m *Manager) AddWantedOf(scopeStacks config.List[*config.SortableStack]) (c
 		}
 	}
 
-	var selectedStacks config.List[*config.SortableStack]
+	var selectedStacks []Entry
 	visited = dag.Visited{}
+	wantedBy := map[dag.ID]dag.ID{}
 	addStack := func(s *config.Stack) {
-		if _, ok := visited[dag.ID(s.Dir.String())]; ok {
+		id := dag.ID(s.Dir.String())
+		if _, ok := visited[id]; ok {
 			return
 		}
 
-		visited[dag.ID(s.Dir.String())] = struct{}{}
-		selectedStacks = append(selectedStacks, s.Sortable())
+		visited[id] = struct{}{}
+		entry := Entry{Stack: s}
+		if wanter := wantedBy[id]; wanter != "" {
+			entry.Reason = ChangeReason{
+				Kind:     WantedByChange,
+				WantedBy: project.NewPath(string(wanter)),
+			}
+		}
+		selectedStacks = append(selectedStacks, entry)
 	}
 
 	var pending []dag.ID
 	for _, s := range scopeStacks {
-		pending = append(pending, dag.ID(s.Dir().String()))
+		id := dag.ID(s.Dir().String())
+		pending = append(pending, id)
+		// stacks in the scope are never added because they are wanted.
+		wantedBy[id] = ""
 	}
 
 	for len(pending) > 0 {
@@ -443,9 +847,12 @@ func (m *Manager) AddWantedOf(scopeStacks config.List[*config.SortableStack]) (c
 		pending = pending[1:]
 
 		ancestors := wantsDag.AncestorsOf(id)
-		for _, id := range ancestors {
-			if _, ok := visited[id]; !ok {
-				pending = append(pending, id)
+		for _, ancestor := range ancestors {
+			if _, ok := visited[ancestor]; !ok {
+				if _, ok := wantedBy[ancestor]; !ok {
+					wantedBy[ancestor] = id
+				}
+				pending = append(pending, ancestor)
 			}
 		}
 	}
@@ -472,6 +879,20 @@ func (m *Manager) filesApply(dir string, apply func(file fs.DirEntry) error) err
 			continue
 		}
 
+		if file.Type()&fs.ModeSymlink != 0 {
+			st, err := os.Stat(filepath.Join(dir, file.Name()))
+			if err != nil {
+				logger.Debug().
+					Err(err).
+					Str("file", file.Name()).
+					Msg("ignoring broken symlink.")
+				continue
+			}
+			if st.IsDir() {
+				continue
+			}
+		}
+
 		logger.Debug().
 			Msg("Apply function to file.")
 		err := apply(file)
@@ -486,25 +907,22 @@ func (m *Manager) filesApply(dir string, apply func(file fs.DirEntry) error) err
 // moduleChanged recursively check if the module mod or any of the modules it
 // uses has changed. All .tf files of the module are parsed and this function is
 // called recursively. The visited keep track of the modules already parsed to
-// avoid infinite loops.
+// avoid infinite loops. The returned reason has the chain of modules which
+// lead to the change, starting with mod.
 func (m *Manager) moduleChanged(
 	mod tf.Module, basedir string, visited map[string]bool,
-) (changed bool, why string, err error) {
+) (changed bool, why ChangeReason, err error) {
 	logger := log.With().
 		Str("action", "moduleChanged()").
 		Logger()
 
-	if _, ok := visited[mod.Source]; ok {
-		return false, "", nil
-	}
-
 	logger.Trace().
 		Str("path", basedir).
 		Msg("Check if module source is local directory.")
 	if !mod.IsLocal() {
 		// if the source is a remote path (URL, VCS path, S3 bucket, etc) then
 		// we assume it's not changed.
-		return false, "", nil
+		return false, ChangeReason{}, nil
 	}
 
 	logger.Trace().
@@ -514,85 +932,601 @@ func (m *Manager) moduleChanged(
 
 	logger.Trace().
 		Str("path", modPath).
-		Msg("Get module path info.")
-	st, err := os.Stat(modPath)
+		Msg("Resolve module path.")
 
-	// TODO(i4k): resolve symlinks
+	// The module path is kept as is to resolve the relative sources of the
+	// modules it calls, as Terraform does, while the real path is used to
+	// detect the changes and the symlink loops.
+	realModPath, err := m.resolveModulePath(modPath)
+	if err != nil {
+		return false, ChangeReason{}, err
+	}
 
-	if err != nil || !st.IsDir() {
-		return false, "", errors.E("\"source\" path %q is not a directory", modPath)
+	if _, ok := visited[realModPath]; ok {
+		return false, ChangeReason{}, nil
 	}
 
 	logger.Debug().
 		Str("path", modPath).
-		Msg("Get list of changed files.")
-	changedFiles, err := listChangedFiles(modPath, m.gitBaseRef)
+		Msg("Check if module files or remote module sources changed.")
+	direct, err := m.moduleFilesChanged(realModPath)
 	if err != nil {
-		return false, "", errors.E(err,
-			"listing changes in the module %q",
+		return false, ChangeReason{}, errors.E(err,
+			"checking changes of the module %q",
 			mod.Source)
 	}
 
-	if len(changedFiles) > 0 {
-		return true, fmt.Sprintf("module %q has unmerged changes", mod.Source), nil
+	if direct != nil {
+		why := *direct
+		why.Modules = []string{mod.Source}
+		return true, why, nil
 	}
 
-	visited[mod.Source] = true
+	visited[realModPath] = true
 
-	logger.Debug().
+	logger.Trace().
 		Str("path", modPath).
-		Msg("Apply function to files in path.")
-	err = m.filesApply(modPath, func(file fs.DirEntry) error {
+		Msg("Get modules called by the module.")
+	modules, err := m.dirModules(realModPath)
+	if err != nil {
+		return false, ChangeReason{}, errors.E(err, "parsing module %q", mod.Source)
+	}
+
+	logger.Trace().
+		Str("path", modPath).
+		Msg("Range over modules.")
+	for _, mod2 := range modules {
+		logger.Trace().
+			Str("path", modPath).
+			Msg("Get if module is changed.")
+		changed, why, err = m.moduleChanged(mod2, modPath, visited)
+		if err != nil {
+			return false, ChangeReason{}, err
+		}
+
 		if changed {
-			return nil
+			logger.Trace().
+				Str("path", modPath).
+				Msg("Module was changed.")
+			why.Modules = append([]string{mod.Source}, why.Modules...)
+			break
+		}
+	}
+
+	return changed, why, nil
+}
+
+// stackModulesChanged checks if any of the local modules called by the stack,
+// directly or indirectly, changed. The directories visited are recorded as
+// the module closure of the stack in the change detection cache.
+func (m *Manager) stackModulesChanged(stack *config.Stack) (changed bool, why ChangeReason, err error) {
+	m.detection.closure = nil
+	m.detection.inClosure = map[string]bool{}
+
+	realStackDir := filepath.Join(m.realRoot(), filepath.FromSlash(stack.Dir.String()))
+	modules, err := m.dirModules(realStackDir)
+	if err != nil {
+		return false, ChangeReason{}, errors.E(err, "parsing modules")
+	}
+
+	for _, mod := range modules {
+		changed, why, err = m.moduleChanged(mod, stack.HostDir(m.root), make(map[string]bool))
+		if err != nil {
+			return false, ChangeReason{}, errors.E(err, "checking module %q", mod.Source)
+		}
+		if changed {
+			break
+		}
+	}
+
+	closure := m.detection.closure
+	if changed {
+		// the modules after the changed one were not visited, so the
+		// directories of the previous closure are kept.
+		previous, _ := m.detection.cache.stackClosure(stack.Dir.String())
+		for _, dir := range previous {
+			if !m.detection.inClosure[dir] {
+				closure = append(closure, dir)
+			}
+		}
+	}
+	sort.Strings(closure)
+	m.detection.cache.storeStack(stack.Dir.String(), closure)
+
+	m.detection.closure = nil
+	m.detection.inClosure = nil
+	return changed, why, nil
+}
+
+// dirModules returns the modules called by the Terraform files of the dir
+// directory, in the order of the files. If the change detection cache is
+// enabled, the cached modules are returned if the blob hashes of the files
+// didn't change, and the directory is added to the closure of the stack
+// being checked.
+func (m *Manager) dirModules(dir string) ([]tf.Module, error) {
+	cache := m.detection.cache
+	reldir, ok := m.gitRelPath(dir)
+	if cache == nil || !ok {
+		return m.parseDirModules(dir, nil)
+	}
+
+	if m.detection.inClosure != nil && !m.detection.inClosure[reldir] {
+		m.detection.inClosure[reldir] = true
+		m.detection.closure = append(m.detection.closure, reldir)
+	}
+
+	if cached, ok := cache.lookupDir(reldir); ok {
+		valid, err := m.cachedDirIsValid(dir, reldir, cached)
+		if err != nil {
+			return nil, err
+		}
+		if valid {
+			return cached.modules, nil
 		}
+	}
+
+	files := map[string]string{}
+	modules, err := m.parseDirModules(dir, files)
+	if err != nil {
+		return nil, err
+	}
+	cache.storeDir(reldir, files, modules)
+	m.detection.validDirs[reldir] = true
+	return modules, nil
+}
+
+// parseDirModules parses the modules called by the Terraform files of the dir
+// directory. If files is not nil, the blob hashes of the files are added to
+// it by file name.
+func (m *Manager) parseDirModules(dir string, files map[string]string) ([]tf.Module, error) {
+	var modules []tf.Module
+	err := m.filesApply(dir, func(file fs.DirEntry) error {
 		if path.Ext(file.Name()) != ".tf" {
 			return nil
 		}
 
-		logger.Trace().
-			Str("path", modPath).
-			Msg("Parse modules.")
-		modules, err := tf.ParseModules(filepath.Join(modPath, file.Name()))
+		tfpath := filepath.Join(dir, file.Name())
+		if files == nil {
+			fileModules, err := m.parseModules(tfpath)
+			if err != nil {
+				return err
+			}
+			modules = append(modules, fileModules...)
+			return nil
+		}
+
+		content, err := os.ReadFile(tfpath)
+		if err != nil {
+			return errors.E(err, "reading %q", tfpath)
+		}
+		hash := git.BlobHash(content)
+		fileModules, err := m.detection.cache.parseBlobModules(tfpath, hash, content)
 		if err != nil {
-			return errors.E(err, "parsing module %q", mod.Source)
+			return err
 		}
+		files[file.Name()] = hash
+		modules = append(modules, fileModules...)
+		return nil
+	})
+	return modules, err
+}
 
-		logger.Trace().
-			Str("path", modPath).
-			Msg("Range over modules.")
-		for _, mod2 := range modules {
-			var reason string
+// cachedDirIsValid tells if the Terraform files of the dir directory are the
+// same, with the same blob hashes, as when its modules were cached. The blob
+// hashes of the files which are clean in the git index are not computed
+// again.
+func (m *Manager) cachedDirIsValid(dir, reldir string, cached *cachedDirModules) (bool, error) {
+	if valid, ok := m.detection.validDirs[reldir]; ok {
+		return valid, nil
+	}
 
-			logger.Trace().
-				Str("path", modPath).
-				Msg("Get if module is changed.")
-			changed, reason, err = m.moduleChanged(mod2, modPath, visited)
+	index, err := m.indexBlobs()
+	if err != nil {
+		return false, err
+	}
+
+	valid := true
+	count := 0
+	err = m.filesApply(dir, func(file fs.DirEntry) error {
+		if !valid || path.Ext(file.Name()) != ".tf" {
+			return nil
+		}
+		count++
+
+		want, ok := cached.files[file.Name()]
+		if !ok {
+			valid = false
+			return nil
+		}
+
+		hash, ok := index[path.Join(reldir, file.Name())]
+		if !ok {
+			tfpath := filepath.Join(dir, file.Name())
+			content, err := os.ReadFile(tfpath)
 			if err != nil {
-				return err
+				return errors.E(err, "reading %q", tfpath)
 			}
+			hash = git.BlobHash(content)
+		}
+		valid = hash == want
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
 
-			if changed {
-				logger.Trace().
-					Str("path", modPath).
-					Msg("Module was changed.")
-				why = fmt.Sprintf("%s%s changed because %s ", why, mod.Source, reason)
-				return nil
+	valid = valid && count == len(cached.files)
+	m.detection.validDirs[reldir] = valid
+	return valid, nil
+}
+
+// indexBlobs returns the blob hashes of the clean files of the git index, by
+// path relative to the git root. They are listed only once per change
+// detection.
+func (m *Manager) indexBlobs() (map[string]string, error) {
+	if m.detection.indexBlobs != nil {
+		return m.detection.indexBlobs, nil
+	}
+
+	g, err := git.WithConfig(git.Config{
+		WorkingDir: m.detection.realGitRoot,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	blobs, err := g.ListIndexBlobs()
+	if err != nil {
+		return nil, errors.E(err, "listing files of the git index")
+	}
+
+	index := make(map[string]string, len(blobs))
+	for _, blob := range blobs {
+		index[blob.Name] = blob.Hash
+	}
+	m.detection.indexBlobs = index
+	return index, nil
+}
+
+// gitRelPath returns the path of the real dir relative to the git root, if
+// it's inside the repository.
+func (m *Manager) gitRelPath(realDir string) (string, bool) {
+	rel, err := filepath.Rel(m.detection.realGitRoot, realDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// moduleFilesChanged checks if any file of the module in the realModPath
+// directory changed or if the source of any remote module it calls changed,
+// like when its Git ref is bumped. The local modules it calls are not checked.
+// It returns nil if the module didn't change. The result is reused by the
+// checks of the other stacks calling the same module.
+func (m *Manager) moduleFilesChanged(realModPath string) (*ChangeReason, error) {
+	if why, ok := m.detection.moduleChanges[realModPath]; ok {
+		return why, nil
+	}
+
+	remoteUpdate, err := m.remoteModulesChanged(realModPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var why *ChangeReason
+	if remoteUpdate != nil {
+		why = &ChangeReason{
+			Kind:         RemoteModuleChange,
+			RemoteModule: remoteUpdate,
+		}
+	} else {
+		file, changed, err := m.changedFileInDir(realModPath)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			why = &ChangeReason{
+				Kind: LocalModuleChange,
+				File: file,
 			}
 		}
+	}
 
-		return nil
+	m.detection.moduleChanges[realModPath] = why
+	return why, nil
+}
+
+// changedFileInDir returns the first changed file inside the realDir
+// directory. The changes of a directory outside the project root, which has
+// no project paths, are listed with git and an empty path is returned.
+func (m *Manager) changedFileInDir(realDir string) (project.Path, bool, error) {
+	reldir, err := filepath.Rel(m.realRoot(), realDir)
+	if err != nil {
+		return project.Path{}, false, nil
+	}
+
+	if reldir == ".." || strings.HasPrefix(reldir, ".."+string(filepath.Separator)) {
+		files, err := m.listChangedFiles(realDir)
+		if err != nil {
+			return project.Path{}, false, errors.E(err, "listing changed files of %q", realDir)
+		}
+		return project.Path{}, len(files) > 0, nil
+	}
+
+	prefix := ""
+	if reldir != "." {
+		prefix = filepath.ToSlash(reldir) + "/"
+	}
+
+	for _, file := range m.detection.changedFiles {
+		if strings.HasPrefix(file, prefix) {
+			return project.NewPath("/" + file), true, nil
+		}
+	}
+	return project.Path{}, false, nil
+}
+
+// parseModules parses the modules called by the Terraform file at path,
+// reusing the modules of the change detection cache if the file didn't change.
+func (m *Manager) parseModules(path string) ([]tf.Module, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.E(err, "reading %q", path)
+	}
+	return m.detection.cache.parseModules(path, content)
+}
+
+// newDetectionState creates the state of a change detection with the given
+// changed files, loading the change detection cache if it's enabled.
+func (m *Manager) newDetectionState(g *git.Git, changedFiles []string) (*detectionState, error) {
+	baseRev, err := g.RevParse(m.gitBaseRef)
+	if err != nil {
+		return nil, errors.E(err, "getting revision %q", m.gitBaseRef)
+	}
+
+	headRev, err := g.RevParse("HEAD")
+	if err != nil {
+		return nil, errors.E(err, "getting HEAD revision")
+	}
+
+	gitRoot, err := g.Root()
+	if err != nil {
+		return nil, errors.E(err, "getting git top level directory")
+	}
+	realGitRoot, err := filepath.EvalSymlinks(gitRoot)
+	if err != nil {
+		return nil, errors.E(err, "resolving git top level directory %q", gitRoot)
+	}
+
+	state := &detectionState{
+		baseRev:       baseRev,
+		headRev:       headRev,
+		realGitRoot:   realGitRoot,
+		changedFiles:  changedFiles,
+		moduleChanges: map[string]*ChangeReason{},
+		validDirs:     map[string]bool{},
+	}
+
+	if m.useChangesCache {
+		gitdir, err := g.GitDir()
+		if err != nil {
+			return nil, errors.E(err, "getting git directory")
+		}
+		state.cache = loadChangesCache(filepath.Join(gitdir, ChangesCacheFile))
+	}
+	return state, nil
+}
+
+// hasChangedVendoredFiles tells if any of the changed files is inside the
+// vendor dir.
+func (m *Manager) hasChangedVendoredFiles(changedFiles []string) bool {
+	if m.vendorDir.String() == "" {
+		return false
+	}
+	for _, file := range changedFiles {
+		if project.NewPath("/" + file).HasPrefix(m.vendorDir.String() + "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// vendoredModulesChanged checks if any of the modules vendored by the tm_vendor
+// calls of the stack changed. The vendored modules are checked as local modules
+// called by the stack, so the changes in the vendored modules they depend on
+// are detected too.
+func (m *Manager) vendoredModulesChanged(stack *config.Stack) (bool, ChangeReason, error) {
+	requests, err := generate.ListStackVendorRequests(m.root, stack, m.vendorDir)
+	if err != nil {
+		return false, ChangeReason{}, errors.E(err, "listing vendored modules of stack %s", stack.Dir)
+	}
+
+	stackdir := stack.HostDir(m.root)
+	visited := map[string]bool{}
+	for _, req := range requests {
+		moddir := modvendor.TargetDir(m.vendorDir, req.Source).HostPath(m.root.HostDir())
+		if _, err := os.Stat(moddir); err != nil {
+			// not vendored yet.
+			continue
+		}
+
+		source, err := filepath.Rel(stackdir, moddir)
+		if err != nil {
+			return false, ChangeReason{}, errors.E(err, "computing path of vendored module %q", req.Source.Raw)
+		}
+		source = filepath.ToSlash(source)
+		if !strings.HasPrefix(source, "../") {
+			source = "./" + source
+		}
+
+		changed, why, err := m.moduleChanged(tf.Module{Source: source}, stackdir, visited)
+		if err != nil {
+			return false, ChangeReason{}, errors.E(err, "checking vendored module %q", req.Source.Raw)
+		}
+		if changed {
+			why.Kind = VendoredModuleChange
+			why.VendorSource = req.Source.Raw
+			return true, why, nil
+		}
+	}
+	return false, ChangeReason{}, nil
+}
+
+// resolveModulePath resolves the symlinks of the modPath local module path.
+// The resolved path must be a directory inside the git repository, but it may
+// be outside the project root.
+func (m *Manager) resolveModulePath(modPath string) (string, error) {
+	realPath, err := filepath.EvalSymlinks(modPath)
+	if err != nil {
+		return "", errors.E(err, "\"source\" path %q is not a directory", modPath)
+	}
+
+	st, err := os.Stat(realPath)
+	if err != nil || !st.IsDir() {
+		return "", errors.E("\"source\" path %q is not a directory", modPath)
+	}
+
+	gitRoot := m.detection.realGitRoot
+	if realPath != gitRoot && !strings.HasPrefix(realPath, gitRoot+string(filepath.Separator)) {
+		return "", errors.E(
+			"\"source\" path %q resolves to %q which is outside the repository",
+			modPath, realPath,
+		)
+	}
+	return realPath, nil
+}
+
+// realRoot returns the project root dir with its symlinks resolved.
+func (m *Manager) realRoot() string {
+	if m.realRootDir != "" {
+		return m.realRootDir
+	}
+	m.realRootDir = m.root.HostDir()
+	if realPath, err := filepath.EvalSymlinks(m.realRootDir); err == nil {
+		m.realRootDir = realPath
+	}
+	return m.realRootDir
+}
+
+// remoteModulesChanged checks if the source of any remote module called by the
+// .tf files in the dir directory changed between the git base ref and HEAD.
+// It returns the first change found or nil if no remote module changed.
+// Modules added or removed are not considered, as well as modules
+// which source didn't change in a meaningful way, like from
+// "github.com/org/repo?ref=v1" to "git::https://github.com/org/repo.git?ref=v1".
+func (m *Manager) remoteModulesChanged(dir string) (*RemoteModuleUpdate, error) {
+	logger := log.With().
+		Str("action", "remoteModulesChanged()").
+		Str("path", dir).
+		Logger()
+
+	g, err := git.WithConfig(git.Config{
+		WorkingDir: dir,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	baseRef := m.detection.baseRev
+	if baseRef == m.detection.headRev && !m.includeUncommitted {
+		return nil, nil
+	}
+
+	logger.Trace().Msg("Parse modules of the base ref.")
+
+	baseFiles, err := g.ListBlobs(baseRef)
+	if err != nil {
+		return nil, errors.E(err, "listing files of revision %q", m.gitBaseRef)
+	}
+
+	baseModules := map[string]tf.Module{}
+	for _, file := range baseFiles {
+		if path.Ext(file.Name) != ".tf" {
+			continue
+		}
+		modules, ok := m.detection.cache.lookup(file.Hash)
+		if !ok {
+			content, err := g.ShowFile(baseRef, file.Name)
+			if err != nil {
+				return nil, errors.E(err, "reading file %q of revision %q", file.Name, m.gitBaseRef)
+			}
+			modules, err = tf.ParseModulesFromSource(filepath.Join(dir, file.Name), []byte(content))
+			if err != nil {
+				// The file is changed anyway, so the module is detected as
+				// changed by its changed files.
+				logger.Debug().
+					Err(err).
+					Str("file", file.Name).
+					Msg("ignoring invalid file of the base ref")
+				continue
+			}
+			m.detection.cache.store(file.Hash, modules)
+		}
+		for _, mod := range modules {
+			baseModules[mod.Name] = mod
+		}
+	}
+
+	logger.Trace().Msg("Parse modules of HEAD.")
 
+	modules, err := m.dirModules(dir)
 	if err != nil {
-		return false, "", err
+		return nil, err
 	}
 
-	return changed, fmt.Sprintf("module %q changed because %s", mod.Source, why), nil
+	// the modules may be cached, so they are copied before sorting.
+	headModules := append([]tf.Module(nil), modules...)
+
+	sort.Slice(headModules, func(i, j int) bool {
+		return headModules[i].Name < headModules[j].Name
+	})
+
+	for _, mod := range headModules {
+		baseMod, ok := baseModules[mod.Name]
+		if !ok || (mod.IsLocal() && baseMod.IsLocal()) {
+			continue
+		}
+
+		newSrc, newErr := tf.ParseSource(mod.Source)
+		oldSrc, oldErr := tf.ParseSource(baseMod.Source)
+		if newErr != nil || oldErr != nil {
+			// Not a Git source (eg.: registry or local path), so only the
+			// raw sources can be compared.
+			if mod.Source != baseMod.Source {
+				return &RemoteModuleUpdate{
+					Name:      mod.Name,
+					OldSource: baseMod.Source,
+					NewSource: mod.Source,
+				}, nil
+			}
+			continue
+		}
+
+		if newSrc.URL != oldSrc.URL || newSrc.Path != oldSrc.Path ||
+			newSrc.Subdir != oldSrc.Subdir {
+			return &RemoteModuleUpdate{
+				Name:      mod.Name,
+				OldSource: baseMod.Source,
+				NewSource: mod.Source,
+			}, nil
+		}
+
+		if newSrc.Ref != oldSrc.Ref {
+			return &RemoteModuleUpdate{
+				Name:      mod.Name,
+				OldSource: baseMod.Source,
+				NewSource: mod.Source,
+				OldRef:    oldSrc.Ref,
+				NewRef:    newSrc.Ref,
+			}, nil
+		}
+	}
+
+	return nil, nil
 }
 
 // listChangedFiles lists all changed files in the dir directory.
-func listChangedFiles(dir string, gitBaseRef string) ([]string, error) {
+func (m *Manager) listChangedFiles(dir string) ([]string, error) {
 	logger := log.With().
 		Str("action", "listChangedFiles()").
 		Str("path", dir).
@@ -622,9 +1556,9 @@ func listChangedFiles(dir string, gitBaseRef string) ([]string, error) {
 
 	logger.Trace().Msg("Get commit id of git base ref.")
 
-	baseRef, err := g.RevParse(gitBaseRef)
+	baseRef, err := g.RevParse(m.gitBaseRef)
 	if err != nil {
-		return nil, errors.E(err, "getting revision %q", gitBaseRef)
+		return nil, errors.E(err, "getting revision %q", m.gitBaseRef)
 	}
 
 	logger.Trace().Msg("Get commit id of HEAD.")
@@ -634,6 +1568,10 @@ func listChangedFiles(dir string, gitBaseRef string) ([]string, error) {
 		return nil, errors.E(err, "getting HEAD revision")
 	}
 
+	if m.includeUncommitted {
+		return listWorktreeChangedFiles(g, baseRef)
+	}
+
 	if baseRef == headRef {
 		return []string{}, nil
 	}
@@ -641,6 +1579,25 @@ func listChangedFiles(dir string, gitBaseRef string) ([]string, error) {
 	return g.DiffNames(baseRef, headRef)
 }
 
+// listWorktreeChangedFiles lists the files changed in the working tree since
+// the baseRef commit, including the untracked files.
+func listWorktreeChangedFiles(g *git.Git, baseRef string) ([]string, error) {
+	changed, err := g.DiffNamesWorktree(baseRef)
+	if err != nil {
+		return nil, errors.E(err, "listing working tree changes")
+	}
+
+	untracked, err := g.ListUntracked()
+	if err != nil {
+		return nil, errors.E(err, "listing untracked files")
+	}
+
+	// untracked files are never part of the diff.
+	files := append(changed, untracked...)
+	sort.Strings(files)
+	return files, nil
+}
+
 func hasChangedWatchedFiles(stack *config.Stack, changedFiles []string) (project.Path, bool) {
 	for _, watchFile := range stack.Watch {
 		for _, file := range changedFiles {
@@ -652,6 +1609,96 @@ func hasChangedWatchedFiles(stack *config.Stack, changedFiles []string) (project
 	return project.Path{}, false
 }
 
+func hasChangedWatchedPatterns(stack *config.Stack, changedFiles []string) (string, project.Path, bool) {
+	for _, pattern := range stack.WatchPatterns {
+		for _, file := range changedFiles {
+			prjfile := "/" + file
+			if watchPatternMatches(pattern, prjfile) {
+				return pattern, project.NewPath(prjfile), true
+			}
+		}
+	}
+	return "", project.Path{}, false
+}
+
+// watchPatternMatches tells if the stack.watch glob pattern or directory
+// matches the given project file.
+func watchPatternMatches(pattern string, prjfile string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(prjfile, pattern)
+	}
+	matched, _ := doublestar.Match(pattern, prjfile)
+	return matched
+}
+
+// checkWatchPatterns checks that every stack.watch glob pattern and directory
+// of the stacks matches at least one file, either a changed file, which may be
+// deleted, or a file of the project. The project is walked at most once for
+// all the patterns not matching any changed file.
+func (m *Manager) checkWatchPatterns(stacks []Entry, changedFiles []string) error {
+	pending := map[string]project.Path{}
+	for _, entry := range stacks {
+		for _, pattern := range entry.Stack.WatchPatterns {
+			if _, ok := pending[pattern]; !ok {
+				pending[pattern] = entry.Stack.Dir
+			}
+		}
+	}
+
+	matchFile := func(prjfile string) {
+		for pattern := range pending {
+			if watchPatternMatches(pattern, prjfile) {
+				delete(pending, pattern)
+			}
+		}
+	}
+
+	for _, file := range changedFiles {
+		matchFile("/" + file)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rootdir := m.root.HostDir()
+	errDone := errors.E("all patterns matched")
+	err := filepath.WalkDir(rootdir, func(abspath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		matchFile(project.PrjAbsPath(rootdir, abspath).String())
+		if len(pending) == 0 {
+			return errDone
+		}
+		return nil
+	})
+	if err != nil && err != errDone {
+		return errors.E(err, "looking for files matching the stack.watch patterns")
+	}
+
+	patterns := make([]string, 0, len(pending))
+	for pattern := range pending {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	errs := errors.L()
+	for _, pattern := range patterns {
+		errs.Append(errors.E(config.ErrStackInvalidWatch,
+			"stack %s: stack.watch pattern %q matches no files", pending[pattern], pattern))
+	}
+	return errs.AsError()
+}
+
 func checkRepoIsClean(g *git.Git) (RepoChecks, error) {
 	logger := log.With().
 		Str("action", "checkRepoIsClean()").
@@ -15,14 +15,17 @@
 package terramate_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
-	"strings"
 	"testing"
 
 	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate"
 	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/git"
 	"github.com/mineiros-io/terramate/project"
 	"github.com/mineiros-io/terramate/stack"
 	"github.com/mineiros-io/terramate/test"
@@ -139,6 +142,14 @@ func TestListChangedStacks(t *testing.T) {
 				changed: []string{"/stack"},
 			},
 		},
+		{
+			name:        "single stack: dependent module remote ref changed",
+			repobuilder: singleStackDependentRemoteModuleChangedRepo,
+			want: listTestResult{
+				list:    []string{"/stack"},
+				changed: []string{"/stack"},
+			},
+		},
 		{
 			name:        "multiple stack: single module changed",
 			repobuilder: multipleStackOneChangedModule,
@@ -183,11 +194,13 @@ func TestListChangedStackReason(t *testing.T) {
 	changed := report.Stacks
 	assert.EqualInts(t, 1, len(changed), "unexpected number of entries")
 	assert.EqualStrings(t, "/", changed[0].Stack.Dir.String(), "stack dir mismatch")
-	assert.EqualStrings(t, "stack has unmerged changes", changed[0].Reason)
+	assert.EqualStrings(t, "stack has unmerged changes", changed[0].Reason.String())
+	assert.EqualStrings(t, string(terramate.StackFileChange), string(changed[0].Reason.Kind))
+	assert.EqualStrings(t, "", changed[0].Reason.Commit, "commits must only be set when asked for")
 
 	repo = singleStackDependentModuleChangedRepo(t)
 
-	m = newManager(t, repo.Dir)
+	m = newManager(t, repo.Dir).WithReasonCommits()
 	report, err = m.ListChanged()
 	assert.NoError(t, err, "unexpected error")
 
@@ -195,12 +208,373 @@ func TestListChangedStackReason(t *testing.T) {
 	assert.EqualInts(t, 1, len(changed), "unexpected number of entries")
 	assert.EqualStrings(t, "/stack", changed[0].Stack.Dir.String(), "stack dir mismatch")
 
-	if !strings.Contains(changed[0].Reason, "modules/module1") ||
-		!strings.Contains(changed[0].Reason, "../module2") {
-		t.Fatalf("unexpected reason %q (modules: %+v)", changed[0].Reason, repo.modules)
+	reason := changed[0].Reason
+	assert.EqualStrings(t, string(terramate.LocalModuleChange), string(reason.Kind))
+	assert.EqualStrings(t, "/modules/module2/main.tf", reason.File.String())
+	test.AssertDiff(t, reason.Modules, []string{"../modules/module1", "../module2"})
+	assert.EqualStrings(t,
+		`stack changed because module "../modules/module1" changed because `+
+			`module "../module2" has unmerged changes`,
+		reason.String())
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+	head, err := g.RevParse("HEAD")
+	assert.NoError(t, err)
+	assert.EqualStrings(t, head, reason.Commit, "commit mismatch")
+}
+
+func TestListChangedRemoteModuleReason(t *testing.T) {
+	repo := singleStackDependentRemoteModuleChangedRepo(t)
+
+	m := newManager(t, repo.Dir)
+	report, err := m.ListChanged()
+	assert.NoError(t, err, "unexpected error")
+
+	changed := report.Stacks
+	assert.EqualInts(t, 1, len(changed), "unexpected number of entries")
+	assert.EqualStrings(t, "/stack", changed[0].Stack.Dir.String(), "stack dir mismatch")
+
+	reason := changed[0].Reason
+	assert.EqualStrings(t, string(terramate.RemoteModuleChange), string(reason.Kind))
+	test.AssertDiff(t, reason.Modules, []string{"../modules/module1", "../module2"})
+	test.AssertDiff(t, reason.RemoteModule, &terramate.RemoteModuleUpdate{
+		Name:      "vpc",
+		OldSource: "git::https://example.com/vpc.git?ref=v1.2.0",
+		NewSource: "git::https://example.com/vpc.git?ref=v1.3.0",
+		OldRef:    "v1.2.0",
+		NewRef:    "v1.3.0",
+	})
+	assert.EqualStrings(t,
+		`stack changed because module "../modules/module1" changed because `+
+			`module "../module2" changed because `+
+			`remote module "vpc" changed its ref from "v1.2.0" to "v1.3.0"`,
+		reason.String())
+}
+
+func TestListChangedModuleOutsideRoot(t *testing.T) {
+	// The project root is a subdirectory of the repository and the stack
+	// calls a local module of the repository which is outside of it.
+	repo := singleMergeCommitRepoNoStack(t)
+
+	rootdir := test.Mkdir(t, repo.Dir, "project")
+	module := test.Mkdir(t, repo.Dir, "shared")
+	stackdir := test.Mkdir(t, rootdir, "stack")
+
+	root, err := config.LoadRoot(rootdir)
+	assert.NoError(t, err)
+	createStack(t, root, stackdir)
+
+	test.WriteFile(t, stackdir, "main.tf", `
+module "shared" {
+	source = "../../shared"
+}
+`)
+	test.WriteFile(t, module, "main.tf", "# shared")
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	m := newManager(t, rootdir)
+	report, err := m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{}, report.Stacks, false)
+
+	assert.NoError(t, g.Checkout("change-module", true), "failed to create branch")
+	mainFile := test.WriteFile(t, module, "main.tf", "# changed")
+	assert.NoError(t, g.Add(mainFile), "add main.tf")
+	assert.NoError(t, g.Commit("commit main.tf"), "commit main.tf")
+
+	report, err = m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/stack"}, report.Stacks, true)
+	assert.EqualStrings(t,
+		`stack changed because module "../../shared" has unmerged changes`,
+		report.Stacks[0].Reason.String())
+}
+
+func TestListChangedInheritedConfigOnlyByInheritedContent(t *testing.T) {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	parent := test.Mkdir(t, repo.Dir, "parent")
+	child := test.Mkdir(t, parent, "child")
+
+	test.WriteFile(t, repo.Dir, "terramate.tm.hcl", `
+terramate {
+  config {
+    git {
+      default_branch = "main"
+    }
+  }
+}
+`)
+	test.WriteFile(t, parent, "stack.tm.hcl", `
+stack {
+  description = "parent"
+}
+`)
+	test.WriteFile(t, child, "stack.tm.hcl", `
+stack {}
+`)
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	m := newManager(t, repo.Dir)
+	report, err := m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{}, report.Stacks, false)
+
+	assert.NoError(t, g.Checkout("change-git-config", true), "failed to create branch")
+	test.WriteFile(t, repo.Dir, "terramate.tm.hcl", `
+terramate {
+  config {
+    git {
+      default_branch = "main"
+      default_remote = "origin"
+    }
+  }
+}
+`)
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("change git config"), "commit files")
+
+	m = newManager(t, repo.Dir)
+	report, err = m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{}, report.Stacks, false)
+
+	assert.NoError(t, g.Checkout("main", false), "checkout main failed")
+	assert.NoError(t, g.Checkout("change-description", true), "failed to create branch")
+	test.WriteFile(t, parent, "stack.tm.hcl", `
+stack {
+  description = "changed"
+}
+`)
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("change description"), "commit files")
+
+	m = newManager(t, repo.Dir)
+	report, err = m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/parent"}, report.Stacks, true)
+
+	assert.NoError(t, g.Checkout("main", false), "checkout main failed")
+	assert.NoError(t, g.Checkout("change-globals", true), "failed to create branch")
+	test.WriteFile(t, repo.Dir, "globals.tm.hcl", `
+globals {
+  a = 1
+}
+`)
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("add globals"), "commit files")
+
+	m = newManager(t, repo.Dir)
+	report, err = m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/parent", "/parent/child"}, report.Stacks, true)
+	for _, entry := range report.Stacks {
+		assert.EqualStrings(t, string(terramate.InheritedConfigChange), string(entry.Reason.Kind))
+		assert.EqualStrings(t, "/globals.tm.hcl", entry.Reason.File.String())
+	}
+
+	assert.NoError(t, g.Checkout("main", false), "checkout main failed")
+	assert.NoError(t, g.Checkout("change-script", true), "failed to create branch")
+	test.WriteFile(t, repo.Dir, "terramate.tm.hcl", `
+terramate {
+  config {
+    git {
+      default_branch = "main"
+    }
+  }
+}
+
+script "deploy" {
+  job {
+    commands = [["echo", "deploy"]]
+  }
+}
+`)
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("add script"), "commit files")
+
+	m = newManager(t, repo.Dir)
+	report, err = m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/parent", "/parent/child"}, report.Stacks, true)
+	for _, entry := range report.Stacks {
+		assert.EqualStrings(t, string(terramate.InheritedConfigChange), string(entry.Reason.Kind))
+		assert.EqualStrings(t, "/terramate.tm.hcl", entry.Reason.File.String())
 	}
 }
 
+func TestListChangedWithChangesCache(t *testing.T) {
+	repo := singleStackDependentRemoteModuleChangedRepo(t)
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+	gitdir, err := g.GitDir()
+	assert.NoError(t, err)
+	cachefile := filepath.Join(gitdir, terramate.ChangesCacheFile)
+
+	want, err := newManager(t, repo.Dir).ListChanged()
+	assert.NoError(t, err)
+
+	_, err = os.Stat(cachefile)
+	assert.IsTrue(t, errors.Is(err, os.ErrNotExist), "cache must be disabled by default")
+
+	for i := 0; i < 2; i++ {
+		got, err := newManager(t, repo.Dir).WithChangesCache().ListChanged()
+		assert.NoError(t, err)
+		test.AssertDiff(t, got.Stacks, want.Stacks)
+	}
+
+	stackfile := filepath.Join(repo.Dir, "stack", "main.tf")
+	assertCachedModules(t, cachefile, stackfile, []cachedModule{
+		{Name: "something", Source: "../modules/module1"},
+	})
+
+	// the modules of the files of the base ref are cached by their blob hash.
+	module2 := filepath.Join(repo.Dir, "modules", "module2")
+	blobs, err := test.NewGitWrapper(t, module2, []string{}).ListBlobs(defaultBranch)
+	assert.NoError(t, err)
+	assert.EqualInts(t, 1, len(blobs), "unexpected module2 files: %v", blobs)
+	assertCachedHash(t, cachefile, blobs[0].Hash, []cachedModule{
+		{Name: "vpc", Source: "git::https://example.com/vpc.git?ref=v1.2.0"},
+	})
+
+	// changing a file invalidates its cache entry.
+	test.WriteFile(t, filepath.Join(repo.Dir, "stack"), "main.tf", `
+module "something" {
+	source = "../modules/module1"
+}
+
+module "other" {
+	source = "../modules/module2"
+}
+`)
+
+	got, err := newManager(t, repo.Dir).WithChangesCache().ListChanged()
+	assert.NoError(t, err)
+	test.AssertDiff(t, got.Stacks, want.Stacks)
+
+	assertCachedModules(t, cachefile, stackfile, []cachedModule{
+		{Name: "something", Source: "../modules/module1"},
+		{Name: "other", Source: "../modules/module2"},
+	})
+
+	// invalid cache files are ignored and replaced.
+	test.WriteFile(t, gitdir, terramate.ChangesCacheFile, "not json")
+
+	got, err = newManager(t, repo.Dir).WithChangesCache().ListChanged()
+	assert.NoError(t, err)
+	test.AssertDiff(t, got.Stacks, want.Stacks)
+
+	assertCachedModules(t, cachefile, stackfile, []cachedModule{
+		{Name: "something", Source: "../modules/module1"},
+		{Name: "other", Source: "../modules/module2"},
+	})
+}
+
+func TestListChangedReusesCachedStackClosure(t *testing.T) {
+	repo := singleStackDependentRemoteModuleChangedRepo(t)
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+	gitdir, err := g.GitDir()
+	assert.NoError(t, err)
+	cachefile := filepath.Join(gitdir, terramate.ChangesCacheFile)
+
+	report, err := newManager(t, repo.Dir).WithChangesCache().ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/stack"}, report.Stacks, true)
+
+	cache := loadCacheFile(t, cachefile)
+	test.AssertDiff(t, cache.Stacks, map[string][]string{
+		"/stack": {"modules/module1", "modules/module2", "stack"},
+	})
+
+	// the cached module calls of a directory which files didn't change are
+	// used without parsing the files again.
+	module1 := cache.Dirs["modules/module1"]
+	module1.Modules = []cachedModule{}
+	cache.Dirs["modules/module1"] = module1
+	writeCacheFile(t, cachefile, cache)
+
+	report, err = newManager(t, repo.Dir).WithChangesCache().ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{}, report.Stacks, false)
+
+	// changing a file of the directory invalidates its cached module calls.
+	test.WriteFile(t, filepath.Join(repo.Dir, "modules", "module1"), "main.tf", `
+module "module1" {
+	source = "../module2"
+}
+
+# changed
+`)
+
+	report, err = newManager(t, repo.Dir).WithChangesCache().ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/stack"}, report.Stacks, true)
+}
+
+type cachedModule struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+func assertCachedModules(t *testing.T, cachefile, tffile string, want []cachedModule) {
+	t.Helper()
+
+	content, err := os.ReadFile(tffile)
+	assert.NoError(t, err)
+	assertCachedHash(t, cachefile, git.BlobHash(content), want)
+}
+
+type cacheFile struct {
+	Version int                       `json:"version"`
+	Modules map[string][]cachedModule `json:"modules"`
+	Dirs    map[string]cachedDir      `json:"dirs"`
+	Stacks  map[string][]string       `json:"stacks"`
+}
+
+type cachedDir struct {
+	Files   map[string]string `json:"files"`
+	Modules []cachedModule    `json:"modules"`
+}
+
+func loadCacheFile(t *testing.T, cachefile string) cacheFile {
+	t.Helper()
+
+	content, err := os.ReadFile(cachefile)
+	assert.NoError(t, err)
+
+	var cache cacheFile
+	assert.NoError(t, json.Unmarshal(content, &cache))
+	return cache
+}
+
+func writeCacheFile(t *testing.T, cachefile string, cache cacheFile) {
+	t.Helper()
+
+	content, err := json.Marshal(cache)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(cachefile, content, 0644))
+}
+
+func assertCachedHash(t *testing.T, cachefile, hash string, want []cachedModule) {
+	t.Helper()
+
+	cache := loadCacheFile(t, cachefile)
+	got, ok := cache.Modules[hash]
+	if !ok {
+		t.Fatalf("hash %s not found in the cache: %+v", hash, cache)
+	}
+	test.AssertDiff(t, got, want)
+}
+
 func assertStacks(
 	t *testing.T, want []string, got []terramate.Entry, wantReason bool,
 ) {
@@ -210,7 +584,7 @@ func assertStacks(
 	for i := 0; i < len(want); i++ {
 		assert.EqualStrings(t, want[i], got[i].Stack.Dir.String(), "path mismatch")
 
-		if wantReason && got[i].Reason == "" {
+		if wantReason && got[i].Reason.Kind == "" {
 			t.Errorf("stack [%s] has no reason", got[i].Stack.Dir)
 		}
 	}
@@ -556,6 +930,57 @@ module "module2" {
 	return repo
 }
 
+// singleStackDependentRemoteModuleChangedRepo creates a repository with a
+// stack calling a local module which calls another local module which bumps
+// the ref of a remote module on the branch.
+func singleStackDependentRemoteModuleChangedRepo(t *testing.T) repository {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	modules := test.Mkdir(t, repo.Dir, "modules")
+	module1 := test.Mkdir(t, modules, "module1")
+	module2 := test.Mkdir(t, modules, "module2")
+
+	repo.modules = append(repo.modules, module1, module2)
+
+	stack := test.Mkdir(t, repo.Dir, "stack")
+	root, err := config.LoadRoot(repo.Dir)
+	assert.NoError(t, err)
+	createStack(t, root, stack)
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	test.WriteFile(t, stack, "main.tf", `
+module "something" {
+	source = "../modules/module1"
+}
+`)
+	test.WriteFile(t, module1, "main.tf", `
+module "module2" {
+	source = "../module2"
+}
+`)
+	test.WriteFile(t, module2, "main.tf", `
+module "vpc" {
+	source = "git::https://example.com/vpc.git?ref=v1.2.0"
+}
+`)
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	assert.NoError(t, g.Checkout("change-module", true), "failed to create branch")
+	mainFile := test.WriteFile(t, module2, "main.tf", `
+module "vpc" {
+	source = "git::https://example.com/vpc.git?ref=v1.3.0"
+}
+`)
+
+	assert.NoError(t, g.Add(mainFile), "add main.tf")
+	assert.NoError(t, g.Commit("commit main.tf"), "commit main.tf")
+
+	return repo
+}
+
 func newManager(t *testing.T, basedir string) *terramate.Manager {
 	root, err := config.LoadRoot(basedir)
 	assert.NoError(t, err)
@@ -119,6 +119,12 @@ func AbsPath(root, prjAbsPath string) string {
 	return filepath.Join(root, prjAbsPath)
 }
 
+// IsGlobPattern tells if the path is a glob pattern, which must be matched
+// with doublestar.Match, instead of a plain path.
+func IsGlobPattern(pathstr string) bool {
+	return strings.ContainsAny(pathstr, "*?[{")
+}
+
 // FriendlyFmtDir formats the directory in a friendly way for tooling output.
 func FriendlyFmtDir(root, wd, dir string) (string, bool) {
 	logger := log.With().
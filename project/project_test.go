@@ -25,3 +25,19 @@ func TestPrjAbsPathOnRoot(t *testing.T) {
 	path := project.PrjAbsPath("/", "/file.hcl")
 	test.AssertEqualPaths(t, path, project.NewPath("/file.hcl"))
 }
+
+func TestIsGlobPattern(t *testing.T) {
+	for pathstr, want := range map[string]bool{
+		"/stacks/app":         false,
+		"../stacks/app":       false,
+		"/stacks/*":           true,
+		"/policies/**/*.rego": true,
+		"/stacks/app-?":       true,
+		"/stacks/[ab]":        true,
+		"/stacks/{a,b}":       true,
+	} {
+		if got := project.IsGlobPattern(pathstr); got != want {
+			t.Errorf("IsGlobPattern(%q) = %t, want %t", pathstr, got, want)
+		}
+	}
+}
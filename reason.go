@@ -0,0 +1,230 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terramate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mineiros-io/terramate/project"
+)
+
+// ChangeKind is the kind of change which caused a stack to be selected.
+type ChangeKind string
+
+const (
+	// StackFileChange means a file inside the stack directory changed.
+	StackFileChange ChangeKind = "stack-file"
+
+	// WatchedFileChange means a file watched by the stack changed.
+	WatchedFileChange ChangeKind = "watched-file"
+
+	// LocalModuleChange means a file of a local module called by the stack,
+	// directly or through other local modules, changed.
+	LocalModuleChange ChangeKind = "local-module"
+
+	// RemoteModuleChange means the source of a remote module called by a
+	// local module of the stack changed.
+	RemoteModuleChange ChangeKind = "remote-module"
+
+	// VendoredModuleChange means a module vendored with tm_vendor by the
+	// stack, or any module it calls, changed.
+	VendoredModuleChange ChangeKind = "vendored-module"
+
+	// TriggerChange means the stack was triggered.
+	TriggerChange ChangeKind = "trigger"
+
+	// WantedByChange means the stack is wanted by a selected stack.
+	WantedByChange ChangeKind = "wanted-by"
+
+	// ImportedConfigChange means a file imported by the stack configuration
+	// changed.
+	ImportedConfigChange ChangeKind = "imported-config"
+
+	// InheritedConfigChange means a Terramate file of a parent directory,
+	// inherited by the stack, changed.
+	InheritedConfigChange ChangeKind = "inherited-config"
+
+	// IgnoredChange means the changes of the stack are ignored because of an
+	// ignore-change trigger.
+	IgnoredChange ChangeKind = "ignore-change"
+)
+
+type (
+	// ChangeReason is the reason why a stack was selected.
+	ChangeReason struct {
+		// Kind is the kind of the change.
+		Kind ChangeKind
+
+		// File is the changed file, if any.
+		File project.Path
+
+		// Pattern is the watch pattern which matched the changed file, if the
+		// file is watched by a pattern.
+		Pattern string
+
+		// Modules is the chain of local modules, from the module called by
+		// the stack up to the changed one.
+		Modules []string
+
+		// RemoteModule is the remote module change, if any.
+		RemoteModule *RemoteModuleUpdate
+
+		// VendorSource is the source, as given to tm_vendor, of the vendored
+		// module which changed.
+		VendorSource string
+
+		// Commit is the most recent commit which changed the File, if any.
+		Commit string
+
+		// WantedBy is the stack which wants the stack.
+		WantedBy project.Path
+
+		// TriggerReason is the reason of the trigger, if the change is caused
+		// or ignored by a trigger.
+		TriggerReason string
+	}
+
+	// RemoteModuleUpdate is the change of the source of a remote module.
+	RemoteModuleUpdate struct {
+		Name      string
+		OldSource string
+		NewSource string
+
+		// OldRef and NewRef are only set when the source of the module kept
+		// the same and only the Git ref changed.
+		OldRef string
+		NewRef string
+	}
+)
+
+// String returns the human readable description of the change.
+func (r ChangeReason) String() string {
+	switch r.Kind {
+	case StackFileChange:
+		return "stack has unmerged changes"
+	case WatchedFileChange:
+		if r.Pattern != "" {
+			return fmt.Sprintf(
+				"stack changed because watched pattern %q matched changed file %q",
+				r.Pattern, r.File,
+			)
+		}
+		return fmt.Sprintf("stack changed because watched file %q changed", r.File)
+	case LocalModuleChange:
+		return fmt.Sprintf("stack changed because %s has unmerged changes",
+			r.moduleChain())
+	case RemoteModuleChange:
+		return fmt.Sprintf("stack changed because %s changed because %s",
+			r.moduleChain(), r.RemoteModule)
+	case VendoredModuleChange:
+		if r.RemoteModule != nil {
+			return fmt.Sprintf("stack changed because %s changed because %s",
+				r.moduleChain(), r.RemoteModule)
+		}
+		return fmt.Sprintf("stack changed because %s has unmerged changes",
+			r.moduleChain())
+	case TriggerChange:
+		return "stack has been triggered by: " + r.File.String()
+	case IgnoredChange:
+		return fmt.Sprintf("stack changes are ignored because of trigger %q: %s",
+			r.File, r.TriggerReason)
+	case WantedByChange:
+		return fmt.Sprintf("stack is wanted by stack %q", r.WantedBy)
+	case ImportedConfigChange:
+		return fmt.Sprintf(
+			"stack configuration changed because imported file %q changed",
+			r.File,
+		)
+	case InheritedConfigChange:
+		return fmt.Sprintf(
+			"stack configuration changed because inherited file %q changed",
+			r.File,
+		)
+	}
+	return ""
+}
+
+func (r ChangeReason) moduleChain() string {
+	mods := make([]string, len(r.Modules))
+	for i, mod := range r.Modules {
+		if i == 0 && r.VendorSource != "" {
+			// the first module is the vendor dir of the source.
+			mods[i] = fmt.Sprintf("vendored module %q", r.VendorSource)
+			continue
+		}
+		mods[i] = fmt.Sprintf("module %q", mod)
+	}
+	return strings.Join(mods, " changed because ")
+}
+
+// String returns the human readable description of the remote module change.
+func (u *RemoteModuleUpdate) String() string {
+	if u.OldRef != u.NewRef {
+		return fmt.Sprintf("remote module %q changed its ref from %q to %q",
+			u.Name, u.OldRef, u.NewRef)
+	}
+	return fmt.Sprintf("remote module %q changed its source from %q to %q",
+		u.Name, u.OldSource, u.NewSource)
+}
+
+type (
+	jsonChangeReason struct {
+		Kind          ChangeKind              `json:"kind"`
+		Description   string                  `json:"description"`
+		File          string                  `json:"file,omitempty"`
+		Pattern       string                  `json:"pattern,omitempty"`
+		Modules       []string                `json:"modules,omitempty"`
+		RemoteModule  *jsonRemoteModuleUpdate `json:"remote_module,omitempty"`
+		VendorSource  string                  `json:"vendor_source,omitempty"`
+		Commit        string                  `json:"commit,omitempty"`
+		WantedBy      string                  `json:"wanted_by,omitempty"`
+		TriggerReason string                  `json:"trigger_reason,omitempty"`
+	}
+
+	jsonRemoteModuleUpdate struct {
+		Name      string `json:"name"`
+		OldSource string `json:"old_source"`
+		NewSource string `json:"new_source"`
+		OldRef    string `json:"old_ref,omitempty"`
+		NewRef    string `json:"new_ref,omitempty"`
+	}
+)
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r ChangeReason) MarshalJSON() ([]byte, error) {
+	reason := jsonChangeReason{
+		Kind:          r.Kind,
+		Description:   r.String(),
+		File:          r.File.String(),
+		Pattern:       r.Pattern,
+		Modules:       r.Modules,
+		Commit:        r.Commit,
+		VendorSource:  r.VendorSource,
+		WantedBy:      r.WantedBy.String(),
+		TriggerReason: r.TriggerReason,
+	}
+	if r.RemoteModule != nil {
+		reason.RemoteModule = &jsonRemoteModuleUpdate{
+			Name:      r.RemoteModule.Name,
+			OldSource: r.RemoteModule.OldSource,
+			NewSource: r.RemoteModule.NewSource,
+			OldRef:    r.RemoteModule.OldRef,
+			NewRef:    r.RemoteModule.NewRef,
+		}
+	}
+	return json.Marshal(reason)
+}
@@ -16,10 +16,14 @@ package run
 
 import (
 	"os"
+	"sort"
 
 	"github.com/mineiros-io/terramate/config"
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/globals"
+	"github.com/mineiros-io/terramate/hcl/ast"
+	"github.com/mineiros-io/terramate/hcl/info"
+	"github.com/mineiros-io/terramate/project"
 	"github.com/mineiros-io/terramate/stack"
 	"github.com/rs/zerolog/log"
 	"github.com/zclconf/go-cty/cty"
@@ -43,19 +47,58 @@ const (
 // on os.Environ and can be used to set env on exec.Cmd.
 type EnvVars []string
 
+// EnvDefinition is an evaluated environment variable and the origin of its
+// definition.
+type EnvDefinition struct {
+	// Name of the environment variable.
+	Name string
+
+	// Value of the environment variable.
+	Value string
+
+	// Origin is where the environment variable is defined.
+	Origin info.Range
+}
+
 // LoadEnv will load environment variables to be exported when running any command
 // inside the given stack. The order of the env vars is guaranteed to be the same
 // and is ordered lexicographically.
 func LoadEnv(root *config.Root, st *config.Stack) (EnvVars, error) {
+	defs, err := LoadEnvDefinitions(root, st)
+	if err != nil {
+		return nil, err
+	}
+	return newEnvVars(defs), nil
+}
+
+func newEnvVars(defs []EnvDefinition) EnvVars {
+	if len(defs) == 0 {
+		return nil
+	}
+	envVars := make(EnvVars, len(defs))
+	for i, def := range defs {
+		envVars[i] = def.Name + "=" + def.Value
+	}
+	return envVars
+}
+
+// LoadEnvDefinitions is like [LoadEnv] but returns the origin of each
+// environment variable together with its value.
+//
+// The terramate.config.run.env blocks are loaded from the stack directory and
+// all its parent directories until the project root, with the definitions
+// closer to the stack overriding the ones of the parent directories.
+func LoadEnvDefinitions(root *config.Root, st *config.Stack) ([]EnvDefinition, error) {
 	logger := log.With().
-		Str("action", "run.Env()").
+		Str("action", "run.LoadEnvDefinitions()").
 		Str("root", root.HostDir()).
 		Stringer("stack", st).
 		Logger()
 
 	logger.Trace().Msg("checking if we have run env config")
 
-	if !root.Tree().Node.HasRunEnv() {
+	attrs := loadEnvAttrs(root, st.Dir)
+	if len(attrs) == 0 {
 		logger.Trace().Msg("no run env config found, nothing to do")
 		return nil, nil
 	}
@@ -70,9 +113,7 @@ func LoadEnv(root *config.Root, st *config.Stack) (EnvVars, error) {
 	evalctx := stack.NewEvalCtx(root, st, globalsReport.Globals)
 
 	evalctx.SetEnv(os.Environ())
-	envVars := EnvVars{}
-
-	attrs := root.Tree().Node.Terramate.Config.Run.Env.Attributes.SortedList()
+	defs := []EnvDefinition{}
 
 	for _, attr := range attrs {
 		logger = logger.With().
@@ -96,10 +137,44 @@ func LoadEnv(root *config.Root, st *config.Stack) (EnvVars, error) {
 				val.Type().FriendlyName(),
 			)
 		}
-		envVars = append(envVars, attr.Name+"="+val.AsString())
+		defs = append(defs, EnvDefinition{
+			Name:   attr.Name,
+			Value:  val.AsString(),
+			Origin: attr.Range,
+		})
 
 		logger.Trace().Msg("env var loaded")
 	}
 
-	return envVars, nil
+	return defs, nil
+}
+
+// loadEnvAttrs loads the terramate.config.run.env attributes defined on the
+// given directory and its parents, sorted by name. Attributes defined closer
+// to the directory override the ones defined on its parents.
+func loadEnvAttrs(root *config.Root, dir project.Path) []ast.Attribute {
+	attrs := map[string]ast.Attribute{}
+	for {
+		if tree, ok := root.Lookup(dir); ok && tree.Node.HasRunEnv() {
+			for name, attr := range tree.Node.Terramate.Config.Run.Env.Attributes {
+				if _, ok := attrs[name]; !ok {
+					attrs[name] = attr
+				}
+			}
+		}
+		parent := dir.Dir()
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	sorted := make([]ast.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		sorted = append(sorted, attr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
 }
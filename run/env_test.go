@@ -143,6 +143,79 @@ func TestLoadRunEnv(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "env defined on parent directories is merged",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				"s:other",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Str("root", "root"),
+						Str("overridden", "root"),
+					),
+				},
+				{
+					path: "/stacks",
+					add: runEnvCfg(
+						Str("overridden", "stacks"),
+						Str("stacks", "stacks"),
+					),
+				},
+				{
+					path: "/stacks/stack-1",
+					add: runEnvCfg(
+						Expr("stacks", `"${terramate.stack.name}"`),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					env: run.EnvVars{
+						"overridden=stacks",
+						"root=root",
+						"stacks=stack-1",
+					},
+				},
+				"stacks/stack-2": {
+					env: run.EnvVars{
+						"overridden=stacks",
+						"root=root",
+						"stacks=stacks",
+					},
+				},
+				"other": {
+					env: run.EnvVars{
+						"overridden=root",
+						"root=root",
+					},
+				},
+			},
+		},
+		{
+			name: "env defined only on stack directory",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stack",
+					add: runEnvCfg(
+						Str("env", "stack"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					env: run.EnvVars{
+						"env=stack",
+					},
+				},
+			},
+		},
 		{
 			name: "fails on invalid root config",
 			layout: []string{
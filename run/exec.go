@@ -20,22 +20,108 @@ import (
 	"os/exec"
 	"os/signal"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mineiros-io/terramate/config"
 	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
 	"github.com/mineiros-io/terramate/project"
 	"github.com/rs/zerolog/log"
 )
 
+// Options controls how commands are executed by [Exec].
+type Options struct {
+	// ContinueOnError defines if the execution must continue on the other
+	// stacks in case of errors.
+	ContinueOnError bool
+
+	// Parallel is the maximum number of commands running at the same time.
+	Parallel int
+
+	// PrefixOutput defines if each line of the commands output must be
+	// prefixed with the path of the stack.
+	PrefixOutput bool
+
+	// LogDir, if not empty, is the directory where the output of each stack
+	// is saved, together with its exit status and duration.
+	// See [LogFilePath] and [LogStatusFilePath].
+	LogDir string
+
+	// State, if not nil, is updated and saved with the status of each stack
+	// as soon as its command finishes, so the run can be resumed later.
+	State *State
+
+	// Timeout is the maximum duration of each attempt of executing the
+	// commands on a stack. Zero means no timeout.
+	Timeout time.Duration
+
+	// Retries is the number of times the commands of a failed stack are
+	// executed again.
+	Retries int
+
+	// RetryDelay is the duration to wait before each retry.
+	RetryDelay time.Duration
+}
+
+// WithRetryPolicy returns a copy of the options with the timeout and retries
+// defined on the given terramate.config.run, which may be nil, overridden by
+// the given values when they are not nil.
+func (opts Options) WithRetryPolicy(
+	cfg *hcl.RunConfig,
+	timeout *time.Duration,
+	retries *int,
+	retryDelay *time.Duration,
+) Options {
+	if cfg != nil {
+		opts.Timeout = cfg.Timeout
+		opts.Retries = cfg.Retries
+		opts.RetryDelay = cfg.RetryDelay
+	}
+	if timeout != nil {
+		opts.Timeout = *timeout
+	}
+	if retries != nil {
+		opts.Retries = *retries
+	}
+	if retryDelay != nil {
+		opts.RetryDelay = *retryDelay
+	}
+	return opts
+}
+
+// ErrTimeout indicates the commands of a stack didn't finish before the
+// configured timeout.
+const ErrTimeout errors.Kind = "command timed out"
+
+// timeoutKillDelay is how long a command that timed out has to exit after
+// being interrupted, before it is killed.
+const timeoutKillDelay = 10 * time.Second
+
 // Exec will execute the given command on the given stack list
 // During the execution of this function the default behavior
 // for signal handling will be changed so we can wait for the child
 // process to exit before exiting Terramate.
 //
+// The returned report has the result of each stack, in the same order of the
+// given stacks, even when an error is returned.
+//
 // If continue on error is true this function will continue to execute
 // commands on stacks even in face of failures, returning an error.L with all errors.
 // If continue on error is false it will return as soon as it finds an error,
 // returning a list with a single error inside.
+//
+// The parallel option defines how many commands may run at the same time.
+// When it is bigger than one, each stack starts as soon as all the stacks that
+// must run before it, according to the stacks ordering, have finished.
+// On this mode, if continue on error is true, stacks that depend on a failed
+// stack are skipped.
+//
+// When a timeout is defined, a stack running for longer than the timeout is
+// interrupted and, if it does not exit after a grace period, killed.
+// Failed stacks are retried according to the retries option, and the error
+// of each failed attempt is returned. The timeout and retries can be
+// overridden per stack.
 func Exec(
 	root *config.Root,
 	stacks config.List[*config.SortableStack],
@@ -43,27 +129,138 @@ func Exec(
 	stdin io.Reader,
 	stdout io.Writer,
 	stderr io.Writer,
-	continueOnError bool,
-) error {
+	opts Options,
+) (Report, error) {
+	stackCmds := make([][][]string, len(stacks))
+	for i := range stacks {
+		stackCmds[i] = [][]string{cmd}
+	}
+	return execStacks(root, stacks, cmd, stackCmds, stdin, stdout, stderr, opts)
+}
+
+// ExecScript will execute the script with the given name on the given stack
+// list. The commands of the script are evaluated for each stack and executed
+// in order, stopping on the first failed command of the stack.
+// The execution of the stacks behaves exactly like [Exec].
+func ExecScript(
+	root *config.Root,
+	stacks config.List[*config.SortableStack],
+	name string,
+	stdin io.Reader,
+	stdout io.Writer,
+	stderr io.Writer,
+	opts Options,
+) (Report, error) {
+	logger := log.With().
+		Str("action", "run.ExecScript()").
+		Str("script", name).
+		Logger()
+
+	logger.Trace().Msg("loading script commands of each stack")
+
+	errs := errors.L()
+	stackCmds := make([][][]string, len(stacks))
+	for i, elem := range stacks {
+		cmds, err := LoadScriptCmds(root, elem.Stack, name)
+		errs.Append(err)
+		stackCmds[i] = cmds
+	}
+
+	cmd := []string{"script", "run", name}
+	if err := errs.AsError(); err != nil {
+		return newReport(stacks, cmd, stackCmds), err
+	}
+	return execStacks(root, stacks, cmd, stackCmds, stdin, stdout, stderr, opts)
+}
+
+func newReport(
+	stacks config.List[*config.SortableStack],
+	cmd []string,
+	stackCmds [][][]string,
+) Report {
+	report := Report{
+		Cmd:       cmd,
+		StartedAt: time.Now(),
+		Results:   make([]StackResult, len(stacks)),
+	}
+	for i, elem := range stacks {
+		report.Results[i] = StackResult{
+			Stack:    elem.Stack,
+			Status:   StatusNotRun,
+			ExitCode: -1,
+		}
+		if len(stackCmds[i]) > 0 {
+			report.Results[i].Cmd = stackCmds[i][0]
+		}
+	}
+	return report
+}
+
+func execStacks(
+	root *config.Root,
+	stacks config.List[*config.SortableStack],
+	cmd []string,
+	stackCmds [][][]string,
+	stdin io.Reader,
+	stdout io.Writer,
+	stderr io.Writer,
+	opts Options,
+) (Report, error) {
 	logger := log.With().
 		Str("action", "run.Exec()").
 		Str("cmd", strings.Join(cmd, " ")).
+		Int("parallel", opts.Parallel).
 		Logger()
 
 	const signalsBuffer = 10
 
+	report := newReport(stacks, cmd, stackCmds)
+
+	if opts.Parallel < 1 {
+		return report, errors.E("parallel must be at least 1 but got %d", opts.Parallel)
+	}
+	if opts.Retries < 0 {
+		return report, errors.E("retries must not be negative but got %d", opts.Retries)
+	}
+
 	errs := errors.L()
 	stackEnvs := map[project.Path]EnvVars{}
+	stackHooks := map[project.Path]Hooks{}
 
-	logger.Trace().Msg("loading stacks run environment variables")
+	logger.Trace().Msg("loading stacks run environment variables and hooks")
 	for _, elem := range stacks {
 		env, err := LoadEnv(root, elem.Stack)
 		errs.Append(err)
 		stackEnvs[elem.Dir()] = env
+
+		hooks, err := LoadHooks(root, elem.Stack, env)
+		errs.Append(err)
+		stackHooks[elem.Dir()] = hooks
 	}
 
 	if errs.AsError() != nil {
-		return errs.AsError()
+		return report, errs.AsError()
+	}
+
+	// When running serially the stacks run exactly in the order provided,
+	// so there is no need to compute dependencies.
+	var deps [][]int
+	if opts.Parallel > 1 {
+		logger.Trace().Msg("computing stacks dependencies")
+
+		var err error
+		deps, err = Dependencies(root, stacks)
+		if err != nil {
+			return report, errors.E(err, "computing stacks dependencies")
+		}
+	}
+
+	if opts.State != nil {
+		logger.Trace().Msg("saving initial run state")
+
+		if err := opts.State.Save(); err != nil {
+			return report, err
+		}
 	}
 
 	logger.Trace().Msg("loaded stacks run environment variables, running commands")
@@ -72,83 +269,572 @@ func Exec(
 	signal.Notify(signals, os.Interrupt)
 	defer signal.Reset(os.Interrupt)
 
-	cmds := make(chan *exec.Cmd)
-	defer close(cmds)
+	outputMutex := &sync.Mutex{}
+	stdout = opts.sharedOutput(stdout, outputMutex)
+	stderr = opts.sharedOutput(stderr, outputMutex)
+
+	results := make(chan cmdResult)
+	running := map[int]*stackRun{}
+	status := make([]stackStatus, len(stacks))
+	interruptions := 0
+	stop := false
+
+	// canStart tells if the stack at the given index can be started and
+	// marks it as skipped if any of its dependencies failed.
+	canStart := func(i int) bool {
+		if deps == nil {
+			return true
+		}
+		for _, dep := range deps[i] {
+			switch status[dep] {
+			case stackFailed, stackSkipped:
+				logger.Warn().
+					Stringer("stack", stacks[i]).
+					Stringer("failed", stacks[dep]).
+					Msg("skipping stack since a stack that must run before it has failed")
 
-	results := startCmdRunner(cmds)
+				status[i] = stackSkipped
+				report.Results[i].Status = StatusSkipped
+				return false
+			case stackSucceeded:
+			default:
+				return false
+			}
+		}
+		return true
+	}
 
-	for _, stack := range stacks {
-		logger := log.With().
-			Str("cmd", strings.Join(cmd, " ")).
-			Stringer("stack", stack).
-			Logger()
+	// finish releases the resources of the stack run and records its result.
+	// The command and exit code of the result are the ones of the stack
+	// command, the failures of the hooks are recorded separately.
+	finish := func(i int, run *stackRun, cmdErr, hookErr error) {
+		res := &report.Results[i]
+		res.StartedAt = run.start
+		res.FinishedAt = time.Now()
+		if run.command != nil {
+			res.Cmd = run.command.Args
+			if run.command.ProcessState != nil {
+				res.ExitCode = run.command.ProcessState.ExitCode()
+			}
+		}
+		res.Error = cmdErr
+		res.HookError = hookErr
+		if cmdErr != nil || hookErr != nil {
+			status[i] = stackFailed
+			res.Status = StatusFailed
+		} else {
+			status[i] = stackSucceeded
+			res.Status = StatusSucceeded
+		}
+		errs.Append(run.finish(opts.LogDir, *res))
 
-		cmd := exec.Command(cmd[0], cmd[1:]...)
-		cmd.Dir = stack.HostDir(root)
-		cmd.Env = append(os.Environ(), stackEnvs[stack.Dir()]...)
-		cmd.Stdin = stdin
-		cmd.Stdout = stdout
-		cmd.Stderr = stderr
+		if opts.State != nil {
+			opts.State.SetStatus(res.Stack.Dir, res.Status)
+			if err := opts.State.Save(); err != nil {
+				logger.Warn().Err(err).Msg("saving run state")
+			}
+		}
+	}
 
-		logger.Info().Msg("running")
+	startStacks := func() {
+		for i, stack := range stacks {
+			if stop || len(running) >= opts.Parallel {
+				return
+			}
+			if status[i] != stackPending || !canStart(i) {
+				continue
+			}
 
-		if err := cmd.Start(); err != nil {
-			errs.Append(errors.E(stack, err, "running %s", cmd))
-			if continueOnError {
+			run, err := newStackRun(stackCmds[i], stack.Dir(), stdout, stderr, opts)
+			if err != nil {
+				err = errors.E(err, "running on stack %s", stack.Dir())
+				errs.Append(err)
+				status[i] = stackFailed
+				report.Results[i].Status = StatusFailed
+				report.Results[i].Error = err
+				if !opts.ContinueOnError {
+					stop = true
+				}
 				continue
 			}
-			return errs.AsError()
+
+			run.hooks = stackHooks[stack.Dir()]
+			run.policy = opts.retryPolicy(stack.Stack)
+			run.dir = stack.HostDir(root)
+			run.env = append(os.Environ(), stackEnvs[stack.Dir()]...)
+			run.stdin = stdin
+
+			status[i] = stackRunning
+			running[i] = run
+
+			go func(i int, run *stackRun) {
+				err, hookErr := run.run()
+				results <- cmdResult{index: i, err: err, hookErr: hookErr}
+			}(i, run)
 		}
+	}
 
-		cmds <- cmd
-		interruptions := 0
-		cmdIsRunning := true
+	for {
+		startStacks()
 
-		for cmdIsRunning {
-			select {
-			case sig := <-signals:
-				interruptions++
+		if len(running) == 0 {
+			break
+		}
 
-				logger.Info().
-					Str("signal", sig.String()).
-					Int("interruptions", interruptions).
-					Msg("received interruption signal")
+		select {
+		case sig := <-signals:
+			interruptions++
 
-				if interruptions >= 3 {
-					logger.Info().Msg("interrupted 3x times or more, killing child process")
+			logger.Info().
+				Str("signal", sig.String()).
+				Int("interruptions", interruptions).
+				Msg("received interruption signal")
 
-					if err := cmd.Process.Kill(); err != nil {
-						logger.Debug().Err(err).Msg("unable to send kill signal to child process")
-					}
+			if !stop {
+				logger.Info().Msg("interrupting execution of further stacks")
+				stop = true
+
+				for _, run := range running {
+					run.stopRetrying()
 				}
-			case err := <-results:
-				logger.Trace().Msg("got command result")
-				if err != nil {
-					errs.Append(errors.E(err, "running %s (at stack %s)", cmd, stack.Dir()))
-					if !continueOnError {
-						return errs.AsError()
+			}
+
+			if interruptions >= 3 {
+				logger.Info().Msg("interrupted 3x times or more, killing child processes")
+
+				for i, run := range running {
+					if err := run.kill(); err != nil {
+						logger.Debug().
+							Err(err).
+							Stringer("stack", stacks[i]).
+							Msg("unable to send kill signal to child process")
 					}
 				}
-				cmdIsRunning = false
 			}
+		case res := <-results:
+			stack := stacks[res.index]
+			run := running[res.index]
+			delete(running, res.index)
+
+			logger.Trace().
+				Stringer("stack", stack).
+				Msg("got command result")
+
+			if res.err != nil || res.hookErr != nil {
+				errs.Append(res.err, res.hookErr)
+				finish(res.index, run, res.err, res.hookErr)
+				if !opts.ContinueOnError {
+					stop = true
+				}
+				continue
+			}
+			finish(res.index, run, nil, nil)
 		}
+	}
 
-		if interruptions > 0 {
-			logger.Info().Msg("interrupting execution of further stacks")
-			return errs.AsError()
+	if opts.State != nil {
+		for _, res := range report.Results {
+			opts.State.SetStatus(res.Stack.Dir, res.Status)
 		}
+		errs.Append(opts.State.Save())
 	}
 
-	return errs.AsError()
+	report.FinishedAt = time.Now()
+	return report, errs.AsError()
 }
 
-func startCmdRunner(cmds <-chan *exec.Cmd) <-chan error {
-	errs := make(chan error)
-	go func() {
-		for cmd := range cmds {
-			errs <- cmd.Wait()
+// sharedOutput returns the writer to be shared by all the commands.
+// Files are used directly by the commands, so terminals are correctly
+// detected by them, unless the output needs to be processed.
+func (opts Options) sharedOutput(w io.Writer, mu *sync.Mutex) io.Writer {
+	if _, ok := w.(*os.File); ok && !opts.PrefixOutput && opts.LogDir == "" {
+		return w
+	}
+	return &syncWriter{mu: mu, w: w}
+}
+
+// retryPolicy defines the timeout and retries of the commands of a stack.
+type retryPolicy struct {
+	timeout time.Duration
+	retries int
+	delay   time.Duration
+}
+
+// retryPolicy returns the retry policy of the given stack, which may
+// override the options.
+func (opts Options) retryPolicy(st *config.Stack) retryPolicy {
+	policy := retryPolicy{
+		timeout: opts.Timeout,
+		retries: opts.Retries,
+		delay:   opts.RetryDelay,
+	}
+	if st.RunTimeout != nil {
+		policy.timeout = *st.RunTimeout
+	}
+	if st.RunRetries != nil {
+		policy.retries = *st.RunRetries
+	}
+	if st.RunRetryDelay != nil {
+		policy.delay = *st.RunRetryDelay
+	}
+	return policy
+}
+
+type stackRun struct {
+	cmds     [][]string
+	hooks    Hooks
+	policy   retryPolicy
+	stackdir project.Path
+	dir      string
+	env      []string
+	stdin    io.Reader
+
+	stdout io.Writer
+	stderr io.Writer
+
+	start   time.Time
+	logfile *os.File
+	flush   []*prefixWriter
+
+	// command is the last stack command executed on the last attempt,
+	// excluding the hooks, which defines the result of the run.
+	command *exec.Cmd
+
+	// mu protects the fields below, which are accessed when the run is
+	// killed or times out while the commands are executing.
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	killed   bool
+	attempt  int
+	timedOut bool
+	stopped  bool
+	stop     chan struct{}
+}
+
+func newStackRun(
+	cmds [][]string,
+	stackdir project.Path,
+	stdout, stderr io.Writer,
+	opts Options,
+) (*stackRun, error) {
+	run := &stackRun{
+		cmds:     cmds,
+		stackdir: stackdir,
+		start:    time.Now(),
+		stop:     make(chan struct{}),
+	}
+
+	if opts.PrefixOutput {
+		prefix := []byte("[" + stackdir.String() + "] ")
+		prefixedOut := &prefixWriter{w: stdout, prefix: prefix}
+		prefixedErr := &prefixWriter{w: stderr, prefix: prefix}
+		run.flush = append(run.flush, prefixedOut, prefixedErr)
+		stdout, stderr = prefixedOut, prefixedErr
+	}
+
+	if opts.LogDir != "" {
+		logfile, err := createLogFile(opts.LogDir, stackdir)
+		if err != nil {
+			return nil, err
+		}
+		run.logfile = logfile
+		stdout = io.MultiWriter(stdout, logfile)
+		stderr = io.MultiWriter(stderr, logfile)
+	}
+
+	run.stdout = stdout
+	run.stderr = stderr
+	return run, nil
+}
+
+// run executes the commands of the stack, retrying them according to the
+// retry policy of the stack. The errors of the stack commands and of the
+// hooks of each failed attempt are returned separately.
+// If the last attempt fails the on_failure hooks are executed.
+func (run *stackRun) run() (cmdErr error, hookErr error) {
+	logger := log.With().
+		Str("action", "run.stackRun.run()").
+		Stringer("stack", run.stackdir).
+		Logger()
+
+	cmdErrs := errors.L()
+	hookErrs := errors.L()
+	attempts := run.policy.retries + 1
+	for attempt := 1; ; attempt++ {
+		cmdErr, hookErr := run.runAttempt(attempt)
+		if cmdErr == nil && hookErr == nil {
+			return nil, nil
+		}
+		if attempts > 1 {
+			if cmdErr != nil {
+				cmdErr = errors.E(cmdErr, "attempt %d of %d", attempt, attempts)
+			}
+			if hookErr != nil {
+				hookErr = errors.E(hookErr, "attempt %d of %d", attempt, attempts)
+			}
+		}
+		cmdErrs.Append(cmdErr)
+		hookErrs.Append(hookErr)
+
+		if attempt == attempts || !run.wait(run.policy.delay) {
+			break
+		}
+
+		logger.Warn().
+			Err(errors.L(cmdErr, hookErr).AsError()).
+			Int("attempt", attempt+1).
+			Int("attempts", attempts).
+			Msg("command failed, retrying")
+	}
+
+	if len(run.hooks.OnFailure) > 0 {
+		// The timeout of the last attempt must not prevent the on_failure
+		// hooks from running, since timeouts are failures too.
+		run.mu.Lock()
+		run.attempt = 0
+		run.timedOut = false
+		run.mu.Unlock()
+
+		if _, err := run.execCmds(run.hooks.OnFailure); err != nil {
+			hookErrs.Append(errors.E(err, "running on_failure hook"))
+		}
+	}
+	return cmdErrs.AsError(), hookErrs.AsError()
+}
+
+// runAttempt executes the commands of the stack in order, surrounded by the
+// before_each and after_each hooks, stopping on the first command that fails
+// or when the timeout of the stack expires. The error of the stack commands
+// and the error of the hooks are returned separately.
+func (run *stackRun) runAttempt(attempt int) (cmdErr error, hookErr error) {
+	run.mu.Lock()
+	run.attempt = attempt
+	run.timedOut = false
+	run.mu.Unlock()
+
+	if run.policy.timeout > 0 {
+		timer := time.AfterFunc(run.policy.timeout, func() {
+			run.expire(attempt)
+		})
+		defer timer.Stop()
+	}
+
+	cmdErr, hookErr = run.execAttempt()
+
+	run.mu.Lock()
+	timedOut := run.timedOut
+	run.mu.Unlock()
+
+	if timedOut {
+		if cmdErr != nil {
+			cmdErr = errors.E(ErrTimeout, cmdErr, "timeout of %s expired", run.policy.timeout)
+		}
+		if hookErr != nil {
+			hookErr = errors.E(ErrTimeout, hookErr, "timeout of %s expired", run.policy.timeout)
+		}
+	}
+	return cmdErr, hookErr
+}
+
+// execAttempt executes the before_each hooks, the stack commands and the
+// after_each hooks, recording the last executed stack command.
+func (run *stackRun) execAttempt() (cmdErr error, hookErr error) {
+	run.command = nil
+
+	if _, err := run.execCmds(run.hooks.BeforeEach); err != nil {
+		return nil, errors.E(err, "running before_each hook")
+	}
+
+	command, err := run.execCmds(run.cmds)
+	run.command = command
+	if err != nil {
+		return err, nil
+	}
+
+	if _, err := run.execCmds(run.hooks.AfterEach); err != nil {
+		return nil, errors.E(err, "running after_each hook")
+	}
+	return nil, nil
+}
+
+// execCmds executes the given commands in order, stopping on the first
+// command that fails. It returns the last executed command.
+func (run *stackRun) execCmds(cmds [][]string) (*exec.Cmd, error) {
+	var last *exec.Cmd
+	for _, args := range cmds {
+		log.Info().
+			Str("cmd", strings.Join(args, " ")).
+			Stringer("stack", run.stackdir).
+			Msg("running")
+
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = run.dir
+		cmd.Env = run.env
+		cmd.Stdin = run.stdin
+		cmd.Stdout = run.stdout
+		cmd.Stderr = run.stderr
+
+		run.mu.Lock()
+		if run.killed {
+			run.mu.Unlock()
+			return last, errors.E("killed before running %s", cmd)
+		}
+		if run.timedOut {
+			run.mu.Unlock()
+			return last, errors.E("timed out before running %s", cmd)
+		}
+		run.cmd = cmd
+		err := cmd.Start()
+		run.mu.Unlock()
+
+		last = cmd
+		if err != nil {
+			return last, errors.E(err, "running %s", cmd)
+		}
+		if err := cmd.Wait(); err != nil {
+			return last, errors.E(err, "running %s (at stack %s)", cmd, run.stackdir)
 		}
-		close(errs)
-	}()
-	return errs
+	}
+	return last, nil
+}
+
+// kill kills the running command, if any, and prevents any further
+// commands of the stack from running.
+func (run *stackRun) kill() error {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	run.killed = true
+	run.stopLocked()
+	if run.cmd == nil || run.cmd.Process == nil {
+		return nil
+	}
+	return run.cmd.Process.Kill()
+}
+
+// stopRetrying prevents any further attempts of the stack from starting.
+func (run *stackRun) stopRetrying() {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	run.stopLocked()
+}
+
+func (run *stackRun) stopLocked() {
+	if !run.stopped {
+		run.stopped = true
+		close(run.stop)
+	}
+}
+
+// wait waits for the given delay before a new attempt, returning false if
+// the run was stopped and must not be attempted again.
+func (run *stackRun) wait(delay time.Duration) bool {
+	select {
+	case <-run.stop:
+		return false
+	default:
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-run.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// expire handles the timeout of the given attempt. The running command is
+// interrupted, the same way as when Terramate is interrupted, and killed if
+// it is still running after a grace period.
+func (run *stackRun) expire(attempt int) {
+	logger := log.With().
+		Str("action", "run.stackRun.expire()").
+		Stringer("stack", run.stackdir).
+		Dur("timeout", run.policy.timeout).
+		Logger()
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if run.attempt != attempt {
+		return
+	}
+
+	logger.Warn().Msg("timeout expired, interrupting command")
+
+	run.timedOut = true
+	if run.cmd == nil || run.cmd.Process == nil {
+		return
+	}
+
+	cmd := run.cmd
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		logger.Debug().Err(err).Msg("unable to interrupt command, killing it")
+
+		_ = cmd.Process.Kill()
+		return
+	}
+
+	time.AfterFunc(timeoutKillDelay, func() {
+		run.mu.Lock()
+		defer run.mu.Unlock()
+
+		if run.cmd != cmd {
+			return
+		}
+
+		if err := cmd.Process.Kill(); err == nil {
+			logger.Warn().Msg("killed command still running after interruption")
+		}
+	})
+}
+
+// finish flushes the output of the command, closes its log file and
+// records its exit status.
+func (run *stackRun) finish(logdir string, res StackResult) error {
+	errs := errors.L()
+	for _, w := range run.flush {
+		errs.Append(w.Flush())
+	}
+
+	if run.logfile == nil {
+		return errs.AsError()
+	}
+
+	errs.Append(run.logfile.Close())
+
+	status := LogStatus{
+		ExitCode:   res.ExitCode,
+		StartedAt:  res.StartedAt,
+		FinishedAt: res.FinishedAt,
+		Duration:   res.Duration().Seconds(),
+	}
+	if res.Error != nil {
+		status.Error = res.Error.Error()
+	}
+	if res.HookError != nil {
+		status.HookError = res.HookError.Error()
+	}
+	errs.Append(writeLogStatus(logdir, res.Stack.Dir, status))
+	return errs.AsError()
+}
+
+type stackStatus int
+
+const (
+	stackPending stackStatus = iota
+	stackRunning
+	stackSucceeded
+	stackFailed
+	stackSkipped
+)
+
+type cmdResult struct {
+	index   int
+	err     error
+	hookErr error
 }
@@ -0,0 +1,127 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"os"
+
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/globals"
+	"github.com/mineiros-io/terramate/hcl/ast"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ErrHookEval indicates that an error happened while evaluating one of
+	// the terramate.config.run hooks.
+	ErrHookEval errors.Kind = "evaluating terramate.config.run hook"
+
+	// ErrInvalidHookCmds indicates a hook doesn't evaluate to a list of
+	// commands.
+	ErrInvalidHookCmds errors.Kind = "invalid terramate.config.run hook commands"
+)
+
+// Hooks are the commands executed on each stack around the command being run.
+type Hooks struct {
+	// BeforeEach are the commands executed before the command.
+	BeforeEach [][]string
+
+	// AfterEach are the commands executed after the command succeeds.
+	AfterEach [][]string
+
+	// OnFailure are the commands executed when the command, or any of the
+	// before_each and after_each commands, fail.
+	OnFailure [][]string
+}
+
+// LoadHooks will load the hooks configured on terramate.config.run to be
+// executed when running any command inside the given stack. The hooks are
+// evaluated the same way as the terramate.config.run.env attributes, but with
+// the given run environment of the stack exported, so the hooks see the same
+// environment as the command they run around.
+func LoadHooks(root *config.Root, st *config.Stack, env EnvVars) (Hooks, error) {
+	logger := log.With().
+		Str("action", "run.LoadHooks()").
+		Str("root", root.HostDir()).
+		Stringer("stack", st).
+		Logger()
+
+	logger.Trace().Msg("checking if we have run hooks config")
+
+	cfg := root.Tree().Node
+	if cfg.Terramate == nil ||
+		cfg.Terramate.Config == nil ||
+		cfg.Terramate.Config.Run == nil {
+		logger.Trace().Msg("no run config found, nothing to do")
+		return Hooks{}, nil
+	}
+
+	runcfg := cfg.Terramate.Config.Run
+	if runcfg.BeforeEach == nil && runcfg.AfterEach == nil && runcfg.OnFailure == nil {
+		logger.Trace().Msg("no run hooks found, nothing to do")
+		return Hooks{}, nil
+	}
+
+	logger.Trace().Msg("loading globals")
+
+	globalsReport := globals.ForStack(root, st)
+	if err := globalsReport.AsError(); err != nil {
+		return Hooks{}, errors.E(ErrLoadingGlobals, err)
+	}
+
+	evalctx := stack.NewEvalCtx(root, st, globalsReport.Globals)
+	evalctx.SetEnv(append(os.Environ(), env...))
+
+	evalHook := func(attr *ast.Attribute) ([][]string, error) {
+		if attr == nil {
+			return nil, nil
+		}
+
+		logger.Trace().
+			Str("hook", attr.Name).
+			Msg("evaluating")
+
+		val, err := evalctx.Eval(attr.Expr)
+		if err != nil {
+			return nil, errors.E(ErrHookEval, err, "evaluating %s", attr.Name)
+		}
+		cmds, err := valueAsCmds(val)
+		if err != nil {
+			return nil, errors.E(ErrInvalidHookCmds, attr.Range, err)
+		}
+		return cmds, nil
+	}
+
+	errs := errors.L()
+
+	var hooks Hooks
+	var err error
+
+	hooks.BeforeEach, err = evalHook(runcfg.BeforeEach)
+	errs.Append(err)
+
+	hooks.AfterEach, err = evalHook(runcfg.AfterEach)
+	errs.Append(err)
+
+	hooks.OnFailure, err = evalHook(runcfg.OnFailure)
+	errs.Append(err)
+
+	if err := errs.AsError(); err != nil {
+		return Hooks{}, err
+	}
+	return hooks, nil
+}
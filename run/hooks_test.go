@@ -0,0 +1,224 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"path"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/test"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestLoadRunHooks(t *testing.T) {
+	type (
+		result struct {
+			hooks run.Hooks
+			err   error
+		}
+		testcase struct {
+			name    string
+			hostenv map[string]string
+			layout  []string
+			want    map[string]result
+		}
+	)
+
+	tcases := []testcase{
+		{
+			name: "no run config",
+			layout: []string{
+				"s:stack",
+			},
+			want: map[string]result{
+				"stack": {},
+			},
+		},
+		{
+			name: "run config without hooks",
+			layout: []string{
+				"s:stack",
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      check_gen_code = false
+				    }
+				  }
+				}`,
+			},
+			want: map[string]result{
+				"stack": {},
+			},
+		},
+		{
+			name: "hooks evaluated for each stack",
+			hostenv: map[string]string{
+				"TESTING_RUN_HOOK": "from-env",
+			},
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      before_each = [
+				        ["assume-role", global.role],
+				        ["echo", env.TESTING_RUN_HOOK],
+				      ]
+				      after_each = [["upload", "${terramate.stack.path.relative}/plan.out"]]
+				      on_failure = [["notify", terramate.stack.name]]
+				    }
+				  }
+				}
+				globals {
+				  role = "admin"
+				}`,
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					hooks: run.Hooks{
+						BeforeEach: [][]string{
+							{"assume-role", "admin"},
+							{"echo", "from-env"},
+						},
+						AfterEach: [][]string{{"upload", "stacks/stack-1/plan.out"}},
+						OnFailure: [][]string{{"notify", "stack-1"}},
+					},
+				},
+				"stacks/stack-2": {
+					hooks: run.Hooks{
+						BeforeEach: [][]string{
+							{"assume-role", "admin"},
+							{"echo", "from-env"},
+						},
+						AfterEach: [][]string{{"upload", "stacks/stack-2/plan.out"}},
+						OnFailure: [][]string{{"notify", "stack-2"}},
+					},
+				},
+			},
+		},
+		{
+			name: "hooks evaluated with the stack run env",
+			hostenv: map[string]string{
+				"TESTING_RUN_HOOK": "from-host",
+			},
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      env {
+				        TESTING_RUN_HOOK = "from-root"
+				      }
+				      before_each = [["echo", env.TESTING_RUN_HOOK]]
+				    }
+				  }
+				}`,
+				`f:stacks/stack-2/env.tm:
+				terramate {
+				  config {
+				    run {
+				      env {
+				        TESTING_RUN_HOOK = "from-stack"
+				      }
+				    }
+				  }
+				}`,
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					hooks: run.Hooks{
+						BeforeEach: [][]string{{"echo", "from-root"}},
+					},
+				},
+				"stacks/stack-2": {
+					hooks: run.Hooks{
+						BeforeEach: [][]string{{"echo", "from-stack"}},
+					},
+				},
+			},
+		},
+		{
+			name: "hook is not a list of commands",
+			layout: []string{
+				"s:stack",
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      before_each = ["echo", "hi"]
+				    }
+				  }
+				}`,
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrInvalidHookCmds)},
+			},
+		},
+		{
+			name: "hook with undefined global",
+			layout: []string{
+				"s:stack",
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      on_failure = [["echo", global.undefined]]
+				    }
+				  }
+				}`,
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrHookEval)},
+			},
+		},
+	}
+
+	for _, tcase := range tcases {
+		t.Run(tcase.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree(tcase.layout)
+
+			for name, value := range tcase.hostenv {
+				t.Setenv(name, value)
+			}
+
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+
+			for stackRelPath, wantres := range tcase.want {
+				stack, err := config.LoadStack(root, project.NewPath(path.Join("/", stackRelPath)))
+				assert.NoError(t, err)
+
+				env, err := run.LoadEnv(root, stack)
+				assert.NoError(t, err)
+
+				gothooks, err := run.LoadHooks(root, stack, env)
+				errorstest.Assert(t, err, wantres.err)
+				test.AssertDiff(t, gothooks, wantres.hooks)
+			}
+		})
+	}
+}
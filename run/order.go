@@ -32,20 +32,149 @@ import (
 // In the case of multiple possible orders, it returns the lexicographic sorted
 // path.
 func Sort(root *config.Root, stacks config.List[*config.SortableStack]) (config.List[*config.SortableStack], string, error) {
-	d := dag.New()
-
 	logger := log.With().
 		Str("action", "run.Sort()").
 		Str("root", root.HostDir()).
 		Logger()
 
-	logger.Trace().Msg("Computes implicit hierarchical order.")
+	sort.Sort(stacks)
 
-	isParentStack := func(s1, s2 *config.Stack) bool {
-		return s1.Dir.HasPrefix(s2.Dir.String() + "/")
+	d, reason, err := buildOrderDAG(root, stacks)
+	if err != nil {
+		return nil, reason, err
 	}
 
-	sort.Sort(stacks)
+	logger.Trace().Msg("Get topologically order DAG.")
+
+	order := d.Order()
+
+	orderedStacks := make(config.List[*config.SortableStack], 0, len(order))
+
+	logger.Trace().Msg("Get ordered stacks.")
+
+	isSelectedStack := func(s *config.Stack) bool {
+		// Stacks may be added on the DAG from after/before references
+		// but they should not be on the final order if they are not part
+		// of the previously selected stacks passed as a parameter.
+		// This is important for change detection to work on ordering and
+		// also for filtering by working dir.
+		for _, stack := range stacks {
+			if s.Dir == stack.Dir() {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, id := range order {
+		val, err := d.Node(id)
+		if err != nil {
+			return nil, "", fmt.Errorf("calculating run-order: %w", err)
+		}
+		s := val.(*config.Stack)
+		if !isSelectedStack(s) {
+			logger.Trace().
+				Stringer("stack", s.Dir).
+				Msg("ignoring since not part of selected stacks")
+			continue
+		}
+		orderedStacks = append(orderedStacks, s.Sortable())
+	}
+
+	return orderedStacks, "", nil
+}
+
+// Dependencies computes which stacks must finish before each of the given
+// stacks can start. The stacks must be in a valid execution order, as the
+// one returned by [Sort] (reversed or not), and the returned list has the
+// same length of stacks with the indexes of the dependencies of each stack.
+// Stacks that are ordered through other stacks not present on the list are
+// also considered dependent on each other. The given stacks are not modified.
+func Dependencies(root *config.Root, stacks config.List[*config.SortableStack]) ([][]int, error) {
+	logger := log.With().
+		Str("action", "run.Dependencies()").
+		Str("root", root.HostDir()).
+		Logger()
+
+	// The DAG is built on copies of the stacks, since building it adds the
+	// implicit hierarchical order to the stacks.
+	sorted := make(config.List[*config.SortableStack], len(stacks))
+	for i, elem := range stacks {
+		stackCopy := *elem.Stack
+		stackCopy.Before = append([]string(nil), elem.Stack.Before...)
+		sorted[i] = stackCopy.Sortable()
+	}
+	sort.Sort(sorted)
+
+	d, reason, err := buildOrderDAG(root, sorted)
+	if err != nil {
+		if errors.IsKind(err, dag.ErrCycleDetected) {
+			return nil, errors.E(err, "cycle detected: %s", reason)
+		}
+		return nil, err
+	}
+
+	logger.Trace().Msg("Computing transitive ancestors of stacks.")
+
+	ancestors := make([]map[dag.ID]struct{}, len(stacks))
+	for i, elem := range stacks {
+		ancestors[i] = map[dag.ID]struct{}{}
+		collectAncestors(d, dag.ID(elem.Dir().String()), ancestors[i])
+	}
+
+	deps := make([][]int, len(stacks))
+	for j := range stacks {
+		jid := dag.ID(stacks[j].Dir().String())
+		for i := 0; i < j; i++ {
+			iid := dag.ID(stacks[i].Dir().String())
+			_, iBeforeJ := ancestors[j][iid]
+			_, jBeforeI := ancestors[i][jid]
+			// The implicit hierarchical order is checked explicitly because
+			// stacks reached through the order of other stacks are added to
+			// the DAG without it.
+			hierarchical := isParentStack(stacks[j].Stack, stacks[i].Stack) ||
+				isParentStack(stacks[i].Stack, stacks[j].Stack)
+			if iBeforeJ || jBeforeI || hierarchical {
+				logger.Trace().
+					Stringer("stack", stacks[j].Dir()).
+					Stringer("dependency", stacks[i].Dir()).
+					Msg("stack depends on previous stack")
+
+				deps[j] = append(deps[j], i)
+			}
+		}
+	}
+	return deps, nil
+}
+
+// isParentStack tells if s2 is a parent stack of s1.
+func isParentStack(s1, s2 *config.Stack) bool {
+	return s1.Dir.HasPrefix(s2.Dir.String() + "/")
+}
+
+func collectAncestors(d *dag.DAG, id dag.ID, visited map[dag.ID]struct{}) {
+	for _, ancestor := range d.AncestorsOf(id) {
+		if _, ok := visited[ancestor]; ok {
+			continue
+		}
+		visited[ancestor] = struct{}{}
+		collectAncestors(d, ancestor, visited)
+	}
+}
+
+// buildOrderDAG builds the validated ordering DAG for the given stacks,
+// including the implicit hierarchical order between parent and child stacks.
+// The stacks must be lexicographically sorted by their dirs.
+func buildOrderDAG(root *config.Root, stacks config.List[*config.SortableStack]) (*dag.DAG, string, error) {
+	d := dag.New()
+
+	logger := log.With().
+		Str("action", "run.buildOrderDAG()").
+		Str("root", root.HostDir()).
+		Logger()
+
+	logger.Trace().Msg("Computes implicit hierarchical order.")
+
 	for _, stackElem := range stacks {
 		for _, otherElem := range stacks {
 			if stackElem.Dir() == otherElem.Dir() {
@@ -60,7 +189,7 @@ func Sort(root *config.Root, stacks config.List[*config.SortableStack]) (config.
 		}
 	}
 
-	logger.Trace().Msg("Sorting stacks.")
+	logger.Trace().Msg("Building DAG.")
 
 	visited := dag.Visited{}
 	for _, elem := range stacks {
@@ -94,45 +223,7 @@ func Sort(root *config.Root, stacks config.List[*config.SortableStack]) (config.
 	if err != nil {
 		return nil, reason, err
 	}
-
-	logger.Trace().Msg("Get topologically order DAG.")
-
-	order := d.Order()
-
-	orderedStacks := make(config.List[*config.SortableStack], 0, len(order))
-
-	logger.Trace().Msg("Get ordered stacks.")
-
-	isSelectedStack := func(s *config.Stack) bool {
-		// Stacks may be added on the DAG from after/before references
-		// but they should not be on the final order if they are not part
-		// of the previously selected stacks passed as a parameter.
-		// This is important for change detection to work on ordering and
-		// also for filtering by working dir.
-		for _, stack := range stacks {
-			if s.Dir == stack.Dir() {
-				return true
-			}
-		}
-		return false
-	}
-
-	for _, id := range order {
-		val, err := d.Node(id)
-		if err != nil {
-			return nil, "", fmt.Errorf("calculating run-order: %w", err)
-		}
-		s := val.(*config.Stack)
-		if !isSelectedStack(s) {
-			logger.Trace().
-				Stringer("stack", s.Dir).
-				Msg("ignoring since not part of selected stacks")
-			continue
-		}
-		orderedStacks = append(orderedStacks, s.Sortable())
-	}
-
-	return orderedStacks, "", nil
+	return d, "", nil
 }
 
 // BuildDAG builds a run order DAG for the given stack.
@@ -0,0 +1,59 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestDependenciesDoesNotChangeStacks(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:parent`,
+		`s:parent/child`,
+		`s:other:after=["/parent"]`,
+	})
+
+	root, err := config.LoadRoot(s.RootDir())
+	assert.NoError(t, err)
+
+	stacks, err := config.LoadAllStacks(root.Tree())
+	assert.NoError(t, err)
+
+	sorted, _, err := run.Sort(root, stacks)
+	assert.NoError(t, err)
+
+	want := map[string][]string{}
+	for _, elem := range sorted {
+		want[elem.Dir().String()] = append([]string(nil), elem.Stack.Before...)
+	}
+
+	for i := 0; i < 2; i++ {
+		deps, err := run.Dependencies(root, sorted)
+		assert.NoError(t, err)
+		test.AssertDiff(t, deps, [][]int{nil, {0}, {0, 1}})
+
+		for _, elem := range sorted {
+			test.AssertDiff(t, elem.Stack.Before, want[elem.Dir().String()],
+				"before of stack %s changed", elem.Dir())
+		}
+	}
+}
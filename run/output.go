@@ -0,0 +1,156 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/project"
+)
+
+// ErrLogDir indicates that an error happened while handling the stacks
+// log files.
+const ErrLogDir errors.Kind = "handling stack log files"
+
+// LogStatus is the execution status recorded next to each stack log file.
+type LogStatus struct {
+	// ExitCode is the exit code of the command. It is -1 if the command
+	// could not be started or was killed by a signal.
+	ExitCode int `json:"exit_code"`
+
+	// StartedAt is the time the command started.
+	StartedAt time.Time `json:"started_at"`
+
+	// FinishedAt is the time the command finished.
+	FinishedAt time.Time `json:"finished_at"`
+
+	// Duration is the duration of the command execution, in seconds.
+	Duration float64 `json:"duration_seconds"`
+
+	// Error is the error message in case the command failed.
+	Error string `json:"error,omitempty"`
+
+	// HookError is the error message in case a run hook failed.
+	HookError string `json:"hook_error,omitempty"`
+}
+
+// LogFilePath returns the path of the log file of the stack inside logdir.
+// The path of the log file mirrors the stack path inside the project, eg.:
+// the output of the stack /stacks/a is saved on <logdir>/stacks/a.log.
+func LogFilePath(logdir string, stackdir project.Path) string {
+	return logBasePath(logdir, stackdir) + ".log"
+}
+
+// LogStatusFilePath returns the path of the file containing the [LogStatus]
+// of the stack inside logdir, which is saved next to the stack log file.
+func LogStatusFilePath(logdir string, stackdir project.Path) string {
+	return logBasePath(logdir, stackdir) + ".status.json"
+}
+
+func logBasePath(logdir string, stackdir project.Path) string {
+	if stackdir.String() == "/" {
+		// WHY: a stack on the project root would have its log saved outside
+		// of the log dir.
+		return filepath.Join(logdir, "_root")
+	}
+	return filepath.Join(logdir, filepath.FromSlash(stackdir.String()))
+}
+
+func createLogFile(logdir string, stackdir project.Path) (*os.File, error) {
+	fname := LogFilePath(logdir, stackdir)
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return nil, errors.E(ErrLogDir, err)
+	}
+	f, err := os.Create(fname)
+	if err != nil {
+		return nil, errors.E(ErrLogDir, err)
+	}
+	return f, nil
+}
+
+func writeLogStatus(logdir string, stackdir project.Path, status LogStatus) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return errors.E(ErrLogDir, err)
+	}
+	data = append(data, '\n')
+	err = os.WriteFile(LogStatusFilePath(logdir, stackdir), data, 0644)
+	if err != nil {
+		return errors.E(ErrLogDir, err)
+	}
+	return nil
+}
+
+// syncWriter serializes the writes done by concurrent commands on the same
+// writer. The lock is shared by all writers of the same execution so writes
+// on stdout and stderr are also serialized.
+type syncWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// prefixWriter writes each line prefixed with the given prefix.
+// Incomplete lines are buffered until they are completed or the writer
+// is flushed, so lines from different commands are never mixed.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			return len(p), nil
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes any remaining incomplete line.
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := append(w.buf, '\n')
+	w.buf = nil
+	return w.writeLine(line)
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	data := make([]byte, 0, len(w.prefix)+len(line))
+	data = append(data, w.prefix...)
+	data = append(data, line...)
+	_, err := w.w.Write(data)
+	return err
+}
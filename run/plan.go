@@ -0,0 +1,149 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/project"
+)
+
+// Plan is the execution plan of a command on the selected stacks, as
+// computed by a dry run.
+type Plan struct {
+	// Stacks are the planned stacks, in the execution order.
+	Stacks []PlannedStack
+}
+
+// PlannedStack is the planned execution on a single stack.
+type PlannedStack struct {
+	// Stack is the stack where the commands will be executed.
+	Stack *config.Stack
+
+	// Reasons are the reasons why the stack was selected.
+	Reasons []string
+
+	// Dir is the host directory where the commands will be executed.
+	Dir string
+
+	// Cmds are the commands that will be executed, in order, including
+	// the before_each and after_each hooks.
+	Cmds [][]string
+
+	// Env are the environment variables set for the commands, besides the
+	// ones inherited from the Terramate process.
+	Env []EnvDefinition
+}
+
+// NewPlan creates the execution plan of the given commands on each of the
+// given stacks. The reasons map the path of the stacks to the reasons they
+// were selected.
+func NewPlan(
+	root *config.Root,
+	stacks config.List[*config.SortableStack],
+	stackCmds [][][]string,
+	reasons map[project.Path][]string,
+) (Plan, error) {
+	plan := Plan{
+		Stacks: make([]PlannedStack, len(stacks)),
+	}
+
+	errs := errors.L()
+	for i, elem := range stacks {
+		env, err := LoadEnvDefinitions(root, elem.Stack)
+		errs.Append(err)
+
+		hooks, err := LoadHooks(root, elem.Stack, newEnvVars(env))
+		errs.Append(err)
+
+		cmds := make([][]string, 0, len(hooks.BeforeEach)+len(stackCmds[i])+len(hooks.AfterEach))
+		cmds = append(cmds, hooks.BeforeEach...)
+		cmds = append(cmds, stackCmds[i]...)
+		cmds = append(cmds, hooks.AfterEach...)
+
+		plan.Stacks[i] = PlannedStack{
+			Stack:   elem.Stack,
+			Reasons: reasons[elem.Dir()],
+			Dir:     elem.HostDir(root),
+			Cmds:    cmds,
+			Env:     env,
+		}
+	}
+
+	if err := errs.AsError(); err != nil {
+		return Plan{}, err
+	}
+	return plan, nil
+}
+
+type (
+	jsonPlan struct {
+		Stacks []jsonPlannedStack `json:"stacks"`
+	}
+
+	jsonPlannedStack struct {
+		Order      int          `json:"order"`
+		ID         string       `json:"id,omitempty"`
+		Name       string       `json:"name"`
+		Path       string       `json:"path"`
+		Reasons    []string     `json:"reasons"`
+		WorkingDir string       `json:"working_dir"`
+		Commands   [][]string   `json:"commands"`
+		Env        []jsonEnvVar `json:"env"`
+	}
+
+	jsonEnvVar struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Origin string `json:"origin"`
+	}
+)
+
+// WriteJSON writes the plan as JSON on the given writer.
+func (p Plan) WriteJSON(w io.Writer) error {
+	plan := jsonPlan{
+		Stacks: make([]jsonPlannedStack, 0, len(p.Stacks)),
+	}
+	for i, planned := range p.Stacks {
+		stack := jsonPlannedStack{
+			Order:      i,
+			ID:         planned.Stack.ID,
+			Name:       planned.Stack.Name,
+			Path:       planned.Stack.Dir.String(),
+			Reasons:    planned.Reasons,
+			WorkingDir: planned.Dir,
+			Commands:   planned.Cmds,
+			Env:        make([]jsonEnvVar, 0, len(planned.Env)),
+		}
+		if stack.Reasons == nil {
+			stack.Reasons = []string{}
+		}
+		for _, def := range planned.Env {
+			stack.Env = append(stack.Env, jsonEnvVar{
+				Name:   def.Name,
+				Value:  def.Value,
+				Origin: def.Origin.Path().String(),
+			})
+		}
+		plan.Stacks = append(plan.Stacks, stack)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
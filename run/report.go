@@ -0,0 +1,280 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mineiros-io/terramate/config"
+)
+
+// Status is the final status of a command executed on a stack.
+type Status string
+
+// Possible status of a command executed on a stack.
+const (
+	// StatusSucceeded indicates the command finished successfully.
+	StatusSucceeded Status = "succeeded"
+
+	// StatusFailed indicates the command failed to start or exited with
+	// an error, or one of the run hooks of the stack failed.
+	StatusFailed Status = "failed"
+
+	// StatusSkipped indicates the command was not executed because a stack
+	// that must run before this stack has failed.
+	StatusSkipped Status = "skipped"
+
+	// StatusNotRun indicates the command was not executed because the
+	// execution was aborted, by a failure or an interruption.
+	StatusNotRun Status = "not-run"
+)
+
+// StackResult is the result of the execution of a command on a stack.
+type StackResult struct {
+	// Stack is the stack where the command was executed.
+	Stack *config.Stack
+
+	// Cmd is the executed command.
+	Cmd []string
+
+	// Status is the final status of the execution.
+	Status Status
+
+	// StartedAt is the time the command started.
+	// It is the zero time if the command was not executed.
+	StartedAt time.Time
+
+	// FinishedAt is the time the command finished.
+	// It is the zero time if the command was not executed.
+	FinishedAt time.Time
+
+	// ExitCode of the command. It is -1 if the command was not executed,
+	// could not be started or was killed by a signal.
+	ExitCode int
+
+	// Error is the error of a failed execution of the command.
+	Error error
+
+	// HookError is the error of the failed run hooks of the stack.
+	HookError error
+}
+
+// Report has the results of the execution of a command on all the
+// selected stacks.
+type Report struct {
+	// Cmd is the executed command.
+	Cmd []string
+
+	// StartedAt is the time the execution started.
+	StartedAt time.Time
+
+	// FinishedAt is the time the execution finished.
+	FinishedAt time.Time
+
+	// Results are the results of each stack, in the execution order.
+	Results []StackResult
+}
+
+// Duration returns the duration of the command execution.
+func (res StackResult) Duration() time.Duration {
+	return res.FinishedAt.Sub(res.StartedAt)
+}
+
+// HasFailures returns true if the command failed on any stack.
+func (r Report) HasFailures() bool {
+	for _, res := range r.Results {
+		if res.Status == StatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+type (
+	jsonReport struct {
+		Command    []string          `json:"command"`
+		StartedAt  time.Time         `json:"started_at"`
+		FinishedAt time.Time         `json:"finished_at"`
+		Stacks     []jsonStackResult `json:"stacks"`
+	}
+
+	jsonStackResult struct {
+		ID         string     `json:"id,omitempty"`
+		Name       string     `json:"name"`
+		Path       string     `json:"path"`
+		Command    []string   `json:"command"`
+		Status     Status     `json:"status"`
+		Skipped    bool       `json:"skipped"`
+		StartedAt  *time.Time `json:"started_at,omitempty"`
+		FinishedAt *time.Time `json:"finished_at,omitempty"`
+		ExitCode   int        `json:"exit_code"`
+		Error      string     `json:"error,omitempty"`
+		HookError  string     `json:"hook_error,omitempty"`
+	}
+)
+
+// WriteJSON writes the report as JSON on the given writer.
+func (r Report) WriteJSON(w io.Writer) error {
+	report := jsonReport{
+		Command:    r.Cmd,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+		Stacks:     make([]jsonStackResult, 0, len(r.Results)),
+	}
+	for _, res := range r.Results {
+		stackRes := jsonStackResult{
+			ID:       res.Stack.ID,
+			Name:     res.Stack.Name,
+			Path:     res.Stack.Dir.String(),
+			Command:  res.Cmd,
+			Status:   res.Status,
+			Skipped:  res.Status == StatusSkipped,
+			ExitCode: res.ExitCode,
+		}
+		if !res.StartedAt.IsZero() {
+			startedAt, finishedAt := res.StartedAt, res.FinishedAt
+			stackRes.StartedAt = &startedAt
+			stackRes.FinishedAt = &finishedAt
+		}
+		if res.Error != nil {
+			stackRes.Error = res.Error.Error()
+		}
+		if res.HookError != nil {
+			stackRes.HookError = res.HookError.Error()
+		}
+		report.Stacks = append(report.Stacks, stackRes)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+type (
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Skipped  int              `xml:"skipped,attr"`
+		Time     string           `xml:"time,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		Skipped   int             `xml:"skipped,attr"`
+		Time      string          `xml:"time,attr"`
+		Timestamp string          `xml:"timestamp,attr,omitempty"`
+		Cases     []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitMessage `xml:"failure,omitempty"`
+		Skipped   *junitMessage `xml:"skipped,omitempty"`
+	}
+
+	junitMessage struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// WriteJUnit writes the report as JUnit XML on the given writer.
+// Each stack is represented as a test case named after the stack path.
+func (r Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:  "terramate run " + strings.Join(r.Cmd, " "),
+		Tests: len(r.Results),
+		Time:  junitDuration(r.FinishedAt.Sub(r.StartedAt)),
+	}
+	if !r.StartedAt.IsZero() {
+		suite.Timestamp = r.StartedAt.Format("2006-01-02T15:04:05")
+	}
+
+	for _, res := range r.Results {
+		testcase := junitTestCase{
+			Name:      res.Stack.Dir.String(),
+			Classname: res.Stack.Name,
+			Time:      junitDuration(res.Duration()),
+		}
+		switch res.Status {
+		case StatusFailed:
+			suite.Failures++
+			msg := fmt.Sprintf("exit code %d", res.ExitCode)
+			if res.Error == nil && res.HookError != nil {
+				msg = "run hook failed"
+			}
+			texts := []string{}
+			for _, err := range []error{res.Error, res.HookError} {
+				if err != nil {
+					texts = append(texts, err.Error())
+				}
+			}
+			testcase.Failure = &junitMessage{
+				Message: msg,
+				Text:    strings.Join(texts, "\n"),
+			}
+		case StatusSkipped:
+			suite.Skipped++
+			testcase.Skipped = &junitMessage{
+				Message: "a stack that must run before this stack has failed",
+			}
+		case StatusNotRun:
+			suite.Skipped++
+			testcase.Skipped = &junitMessage{
+				Message: "execution aborted before running this stack",
+			}
+		}
+		suite.Cases = append(suite.Cases, testcase)
+	}
+
+	suites := junitTestSuites{
+		Name:     "terramate",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/test"
+)
+
+func TestRunReportWriters(t *testing.T) {
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	cmd := []string{"terraform", "apply"}
+
+	report := run.Report{
+		Cmd:        cmd,
+		StartedAt:  start,
+		FinishedAt: start.Add(3 * time.Second),
+		Results: []run.StackResult{
+			{
+				Stack: &config.Stack{
+					ID:   "stack-a-id",
+					Name: "stack-a",
+					Dir:  project.NewPath("/stacks/a"),
+				},
+				Cmd:        cmd,
+				Status:     run.StatusSucceeded,
+				StartedAt:  start,
+				FinishedAt: start.Add(time.Second),
+				ExitCode:   0,
+			},
+			{
+				Stack: &config.Stack{
+					Name: "stack-b",
+					Dir:  project.NewPath("/stacks/b"),
+				},
+				Cmd:        cmd,
+				Status:     run.StatusFailed,
+				StartedAt:  start.Add(time.Second),
+				FinishedAt: start.Add(2500 * time.Millisecond),
+				ExitCode:   1,
+				Error:      errors.E("exit status 1"),
+			},
+			{
+				Stack: &config.Stack{
+					Name: "stack-c",
+					Dir:  project.NewPath("/stacks/c"),
+				},
+				Cmd:      cmd,
+				Status:   run.StatusSkipped,
+				ExitCode: -1,
+			},
+			{
+				Stack: &config.Stack{
+					Name: "stack-d",
+					Dir:  project.NewPath("/stacks/d"),
+				},
+				Cmd:        cmd,
+				Status:     run.StatusFailed,
+				StartedAt:  start.Add(2500 * time.Millisecond),
+				FinishedAt: start.Add(3 * time.Second),
+				ExitCode:   0,
+				HookError:  errors.E("running after_each hook"),
+			},
+		},
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, report.WriteJSON(&buf))
+
+		want := `{
+  "command": [
+    "terraform",
+    "apply"
+  ],
+  "started_at": "2023-01-02T03:04:05Z",
+  "finished_at": "2023-01-02T03:04:08Z",
+  "stacks": [
+    {
+      "id": "stack-a-id",
+      "name": "stack-a",
+      "path": "/stacks/a",
+      "command": [
+        "terraform",
+        "apply"
+      ],
+      "status": "succeeded",
+      "skipped": false,
+      "started_at": "2023-01-02T03:04:05Z",
+      "finished_at": "2023-01-02T03:04:06Z",
+      "exit_code": 0
+    },
+    {
+      "name": "stack-b",
+      "path": "/stacks/b",
+      "command": [
+        "terraform",
+        "apply"
+      ],
+      "status": "failed",
+      "skipped": false,
+      "started_at": "2023-01-02T03:04:06Z",
+      "finished_at": "2023-01-02T03:04:07.5Z",
+      "exit_code": 1,
+      "error": "exit status 1"
+    },
+    {
+      "name": "stack-c",
+      "path": "/stacks/c",
+      "command": [
+        "terraform",
+        "apply"
+      ],
+      "status": "skipped",
+      "skipped": true,
+      "exit_code": -1
+    },
+    {
+      "name": "stack-d",
+      "path": "/stacks/d",
+      "command": [
+        "terraform",
+        "apply"
+      ],
+      "status": "failed",
+      "skipped": false,
+      "started_at": "2023-01-02T03:04:07.5Z",
+      "finished_at": "2023-01-02T03:04:08Z",
+      "exit_code": 0,
+      "hook_error": "running after_each hook"
+    }
+  ]
+}
+`
+		test.AssertDiff(t, buf.String(), want)
+	})
+
+	t.Run("JUnit", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, report.WriteJUnit(&buf))
+
+		want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="terramate" tests="4" failures="2" skipped="1" time="3.000">
+  <testsuite name="terramate run terraform apply" tests="4" failures="2" skipped="1" time="3.000" timestamp="2023-01-02T03:04:05">
+    <testcase name="/stacks/a" classname="stack-a" time="1.000"></testcase>
+    <testcase name="/stacks/b" classname="stack-b" time="1.500">
+      <failure message="exit code 1">exit status 1</failure>
+    </testcase>
+    <testcase name="/stacks/c" classname="stack-c" time="0.000">
+      <skipped message="a stack that must run before this stack has failed"></skipped>
+    </testcase>
+    <testcase name="/stacks/d" classname="stack-d" time="0.500">
+      <failure message="run hook failed">running after_each hook</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+		test.AssertDiff(t, buf.String(), want)
+	})
+}
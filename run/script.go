@@ -0,0 +1,158 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"os"
+	"sort"
+
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/globals"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Errors returned when handling scripts.
+const (
+	// ErrScriptNotFound indicates the script is not available on the stack.
+	ErrScriptNotFound errors.Kind = "script not found"
+
+	// ErrScriptEval indicates an error evaluating the commands of a script.
+	ErrScriptEval errors.Kind = "evaluating script commands"
+
+	// ErrInvalidScriptCmds indicates the commands of a script job don't
+	// evaluate to a list of commands.
+	ErrInvalidScriptCmds errors.Kind = "invalid script commands"
+)
+
+// Scripts returns all the scripts available on the given directory, sorted
+// by name. Scripts are inherited from parent directories and a script
+// defined on a directory overrides any script with the same name defined on
+// its parent directories.
+func Scripts(root *config.Root, dir project.Path) []*hcl.Script {
+	scripts := map[string]*hcl.Script{}
+	for {
+		if tree, ok := root.Lookup(dir); ok {
+			for _, script := range tree.Node.Scripts {
+				if _, ok := scripts[script.Name]; !ok {
+					scripts[script.Name] = script
+				}
+			}
+		}
+		parent := dir.Dir()
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	res := make([]*hcl.Script, 0, len(scripts))
+	for _, script := range scripts {
+		res = append(res, script)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// LookupScript returns the script with the given name available on the given
+// directory, following the same inheritance rules of [Scripts].
+func LookupScript(root *config.Root, dir project.Path, name string) (*hcl.Script, bool) {
+	for _, script := range Scripts(root, dir) {
+		if script.Name == name {
+			return script, true
+		}
+	}
+	return nil, false
+}
+
+// LoadScriptCmds evaluates the commands of the script with the given name for
+// the given stack. The commands of all jobs are returned in the order they
+// must be executed. The commands are evaluated with the stack metadata,
+// its globals and the environment variables of the stack.
+func LoadScriptCmds(root *config.Root, st *config.Stack, name string) ([][]string, error) {
+	logger := log.With().
+		Str("action", "run.LoadScriptCmds()").
+		Str("script", name).
+		Stringer("stack", st).
+		Logger()
+
+	script, ok := LookupScript(root, st.Dir, name)
+	if !ok {
+		return nil, errors.E(ErrScriptNotFound, "script %q not found on stack %s", name, st.Dir)
+	}
+
+	logger.Trace().Msg("loading globals")
+
+	globalsReport := globals.ForStack(root, st)
+	if err := globalsReport.AsError(); err != nil {
+		return nil, errors.E(ErrScriptEval, err)
+	}
+
+	env, err := LoadEnv(root, st)
+	if err != nil {
+		return nil, errors.E(ErrScriptEval, err)
+	}
+
+	evalctx := stack.NewEvalCtx(root, st, globalsReport.Globals)
+	evalctx.SetEnv(append(os.Environ(), env...))
+
+	var cmds [][]string
+	for _, job := range script.Jobs {
+		logger.Trace().
+			Stringer("job", job.Range).
+			Msg("evaluating job commands")
+
+		val, err := evalctx.Eval(job.Commands.Expr)
+		if err != nil {
+			return nil, errors.E(ErrScriptEval, err)
+		}
+
+		jobCmds, err := valueAsCmds(val)
+		if err != nil {
+			return nil, errors.E(ErrInvalidScriptCmds, job.Commands.Range, err)
+		}
+		cmds = append(cmds, jobCmds...)
+	}
+	return cmds, nil
+}
+
+func valueAsCmds(val cty.Value) ([][]string, error) {
+	if !val.Type().IsTupleType() && !val.Type().IsListType() {
+		return nil, errors.E("commands must be a list of commands, got %q",
+			val.Type().FriendlyName())
+	}
+
+	var cmds [][]string
+	iterator := val.ElementIterator()
+	for iterator.Next() {
+		_, elem := iterator.Element()
+
+		cmd, err := hcl.ValueAsStringList(elem)
+		if err != nil {
+			return nil, errors.E(err, "each command must be a list of strings")
+		}
+		if len(cmd) == 0 {
+			return nil, errors.E("commands must not be empty")
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"path"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/test"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestLoadScriptCmds(t *testing.T) {
+	type (
+		result struct {
+			cmds [][]string
+			err  error
+		}
+		testcase struct {
+			name    string
+			hostenv map[string]string
+			layout  []string
+			script  string
+			want    map[string]result
+		}
+	)
+
+	tcases := []testcase{
+		{
+			name: "script not found",
+			layout: []string{
+				"s:stack",
+			},
+			script: "deploy",
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrScriptNotFound)},
+			},
+		},
+		{
+			name: "commands of all jobs evaluated in order",
+			hostenv: map[string]string{
+				"TESTING_SCRIPT_ENV": "from-env",
+			},
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				`f:script.tm:
+				globals {
+				  planfile = "plan.out"
+				}
+				script "deploy" {
+				  job {
+				    commands = [
+				      ["terraform", "init"],
+				      ["terraform", "plan", "-out", global.planfile],
+				    ]
+				  }
+				  job {
+				    commands = [["echo", terramate.stack.name, env.TESTING_SCRIPT_ENV]]
+				  }
+				}`,
+			},
+			script: "deploy",
+			want: map[string]result{
+				"stacks/stack-1": {
+					cmds: [][]string{
+						{"terraform", "init"},
+						{"terraform", "plan", "-out", "plan.out"},
+						{"echo", "stack-1", "from-env"},
+					},
+				},
+				"stacks/stack-2": {
+					cmds: [][]string{
+						{"terraform", "init"},
+						{"terraform", "plan", "-out", "plan.out"},
+						{"echo", "stack-2", "from-env"},
+					},
+				},
+			},
+		},
+		{
+			name: "closest script definition overrides parent definitions",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				`f:script.tm:
+				script "deploy" {
+				  job {
+				    commands = [["parent"]]
+				  }
+				}`,
+				`f:stacks/stack-2/script.tm:
+				script "deploy" {
+				  job {
+				    commands = [["child"]]
+				  }
+				}`,
+			},
+			script: "deploy",
+			want: map[string]result{
+				"stacks/stack-1": {cmds: [][]string{{"parent"}}},
+				"stacks/stack-2": {cmds: [][]string{{"child"}}},
+			},
+		},
+		{
+			name: "commands is not a list of commands",
+			layout: []string{
+				"s:stack",
+				`f:stack/script.tm:
+				script "deploy" {
+				  job {
+				    commands = ["terraform", "init"]
+				  }
+				}`,
+			},
+			script: "deploy",
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrInvalidScriptCmds)},
+			},
+		},
+		{
+			name: "empty command",
+			layout: []string{
+				"s:stack",
+				`f:stack/script.tm:
+				script "deploy" {
+				  job {
+				    commands = [[]]
+				  }
+				}`,
+			},
+			script: "deploy",
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrInvalidScriptCmds)},
+			},
+		},
+		{
+			name: "undefined global",
+			layout: []string{
+				"s:stack",
+				`f:stack/script.tm:
+				script "deploy" {
+				  job {
+				    commands = [["echo", global.undefined]]
+				  }
+				}`,
+			},
+			script: "deploy",
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrScriptEval)},
+			},
+		},
+	}
+
+	for _, tcase := range tcases {
+		t.Run(tcase.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree(tcase.layout)
+
+			for name, value := range tcase.hostenv {
+				t.Setenv(name, value)
+			}
+
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+
+			for stackRelPath, wantres := range tcase.want {
+				stack, err := config.LoadStack(root, project.NewPath(path.Join("/", stackRelPath)))
+				assert.NoError(t, err)
+
+				gotcmds, err := run.LoadScriptCmds(root, stack, tcase.script)
+				errorstest.Assert(t, err, wantres.err)
+				test.AssertDiff(t, gotcmds, wantres.cmds)
+			}
+		})
+	}
+}
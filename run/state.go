@@ -0,0 +1,189 @@
+// Copyright 2023 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mineiros-io/terramate/config"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/rs/zerolog/log"
+)
+
+// Errors returned when handling the run state.
+const (
+	// ErrState indicates an error loading or saving the run state file.
+	ErrState errors.Kind = "handling run state file"
+
+	// ErrStateOrderChanged indicates the execution order of the stacks
+	// changed since the run state was saved, so it can't be resumed.
+	ErrStateOrderChanged errors.Kind = "order of execution changed since the run state was saved"
+)
+
+// State is the persisted state of a run, used to resume runs that did not
+// succeed on all stacks.
+type State struct {
+	// Cmd is the command executed on the stacks.
+	Cmd []string `json:"command"`
+
+	// Reverse tells if the run was executed in reverse order.
+	Reverse bool `json:"reverse"`
+
+	// Stacks are the selected stacks, in the computed order of execution.
+	Stacks []StackState `json:"stacks"`
+
+	filename string
+}
+
+// StackState is the persisted state of the execution on a single stack.
+type StackState struct {
+	// Path of the stack.
+	Path string `json:"path"`
+
+	// Status of the last execution of the command on the stack.
+	Status Status `json:"status"`
+}
+
+// NewState creates a new run state to be saved on the given file. The stacks
+// must be in the same order they will be executed, as returned by [Sort].
+func NewState(filename string, cmd []string, reverse bool, stacks config.List[*config.SortableStack]) *State {
+	state := &State{
+		Cmd:      cmd,
+		Reverse:  reverse,
+		Stacks:   make([]StackState, len(stacks)),
+		filename: filename,
+	}
+	for i, elem := range stacks {
+		state.Stacks[i] = StackState{
+			Path:   elem.Dir().String(),
+			Status: StatusNotRun,
+		}
+	}
+	return state
+}
+
+// LoadState loads the run state saved on the given file.
+func LoadState(filename string) (*State, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.E(ErrState, err)
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.E(ErrState, err, "parsing %s", filename)
+	}
+	state.filename = filename
+	return state, nil
+}
+
+// Save saves the state on its file, creating its directory if needed.
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.E(ErrState, err)
+	}
+	data = append(data, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0755); err != nil {
+		return errors.E(ErrState, err)
+	}
+
+	// WHY: write to a temporary file and rename it so an interrupted
+	// Terramate never leaves a corrupted state file behind.
+	tmpfile := s.filename + ".tmp"
+	if err := os.WriteFile(tmpfile, data, 0644); err != nil {
+		return errors.E(ErrState, err)
+	}
+	if err := os.Rename(tmpfile, s.filename); err != nil {
+		return errors.E(ErrState, err)
+	}
+	return nil
+}
+
+// SetStatus sets the status of the stack on the given path.
+func (s *State) SetStatus(path project.Path, status Status) {
+	for i := range s.Stacks {
+		if s.Stacks[i].Path == path.String() {
+			s.Stacks[i].Status = status
+			return
+		}
+	}
+}
+
+// ResumeStacks loads the stacks that must be executed to resume the run,
+// which are all stacks that did not succeed, in the saved order.
+// It fails if any of the saved stacks doesn't exist anymore or if the
+// order of execution of the saved stacks changed.
+func (s *State) ResumeStacks(root *config.Root) (config.List[*config.SortableStack], error) {
+	logger := log.With().
+		Str("action", "run.State.ResumeStacks()").
+		Str("state", s.filename).
+		Logger()
+
+	logger.Trace().Msg("loading saved stacks")
+
+	stacks := make(config.List[*config.SortableStack], 0, len(s.Stacks))
+	for _, elem := range s.Stacks {
+		st, err := config.LoadStack(root, project.NewPath(elem.Path))
+		if err != nil {
+			return nil, errors.E(ErrState, err, "loading saved stack %s", elem.Path)
+		}
+		stacks = append(stacks, st.Sortable())
+	}
+
+	logger.Trace().Msg("checking saved order is still valid")
+
+	ordered, reason, err := Sort(root, stacks)
+	if err != nil {
+		return nil, errors.E(ErrStateOrderChanged, err, "computing current order: %s", reason)
+	}
+	if s.Reverse {
+		config.ReverseStacks(ordered)
+	}
+
+	savedOrder := make([]string, len(s.Stacks))
+	for i, elem := range s.Stacks {
+		savedOrder[i] = elem.Path
+	}
+	currentOrder := make([]string, len(ordered))
+	for i, elem := range ordered {
+		currentOrder[i] = elem.Dir().String()
+	}
+
+	if strings.Join(savedOrder, ",") != strings.Join(currentOrder, ",") {
+		return nil, errors.E(ErrStateOrderChanged,
+			"saved order [%s] but current order is [%s]",
+			strings.Join(savedOrder, ", "),
+			strings.Join(currentOrder, ", "),
+		)
+	}
+
+	resumed := config.List[*config.SortableStack]{}
+	for i, elem := range ordered {
+		if s.Stacks[i].Status == StatusSucceeded {
+			logger.Debug().
+				Stringer("stack", elem.Dir()).
+				Msg("skipping stack that already succeeded")
+			continue
+		}
+		resumed = append(resumed, elem)
+	}
+	return resumed, nil
+}
@@ -17,6 +17,7 @@ package trigger
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
@@ -54,11 +55,32 @@ type Info struct {
 	Type string
 	// Context is the context of the trigger (only `stack` at the moment)
 	Context string
+	// Expires is unix timestamp of when the trigger expires, or zero if it
+	// never expires.
+	Expires int64
+}
+
+// File is a trigger file of the project.
+type File struct {
+	// Path is the project path of the trigger file.
+	Path project.Path
+	// Stack is the project path of the triggered stack.
+	Stack project.Path
+	// Info is the parsed contents of the trigger file.
+	Info Info
 }
 
 const (
 	// DefaultType is the default trigger type when not specified.
-	DefaultType = "changed"
+	DefaultType = ChangedType
+
+	// ChangedType is the type of the triggers which mark the stack as
+	// changed.
+	ChangedType = "changed"
+
+	// IgnoreChangeType is the type of the triggers which mark the stack as
+	// not changed, even if the stack changed in the same commit range.
+	IgnoreChangeType = "ignore-change"
 
 	// DefaultContext is the default context for the trigger file when not
 	// specified.
@@ -123,6 +145,10 @@ func ParseFile(path string) (Info, error) {
 				Name:     "context",
 				Required: false,
 			},
+			{
+				Name:     "expires",
+				Required: false,
+			},
 		},
 	})
 
@@ -140,7 +166,7 @@ func ParseFile(path string) (Info, error) {
 			switch attribute.Name {
 			case "context":
 				if keyword != DefaultContext {
-					errs.Append(errors.E(
+					errs.Append(errors.E(ErrParsing,
 						"trigger: invalid trigger.context = %s (available options: %s)",
 						keyword, DefaultContext,
 					))
@@ -148,10 +174,10 @@ func ParseFile(path string) (Info, error) {
 				}
 				info.Context = keyword
 			case "type":
-				if keyword != DefaultType {
-					errs.Append(errors.E(
-						"trigger: invalid trigger.type = %s (available options: %s)",
-						keyword, DefaultType,
+				if keyword != ChangedType && keyword != IgnoreChangeType {
+					errs.Append(errors.E(ErrParsing,
+						"trigger: invalid trigger.type = %s (available options: %s, %s)",
+						keyword, ChangedType, IgnoreChangeType,
 					))
 					continue
 				}
@@ -181,6 +207,13 @@ func ParseFile(path string) (Info, error) {
 				continue
 			}
 			info.Reason = val.AsString()
+		case "expires":
+			if val.Type() != cty.Number {
+				errs.Append(errors.E(ErrParsing, "trigger: %s must be a number", attribute.Name))
+				continue
+			}
+			v, _ := val.AsBigFloat().Int64()
+			info.Expires = v
 		default:
 			errs.Append(errors.E(ErrParsing, "trigger: has unknown attribute %q", attribute.Name))
 		}
@@ -202,34 +235,53 @@ func ParseFile(path string) (Info, error) {
 	return info, nil
 }
 
+// IsExpired tells if the trigger is expired at the given time.
+func (info Info) IsExpired(now time.Time) bool {
+	return info.Expires != 0 && now.Unix() >= info.Expires
+}
+
 // Dir will return the triggers directory for the project rooted at rootdir.
 // Both rootdir and the returned value are host absolute paths.
 func Dir(rootdir string) string {
 	return filepath.Join(rootdir, triggersDir)
 }
 
-func triggerFilename() (string, error) {
+func triggerFilename(triggerType string) (string, error) {
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return "", errors.E(err, "creating trigger UUID")
 	}
-	return fmt.Sprintf("changed-%s.tm.hcl", id.String()), nil
+	return fmt.Sprintf("%s-%s.tm.hcl", triggerType, id.String()), nil
 }
 
 // Create creates a trigger for a stack with the given path and the given reason
 // inside the project rootdir.
 func Create(root *config.Root, path project.Path, reason string) error {
+	_, err := CreateWithInfo(root, path, Info{Reason: reason})
+	return err
+}
+
+// CreateWithInfo creates a trigger for a stack with the given path using the
+// reason, the type and the expiration of the given info. An empty type means
+// the DefaultType. It returns the project path of the created trigger file.
+func CreateWithInfo(root *config.Root, path project.Path, info Info) (project.Path, error) {
 	tree, ok := root.Lookup(path)
 	if !ok || !tree.IsStack() {
-		return errors.E(ErrTrigger, "path %s is not a stack directory", path)
+		return project.Path{}, errors.E(ErrTrigger, "path %s is not a stack directory", path)
 	}
-	filename, err := triggerFilename()
+	if info.Type == "" {
+		info.Type = DefaultType
+	}
+	if info.Type != ChangedType && info.Type != IgnoreChangeType {
+		return project.Path{}, errors.E(ErrTrigger, "invalid trigger type %q", info.Type)
+	}
+	filename, err := triggerFilename(info.Type)
 	if err != nil {
-		return errors.E(ErrTrigger, err)
+		return project.Path{}, errors.E(ErrTrigger, err)
 	}
 	triggerDir := filepath.Join(root.HostDir(), triggersDir, path.String())
 	if err := os.MkdirAll(triggerDir, 0775); err != nil {
-		return errors.E(ErrTrigger, err, "creating trigger dir")
+		return project.Path{}, errors.E(ErrTrigger, err, "creating trigger dir")
 	}
 
 	ctime := time.Now().Unix()
@@ -237,21 +289,89 @@ func Create(root *config.Root, path project.Path, reason string) error {
 	gen := hclwrite.NewEmptyFile()
 	triggerBody := gen.Body().AppendNewBlock("trigger", nil).Body()
 	triggerBody.SetAttributeValue("ctime", cty.NumberIntVal(ctime))
-	triggerBody.SetAttributeValue("reason", cty.StringVal(reason))
-	triggerBody.SetAttributeRaw("type", hclwrite.TokensForIdentifier(DefaultType))
+	triggerBody.SetAttributeValue("reason", cty.StringVal(info.Reason))
+	triggerBody.SetAttributeRaw("type", hclwrite.TokensForIdentifier(info.Type))
 	triggerBody.SetAttributeRaw("context", hclwrite.TokensForIdentifier(DefaultContext))
+	if info.Expires != 0 {
+		triggerBody.SetAttributeValue("expires", cty.NumberIntVal(info.Expires))
+	}
 
 	triggerPath := filepath.Join(triggerDir, filename)
 
 	if err := os.WriteFile(triggerPath, gen.Bytes(), 0666); err != nil {
-		return errors.E(ErrTrigger, err, "creating trigger file")
+		return project.Path{}, errors.E(ErrTrigger, err, "creating trigger file")
 	}
 
 	log.Debug().
 		Str("action", "trigger.Create").
 		Int64("ctime", ctime).
-		Str("reason", reason).
+		Str("type", info.Type).
+		Int64("expires", info.Expires).
+		Str("reason", info.Reason).
 		Msg("trigger file created")
 
+	return project.PrjAbsPath(root.HostDir(), triggerPath), nil
+}
+
+// List lists all trigger files of the project rooted at rootdir, sorted by
+// their path.
+func List(rootdir string) ([]File, error) {
+	var files []File
+	errs := errors.L()
+	err := filepath.WalkDir(Dir(rootdir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		prjpath := project.PrjAbsPath(rootdir, path)
+		stack, _ := StackPath(prjpath)
+		info, err := ParseFile(path)
+		if err != nil {
+			errs.Append(errors.E(err, "parsing trigger file %s", prjpath))
+			return nil
+		}
+		files = append(files, File{
+			Path:  prjpath,
+			Stack: stack,
+			Info:  info,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.E(err, "listing trigger files")
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Remove removes the given trigger file of the project rooted at rootdir,
+// together with the trigger directories left empty.
+func Remove(rootdir string, file File) error {
+	hostpath := file.Path.HostPath(rootdir)
+	if err := os.Remove(hostpath); err != nil {
+		return errors.E(err, "removing trigger file %s", file.Path)
+	}
+
+	triggersRoot := Dir(rootdir)
+	for dir := filepath.Dir(hostpath); strings.HasPrefix(dir, triggersRoot+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return errors.E(err, "reading trigger dir")
+		}
+		if len(entries) > 0 {
+			return nil
+		}
+		if err := os.Remove(dir); err != nil {
+			return errors.E(err, "removing empty trigger dir")
+		}
+	}
 	return nil
 }
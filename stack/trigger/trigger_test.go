@@ -19,6 +19,7 @@ import (
 	"math"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate/config"
@@ -154,6 +155,46 @@ func TestTriggerParser(t *testing.T) {
 				Expr("context", "stack"),
 			),
 		},
+		{
+			name: "valid file with expiration",
+			body: Trigger(
+				Number("ctime", 1000000),
+				Str("reason", "something"),
+				Expr("type", "changed"),
+				Expr("context", "stack"),
+				Number("expires", 2000000),
+			),
+		},
+		{
+			name: "valid ignore-change type",
+			body: Trigger(
+				Number("ctime", 1000000),
+				Str("reason", "something"),
+				Expr("type", "ignore-change"),
+				Expr("context", "stack"),
+			),
+		},
+		{
+			name: "unknown type",
+			body: Trigger(
+				Number("ctime", 1000000),
+				Str("reason", "something"),
+				Expr("type", "unknown"),
+				Expr("context", "stack"),
+			),
+			err: errors.E(trigger.ErrParsing),
+		},
+		{
+			name: "expires not number",
+			body: Trigger(
+				Number("ctime", 1000000),
+				Str("reason", "something"),
+				Expr("type", "changed"),
+				Expr("context", "stack"),
+				Str("expires", "2000000"),
+			),
+			err: errors.E(trigger.ErrParsing),
+		},
 		{
 			name: "valid file (backward compatibility)",
 			body: Trigger(
@@ -262,3 +303,85 @@ func TestTriggerParser(t *testing.T) {
 func init() {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 }
+
+func TestTriggerListAndRemove(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+		"s:dir/stack",
+	})
+	root, err := config.LoadRoot(s.RootDir())
+	assert.NoError(t, err)
+
+	files, err := trigger.List(root.HostDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 0, len(files), "no triggers expected")
+
+	expires := time.Now().Add(time.Hour).Unix()
+	nested, err := trigger.CreateWithInfo(root, project.NewPath("/dir/stack"), trigger.Info{
+		Reason:  "nested",
+		Expires: expires,
+	})
+	assert.NoError(t, err)
+	_, err = trigger.CreateWithInfo(root, project.NewPath("/stack"), trigger.Info{
+		Reason: "stack",
+	})
+	assert.NoError(t, err)
+
+	files, err = trigger.List(root.HostDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 2, len(files), "unexpected triggers: %+v", files)
+
+	got := files[0]
+	assert.EqualStrings(t, nested.String(), got.Path.String())
+	assert.EqualStrings(t, "/dir/stack", got.Stack.String())
+	assert.EqualStrings(t, "nested", got.Info.Reason)
+	assert.EqualInts(t, int(expires), int(got.Info.Expires))
+	assert.IsTrue(t, !got.Info.IsExpired(time.Now()))
+	assert.IsTrue(t, got.Info.IsExpired(time.Now().Add(2*time.Hour)))
+
+	assert.EqualStrings(t, "/stack", files[1].Stack.String())
+	assert.IsTrue(t, !files[1].Info.IsExpired(time.Now().Add(time.Hour*24*365)))
+
+	assert.NoError(t, trigger.Remove(root.HostDir(), got))
+
+	files, err = trigger.List(root.HostDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 1, len(files), "unexpected triggers: %+v", files)
+	assert.EqualStrings(t, "/stack", files[0].Stack.String())
+
+	// empty trigger directories are removed too.
+	entries := test.ReadDir(t, trigger.Dir(root.HostDir()))
+	assert.EqualInts(t, 1, len(entries), "unexpected entries: %+v", entries)
+	assert.EqualStrings(t, "stack", entries[0].Name())
+}
+
+func TestTriggerCreateWithType(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack",
+	})
+	root, err := config.LoadRoot(s.RootDir())
+	assert.NoError(t, err)
+
+	_, err = trigger.CreateWithInfo(root, project.NewPath("/stack"), trigger.Info{
+		Reason: "invalid",
+		Type:   "unknown",
+	})
+	errtest.Assert(t, err, errors.E(trigger.ErrTrigger))
+
+	file, err := trigger.CreateWithInfo(root, project.NewPath("/stack"), trigger.Info{
+		Reason: "formatting",
+		Type:   trigger.IgnoreChangeType,
+	})
+	assert.NoError(t, err)
+
+	info, err := trigger.ParseFile(file.HostPath(root.HostDir()))
+	assert.NoError(t, err)
+	assert.EqualStrings(t, trigger.IgnoreChangeType, info.Type)
+	assert.EqualStrings(t, "formatting", info.Reason)
+}
@@ -78,6 +78,7 @@ func AssertTerramateConfig(t *testing.T, got, want hcl.Config) {
 	AssertDiff(t, got.Vendor, want.Vendor, "terramate vendor")
 	assertGenHCLBlocks(t, got.Generate.HCLs, want.Generate.HCLs)
 	assertGenFileBlocks(t, got.Generate.Files, want.Generate.Files)
+	assertScriptBlocks(t, got.Scripts, want.Scripts)
 }
 
 // AssertDiff will compare the two values and fail if they are not the same
@@ -192,6 +193,37 @@ func assertAssertsBlock(t *testing.T, got, want []hcl.AssertConfig, ctx string)
 	}
 }
 
+func assertScriptBlocks(t *testing.T, got, want []*hcl.Script) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d script blocks, want %d", len(got), len(want))
+	}
+
+	for i, g := range got {
+		w := want[i]
+		ctx := fmt.Sprintf("script %d", i)
+		AssertEqualRanges(t, g.Range, w.Range, "%s: range mismatch", ctx)
+		assert.EqualStrings(t, w.Name, g.Name, "%s: name mismatch", ctx)
+		assert.EqualStrings(t, w.Description, g.Description,
+			"%s: description mismatch", ctx)
+
+		if len(g.Jobs) != len(w.Jobs) {
+			t.Fatalf("%s: got %d jobs, want %d", ctx, len(g.Jobs), len(w.Jobs))
+		}
+
+		for j, gotJob := range g.Jobs {
+			wantJob := w.Jobs[j]
+			AssertEqualRanges(t, gotJob.Range, wantJob.Range,
+				"%s: job %d: range mismatch", ctx, j)
+			assert.EqualStrings(t,
+				exprAsStr(t, wantJob.Commands.Expr),
+				exprAsStr(t, gotJob.Commands.Expr),
+				"%s: job %d: commands expr mismatch", ctx, j)
+		}
+	}
+}
+
 func exprAsStr(t *testing.T, expr hhcl.Expression) string {
 	t.Helper()
 
@@ -278,6 +310,7 @@ func assertGenFileBlocks(t *testing.T, got, want []hcl.GenFileBlock) {
 		wantBlock := want[i]
 		AssertEqualRanges(t, gotBlock.Range, wantBlock.Range, "genfile range differs")
 		assert.EqualStrings(t, wantBlock.Label, gotBlock.Label, "genfile label differs")
+		assert.EqualStrings(t, string(wantBlock.Format), string(gotBlock.Format), "genfile format differs")
 		assertAssertsBlock(t, gotBlock.Asserts, wantBlock.Asserts, "genfile asserts")
 	}
 }
@@ -297,6 +330,16 @@ func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
 		"want.Run.CheckGenCode %v != got.Run.CheckGenCode %v",
 		want.CheckGenCode, got.CheckGenCode)
 
+	assertRunHook(t, "before_each", got.BeforeEach, want.BeforeEach)
+	assertRunHook(t, "after_each", got.AfterEach, want.AfterEach)
+	assertRunHook(t, "on_failure", got.OnFailure, want.OnFailure)
+
+	assert.IsTrue(t, want.Timeout == got.Timeout,
+		"want.Run.Timeout %v != got.Run.Timeout %v", want.Timeout, got.Timeout)
+	assert.EqualInts(t, want.Retries, got.Retries, "Run.Retries mismatch")
+	assert.IsTrue(t, want.RetryDelay == got.RetryDelay,
+		"want.Run.RetryDelay %v != got.Run.RetryDelay %v", want.RetryDelay, got.RetryDelay)
+
 	if (want.Env == nil) != (got.Env == nil) {
 		t.Fatalf(
 			"want.Run.Env[%+v] != got.Run.Env[%+v]",
@@ -320,6 +363,22 @@ func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
 	AssertDiff(t, gotHCL, wantHCL)
 }
 
+func assertRunHook(t *testing.T, name string, got, want *ast.Attribute) {
+	t.Helper()
+
+	if (want == nil) != (got == nil) {
+		t.Fatalf("want.Run.%s[%+v] != got.Run.%s[%+v]", name, want, name, got)
+	}
+
+	if want == nil {
+		return
+	}
+
+	assert.EqualStrings(t,
+		exprAsStr(t, want.Expr), exprAsStr(t, got.Expr),
+		"run.%s expr mismatch", name)
+}
+
 // hclFromAttributes ensures that we always build the same HCL document
 // given an hcl.Attributes.
 func hclFromAttributes(t *testing.T, attrs ast.Attributes) string {
@@ -348,6 +407,10 @@ func assertStackBlock(t *testing.T, got, want *hcl.Stack) {
 	for i, w := range want.After {
 		assert.EqualStrings(t, w, got.After[i], "stack after mismatch")
 	}
+
+	AssertDiff(t, got.RunTimeout, want.RunTimeout, "stack run_timeout mismatch")
+	AssertDiff(t, got.RunRetries, want.RunRetries, "stack run_retries mismatch")
+	AssertDiff(t, got.RunRetryDelay, want.RunRetryDelay, "stack run_retry_delay mismatch")
 }
 
 // WriteRootConfig writes a basic terramate root config.
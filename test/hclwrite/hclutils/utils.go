@@ -82,6 +82,16 @@ func GenerateFile(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
 	return Block("generate_file", builders...)
 }
 
+// GenerateJSON is a helper for a "generate_json" block.
+func GenerateJSON(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+	return Block("generate_json", builders...)
+}
+
+// GenerateYAML is a helper for a "generate_yaml" block.
+func GenerateYAML(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+	return Block("generate_yaml", builders...)
+}
+
 // Content is a helper for a "content" block.
 func Content(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
 	return Block("content", builders...)
@@ -177,6 +187,16 @@ func Trigger(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
 	return Block("trigger", builders...)
 }
 
+// Script is a helper for a "script" block.
+func Script(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+	return Block("script", builders...)
+}
+
+// Job is a helper for a "job" block.
+func Job(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+	return Block("job", builders...)
+}
+
 // EvalExpr accepts an expr as the attribute value, similar to Expr,
 // but will evaluate the expr and store the resulting value so
 // it will be available as an attribute value instead of as an
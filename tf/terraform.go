@@ -28,6 +28,7 @@ import (
 // Module represents a terraform module.
 // Note that only the fields relevant for terramate are declared here.
 type Module struct {
+	Name   string // Name is the label of the module block.
 	Source string // Source is the module source path (eg.: directory, git path, etc).
 }
 
@@ -55,13 +56,31 @@ func ParseModules(path string) ([]Module, error) {
 		return nil, errors.E(err, "stat failed on %q", path)
 	}
 
+	logger.Trace().Msg("Read file")
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.E(err, "reading %q", path)
+	}
+
+	return ParseModulesFromSource(path, src)
+}
+
+// ParseModulesFromSource parses blocks of type "module" containing a single
+// label from the given source. The filename is only used on error messages.
+func ParseModulesFromSource(filename string, src []byte) ([]Module, error) {
+	logger := log.With().
+		Str("action", "ParseModulesFromSource()").
+		Str("path", filename).
+		Logger()
+
 	logger.Trace().Msg("Create new parser")
 
 	p := hclparse.NewParser()
 
 	logger.Debug().Msg("Parse HCL file")
 
-	f, diags := p.ParseHCLFile(path)
+	f, diags := p.ParseHCL(src, filename)
 	if diags.HasErrors() {
 		return nil, errors.E(ErrHCLSyntax, diags)
 	}
@@ -104,7 +123,10 @@ func ParseModules(path string) ([]Module, error) {
 
 			continue
 		}
-		modules = append(modules, Module{Source: source})
+		modules = append(modules, Module{
+			Name:   moduleName,
+			Source: source,
+		})
 	}
 
 	if err := errs.AsError(); err != nil {
@@ -77,6 +77,7 @@ func TestHCLParserModules(t *testing.T) {
 			want: want{
 				modules: []tf.Module{
 					{
+						Name:   "test",
 						Source: "",
 					},
 				},
@@ -91,6 +92,7 @@ func TestHCLParserModules(t *testing.T) {
 			want: want{
 				modules: []tf.Module{
 					{
+						Name:   "test",
 						Source: "test",
 					},
 				},
@@ -111,6 +113,7 @@ func TestHCLParserModules(t *testing.T) {
 			want: want{
 				modules: []tf.Module{
 					{
+						Name:   "test",
 						Source: "test",
 					},
 				},
@@ -134,9 +137,11 @@ module "bleh" {
 			want: want{
 				modules: []tf.Module{
 					{
+						Name:   "test",
 						Source: "test",
 					},
 					{
+						Name:   "bleh",
 						Source: "bleh",
 					},
 				},
@@ -217,6 +222,8 @@ module "test" {
 				"got: %v, want: %v", modules, tc.want.modules)
 
 			for i := 0; i < len(tc.want.modules); i++ {
+				assert.EqualStrings(t, tc.want.modules[i].Name, modules[i].Name,
+					"module name mismatch")
 				assert.EqualStrings(t, tc.want.modules[i].Source, modules[i].Source,
 					"module source mismatch")
 			}